@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	bootstrapv1 "github.com/capi-samples/cluster-api-provider-kwok/api/bootstrap/v1beta1"
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1alpha1"
+)
+
+// ConvertTo converts this KwokConfig to the Hub version (v1beta1).
+func (src *KwokConfig) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*bootstrapv1.KwokConfig)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = bootstrapv1.KwokConfigSpec{
+		SimulationConfig: sharedv1.ConvertSimulationConfigTo(src.Spec.SimulationConfig),
+	}
+	dst.Status = bootstrapv1.KwokConfigStatus{
+		LastReconcileDuration: sharedv1.ConvertDurationTo(src.Status.LastReconcileDuration),
+	}
+
+	// Restore the fields which have no equivalent in this version.
+	restored := &bootstrapv1.KwokConfig{}
+	if ok, err := utilconversion.UnmarshalData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Status.Ready = restored.Status.Ready
+	dst.Status.DataSecretName = restored.Status.DataSecretName
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *KwokConfig) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*bootstrapv1.KwokConfig)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = KwokConfigSpec{
+		SimulationConfig: sharedv1.ConvertSimulationConfigFrom(src.Spec.SimulationConfig),
+	}
+	dst.Status = KwokConfigStatus{
+		LastReconcileDuration: sharedv1.ConvertDurationFrom(src.Status.LastReconcileDuration),
+	}
+
+	// Preserve the fields which have no equivalent in this version.
+	return utilconversion.MarshalData(src, dst)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+const (
+	// ClusterAvailableCondition reports whether the API server of the kwok cluster is serving requests.
+	ClusterAvailableCondition clusterv1.ConditionType = "ClusterAvailable"
+
+	// ClusterCreatingReason (Severity=Info) is used while the cluster is created in the kwok runtime.
+	ClusterCreatingReason = "ClusterCreating"
+
+	// ClusterRecreatingReason (Severity=Warning) is used when the cluster went missing from the
+	// kwok runtime, e.g. after `kwokctl delete cluster`, and is created again.
+	ClusterRecreatingReason = "ClusterRecreating"
+
+	// ClusterMigratingReason (Severity=Info) is used while a cluster created in the working directory
+	// itself by earlier releases is moved to its own working directory.
+	ClusterMigratingReason = "ClusterMigrating"
+
+	// ClusterUpgradingReason (Severity=Info) is used while the cluster is upgraded to the requested
+	// Kubernetes version.
+	ClusterUpgradingReason = "ClusterUpgrading"
+
+	// ClusterStartingReason (Severity=Info) is used while the components of the cluster are started.
+	ClusterStartingReason = "ClusterStarting"
+
+	// ClusterUnavailableReason (Severity=Warning) is used when the API server of a cluster that was
+	// already initialized stopped serving requests, and the cluster is started again.
+	ClusterUnavailableReason = "ClusterUnavailable"
+
+	// ClusterHibernatingReason (Severity=Info) is used while the components of the cluster are
+	// stopped to hibernate it.
+	ClusterHibernatingReason = "ClusterHibernating"
+
+	// ClusterHibernatedReason (Severity=Info) is used when the cluster is hibernated.
+	ClusterHibernatedReason = "ClusterHibernated"
+
+	// ClusterResumingReason (Severity=Info) is used while a hibernated cluster is started again.
+	ClusterResumingReason = "ClusterResuming"
+)
+
+const (
+	// SnapshotRestoredCondition reports whether the snapshot referenced by spec.restoreFrom was
+	// restored into the cluster.
+	SnapshotRestoredCondition clusterv1.ConditionType = "SnapshotRestored"
+
+	// WaitingForSnapshotReason (Severity=Info) is used while the snapshot to restore is not completed.
+	WaitingForSnapshotReason = "WaitingForSnapshot"
+
+	// SnapshotRestoringReason (Severity=Info) is used while the snapshot is restored.
+	SnapshotRestoringReason = "SnapshotRestoring"
+)
+
+const (
+	// ManifestsAppliedCondition reports whether the manifests referenced by spec.manifests were
+	// applied to the cluster.
+	ManifestsAppliedCondition clusterv1.ConditionType = "ManifestsApplied"
+
+	// ManifestsApplyFailedReason (Severity=Warning) is used when the manifests could not be applied.
+	ManifestsApplyFailedReason = "ManifestsApplyFailed"
+)
+
+const (
+	// ComponentsHealthyCondition reports whether all the probed components of the kwok cluster,
+	// i.e. kube-apiserver, etcd and kwok-controller, are healthy.
+	ComponentsHealthyCondition clusterv1.ConditionType = "ComponentsHealthy"
+
+	// ComponentsRestartingReason (Severity=Warning) is used while unhealthy components are restarted.
+	ComponentsRestartingReason = "ComponentsRestarting"
+)
@@ -0,0 +1,205 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1alpha1"
+)
+
+// ConvertTo converts this KwokControlPlane to the Hub version (v1beta1).
+func (src *KwokControlPlane) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*controlplanev1.KwokControlPlane)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = controlplanev1.KwokControlPlaneSpec{
+		ControlPlaneEndpoint: src.Spec.ControlPlaneEndpoint,
+		SimulationConfig:     sharedv1.ConvertSimulationConfigTo(src.Spec.SimulationConfig),
+		Hibernate:            src.Spec.Hibernate,
+		RestoreFrom:          src.Spec.RestoreFrom,
+		ManifestsStrategy:    controlplanev1.ManifestsStrategy(src.Spec.ManifestsStrategy),
+	}
+	if src.Spec.ExistingCluster != nil {
+		dst.Spec.ExistingCluster = &controlplanev1.ExistingCluster{
+			Name:    src.Spec.ExistingCluster.Name,
+			WorkDir: src.Spec.ExistingCluster.WorkDir,
+		}
+	}
+	for _, m := range src.Spec.Manifests {
+		dst.Spec.Manifests = append(dst.Spec.Manifests, convertManifestSourceTo(m))
+	}
+
+	dst.Status = controlplanev1.KwokControlPlaneStatus{
+		LastReconcileDuration: sharedv1.ConvertDurationTo(src.Status.LastReconcileDuration),
+		Initialized:           src.Status.Initialized,
+		Ready:                 src.Status.Ready,
+		Hibernated:            src.Status.Hibernated,
+		RestoredSnapshot:      src.Status.RestoredSnapshot,
+		FailureReason:         src.Status.FailureReason,
+		FailureMessage:        src.Status.FailureMessage,
+		Conditions:            src.Status.Conditions,
+	}
+	if op := src.Status.Operation; op != nil {
+		dst.Status.Operation = &controlplanev1.OperationStatus{
+			Type:           controlplanev1.OperationType(op.Type),
+			Phase:          controlplanev1.OperationPhase(op.Phase),
+			StartTime:      op.StartTime,
+			CompletionTime: op.CompletionTime,
+			Message:        op.Message,
+			Attempts:       op.Attempts,
+			Snapshot:       op.Snapshot,
+		}
+	}
+	for _, applied := range src.Status.AppliedManifests {
+		out := controlplanev1.AppliedManifests{
+			ManifestSource:  convertManifestSourceTo(applied.ManifestSource),
+			Hash:            applied.Hash,
+			LastAppliedTime: applied.LastAppliedTime,
+		}
+		for _, r := range applied.Resources {
+			out.Resources = append(out.Resources, controlplanev1.AppliedResource(r))
+		}
+		dst.Status.AppliedManifests = append(dst.Status.AppliedManifests, out)
+	}
+
+	// Restore the fields which have no equivalent in this version.
+	restored := &controlplanev1.KwokControlPlane{}
+	if ok, err := utilconversion.UnmarshalData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.Version = restored.Spec.Version
+	dst.Spec.Replicas = restored.Spec.Replicas
+	dst.Spec.MachineTemplate = restored.Spec.MachineTemplate
+	dst.Spec.RolloutStrategy = restored.Spec.RolloutStrategy
+	dst.Status.Version = restored.Status.Version
+	dst.Status.Selector = restored.Status.Selector
+	dst.Status.Replicas = restored.Status.Replicas
+	dst.Status.ReadyReplicas = restored.Status.ReadyReplicas
+	dst.Status.UpdatedReplicas = restored.Status.UpdatedReplicas
+	dst.Status.UnavailableReplicas = restored.Status.UnavailableReplicas
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *KwokControlPlane) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*controlplanev1.KwokControlPlane)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = KwokControlPlaneSpec{
+		ControlPlaneEndpoint: src.Spec.ControlPlaneEndpoint,
+		SimulationConfig:     sharedv1.ConvertSimulationConfigFrom(src.Spec.SimulationConfig),
+		Hibernate:            src.Spec.Hibernate,
+		RestoreFrom:          src.Spec.RestoreFrom,
+		ManifestsStrategy:    ManifestsStrategy(src.Spec.ManifestsStrategy),
+	}
+	if src.Spec.ExistingCluster != nil {
+		dst.Spec.ExistingCluster = &ExistingCluster{
+			Name:    src.Spec.ExistingCluster.Name,
+			WorkDir: src.Spec.ExistingCluster.WorkDir,
+		}
+	}
+	for _, m := range src.Spec.Manifests {
+		dst.Spec.Manifests = append(dst.Spec.Manifests, convertManifestSourceFrom(m))
+	}
+
+	dst.Status = KwokControlPlaneStatus{
+		LastReconcileDuration: sharedv1.ConvertDurationFrom(src.Status.LastReconcileDuration),
+		Initialized:           src.Status.Initialized,
+		Ready:                 src.Status.Ready,
+		Hibernated:            src.Status.Hibernated,
+		RestoredSnapshot:      src.Status.RestoredSnapshot,
+		FailureReason:         src.Status.FailureReason,
+		FailureMessage:        src.Status.FailureMessage,
+		Conditions:            src.Status.Conditions,
+	}
+	if op := src.Status.Operation; op != nil {
+		dst.Status.Operation = &OperationStatus{
+			Type:           OperationType(op.Type),
+			Phase:          OperationPhase(op.Phase),
+			StartTime:      op.StartTime,
+			CompletionTime: op.CompletionTime,
+			Message:        op.Message,
+			Attempts:       op.Attempts,
+			Snapshot:       op.Snapshot,
+		}
+	}
+	for _, applied := range src.Status.AppliedManifests {
+		out := AppliedManifests{
+			ManifestSource:  convertManifestSourceFrom(applied.ManifestSource),
+			Hash:            applied.Hash,
+			LastAppliedTime: applied.LastAppliedTime,
+		}
+		for _, r := range applied.Resources {
+			out.Resources = append(out.Resources, AppliedResource(r))
+		}
+		dst.Status.AppliedManifests = append(dst.Status.AppliedManifests, out)
+	}
+
+	// Preserve the fields which have no equivalent in this version.
+	return utilconversion.MarshalData(src, dst)
+}
+
+func convertManifestSourceTo(src ManifestSource) controlplanev1.ManifestSource {
+	return controlplanev1.ManifestSource{
+		Kind: controlplanev1.ManifestSourceKind(src.Kind),
+		Name: src.Name,
+	}
+}
+
+func convertManifestSourceFrom(src controlplanev1.ManifestSource) ManifestSource {
+	return ManifestSource{
+		Kind: ManifestSourceKind(src.Kind),
+		Name: src.Name,
+	}
+}
+
+// ConvertTo converts this KwokClusterSnapshot to the Hub version (v1beta1).
+func (src *KwokClusterSnapshot) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*controlplanev1.KwokClusterSnapshot)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = controlplanev1.KwokClusterSnapshotSpec{
+		ControlPlaneName: src.Spec.ControlPlaneName,
+	}
+	dst.Status = controlplanev1.KwokClusterSnapshotStatus{
+		Phase:          controlplanev1.SnapshotPhase(src.Status.Phase),
+		Path:           src.Status.Path,
+		CompletionTime: src.Status.CompletionTime,
+		FailureMessage: src.Status.FailureMessage,
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *KwokClusterSnapshot) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*controlplanev1.KwokClusterSnapshot)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = KwokClusterSnapshotSpec{
+		ControlPlaneName: src.Spec.ControlPlaneName,
+	}
+	dst.Status = KwokClusterSnapshotStatus{
+		Phase:          SnapshotPhase(src.Status.Phase),
+		Path:           src.Status.Path,
+		CompletionTime: src.Status.CompletionTime,
+		FailureMessage: src.Status.FailureMessage,
+	}
+	return nil
+}
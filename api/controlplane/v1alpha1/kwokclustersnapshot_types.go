@@ -0,0 +1,98 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// KwokClusterSnapshotFinalizer allows the controller to remove the snapshot file on delete.
+	KwokClusterSnapshotFinalizer = "kwokclustersnapshot.controlplane.cluster.x-k8s.io"
+)
+
+// SnapshotPhase is the phase of a KwokClusterSnapshot.
+type SnapshotPhase string
+
+const (
+	// SnapshotPhasePending means the snapshot is waiting for the control plane to be ready.
+	SnapshotPhasePending SnapshotPhase = "Pending"
+	// SnapshotPhaseRunning means the snapshot is being saved.
+	SnapshotPhaseRunning SnapshotPhase = "Running"
+	// SnapshotPhaseCompleted means the snapshot was saved and can be restored.
+	SnapshotPhaseCompleted SnapshotPhase = "Completed"
+	// SnapshotPhaseFailed means the snapshot could not be saved.
+	SnapshotPhaseFailed SnapshotPhase = "Failed"
+)
+
+// KwokClusterSnapshotSpec defines the desired state of KwokClusterSnapshot
+type KwokClusterSnapshotSpec struct {
+	// ControlPlaneName is the name of the KwokControlPlane, in the namespace of the snapshot,
+	// whose etcd is saved. The snapshot is taken once, when it is created.
+	// +kubebuilder:validation:MinLength=1
+	ControlPlaneName string `json:"controlPlaneName"`
+}
+
+// KwokClusterSnapshotStatus defines the observed state of KwokClusterSnapshot
+type KwokClusterSnapshotStatus struct {
+	// Phase is the phase of the snapshot.
+	// +optional
+	// +kubebuilder:validation:Enum=Pending;Running;Completed;Failed
+	Phase SnapshotPhase `json:"phase,omitempty"`
+
+	// Path is the path of the etcd snapshot, under the working directory of the KwokCluster
+	// of the snapshotted cluster.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// CompletionTime is when the snapshot was saved.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// FailureMessage is set when the snapshot could not be saved.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="ControlPlane",type="string",JSONPath=".spec.controlPlaneName",description="KwokControlPlane the snapshot is taken from"
+//+kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Phase of the snapshot"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KwokClusterSnapshot is the Schema for the kwokclustersnapshots API. It saves the etcd state of
+// a kwok cluster, which new KwokControlPlanes can be restored from.
+type KwokClusterSnapshot struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KwokClusterSnapshotSpec   `json:"spec,omitempty"`
+	Status KwokClusterSnapshotStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// KwokClusterSnapshotList contains a list of KwokClusterSnapshot
+type KwokClusterSnapshotList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokClusterSnapshot `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokClusterSnapshot{}, &KwokClusterSnapshotList{})
+}
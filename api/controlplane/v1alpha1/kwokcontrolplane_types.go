@@ -21,11 +21,15 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
 
 	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1alpha1"
 )
 
 const (
+	// KwokControlPlaneKind is the kind of the KwokControlPlane.
+	KwokControlPlaneKind = "KwokControlPlane"
+
 	// KwokControlPlaneFinalizer allows the controller to clean up resources on delete.
 	KwokControlPlaneFinalizer = "kwok.controleplane.cluster.x-k8s.io"
 )
@@ -42,6 +46,165 @@ type KwokControlPlaneSpec struct {
 	// SimulationConfig holds the configuration options for changing the behavior of the simulation.
 	//+optional
 	SimulationConfig *sharedv1.SimulationConfig `json:"simulationConfig,omitempty"`
+
+	// ExistingCluster adopts a cluster already created with `kwokctl create cluster` instead of
+	// creating a new one. The adopted cluster is never reinstalled, and is deleted along with
+	// the control plane.
+	// +optional
+	ExistingCluster *ExistingCluster `json:"existingCluster,omitempty"`
+
+	// Hibernate stops the components of the cluster to save resources, keeping the state
+	// of etcd. Setting it back to false starts the cluster again.
+	// +optional
+	Hibernate bool `json:"hibernate,omitempty"`
+
+	// RestoreFrom is the name of a KwokClusterSnapshot, in the namespace of the control plane,
+	// restored into the cluster once it is created and before it is reported ready.
+	// +optional
+	RestoreFrom string `json:"restoreFrom,omitempty"`
+
+	// Manifests are ConfigMaps or Secrets, in the namespace of the control plane, holding
+	// manifests applied server-side to the cluster once its API server is available.
+	// +optional
+	Manifests []ManifestSource `json:"manifests,omitempty"`
+
+	// ManifestsStrategy is how the manifests are applied.
+	// +kubebuilder:default=ApplyOnce
+	// +optional
+	ManifestsStrategy ManifestsStrategy `json:"manifestsStrategy,omitempty"`
+}
+
+// ManifestSourceKind is the kind of the object holding manifests.
+type ManifestSourceKind string
+
+const (
+	// ManifestSourceConfigMap is a ConfigMap holding manifests.
+	ManifestSourceConfigMap ManifestSourceKind = "ConfigMap"
+	// ManifestSourceSecret is a Secret holding manifests.
+	ManifestSourceSecret ManifestSourceKind = "Secret"
+)
+
+// ManifestSource references a ConfigMap or Secret whose data values are YAML manifests,
+// possibly holding several documents.
+type ManifestSource struct {
+	// Kind of the object holding the manifests.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind ManifestSourceKind `json:"kind"`
+
+	// Name of the object holding the manifests.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ManifestsStrategy is how manifests are applied to the cluster.
+// +kubebuilder:validation:Enum=ApplyOnce;Reconcile
+type ManifestsStrategy string
+
+const (
+	// ManifestsStrategyApplyOnce applies the manifests of each source once.
+	ManifestsStrategyApplyOnce ManifestsStrategy = "ApplyOnce"
+	// ManifestsStrategyReconcile applies the manifests on every reconcile, reverting any drift.
+	ManifestsStrategyReconcile ManifestsStrategy = "Reconcile"
+)
+
+// AppliedManifests describes the manifests applied to the cluster from a source.
+type AppliedManifests struct {
+	ManifestSource `json:",inline"`
+
+	// Hash is the hash of the applied manifests.
+	Hash string `json:"hash"`
+
+	// LastAppliedTime is when the manifests were last applied.
+	LastAppliedTime metav1.Time `json:"lastAppliedTime"`
+
+	// Resources are the resources applied from the source.
+	// +optional
+	Resources []AppliedResource `json:"resources,omitempty"`
+}
+
+// AppliedResource is a resource applied to the cluster.
+type AppliedResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ExistingCluster references a cluster created with kwokctl.
+type ExistingCluster struct {
+	// Name is the name of the kwokctl cluster.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// WorkDir is the kwokctl working directory the cluster was created in, i.e. $KWOK_WORKDIR,
+	// which defaults to ~/.kwok for kwokctl. Defaults to the working directory of the KwokCluster.
+	// +optional
+	WorkDir string `json:"workDir,omitempty"`
+}
+
+// OperationType is the type of a long-running operation on the kwok runtime.
+type OperationType string
+
+const (
+	// OperationTypeCreate creates the cluster in the kwok runtime.
+	OperationTypeCreate OperationType = "Create"
+	// OperationTypeStart starts the components of the cluster.
+	OperationTypeStart OperationType = "Start"
+	// OperationTypeStop stops the components of the cluster.
+	OperationTypeStop OperationType = "Stop"
+	// OperationTypeRestart restarts unhealthy components of the cluster.
+	OperationTypeRestart OperationType = "Restart"
+	// OperationTypeRestore restores a snapshot into the cluster.
+	OperationTypeRestore OperationType = "Restore"
+	// OperationTypeDelete stops and removes the cluster from the kwok runtime.
+	OperationTypeDelete OperationType = "Delete"
+	// OperationTypeMigrate moves the cluster from the working directory layout of earlier releases.
+	OperationTypeMigrate OperationType = "Migrate"
+	// OperationTypeUpgrade upgrades the cluster to the requested Kubernetes version.
+	OperationTypeUpgrade OperationType = "Upgrade"
+)
+
+// OperationPhase is the phase of a long-running operation on the kwok runtime.
+type OperationPhase string
+
+const (
+	// OperationPhaseRunning means the operation is in progress.
+	OperationPhaseRunning OperationPhase = "Running"
+	// OperationPhaseSucceeded means the operation finished successfully.
+	OperationPhaseSucceeded OperationPhase = "Succeeded"
+	// OperationPhaseFailed means the operation finished with an error.
+	OperationPhaseFailed OperationPhase = "Failed"
+)
+
+// OperationStatus describes a long-running operation on the kwok runtime.
+type OperationStatus struct {
+	// Type is the type of the operation.
+	// +kubebuilder:validation:Enum=Create;Start;Stop;Restart;Restore;Delete;Migrate;Upgrade
+	Type OperationType `json:"type"`
+
+	// Phase is the phase of the operation.
+	// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+	Phase OperationPhase `json:"phase"`
+
+	// StartTime is when the operation was started.
+	StartTime metav1.Time `json:"startTime"`
+
+	// CompletionTime is when the operation finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Message is a human readable message about the operation, e.g. the error it failed with.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Attempts is the number of times this type of operation has been attempted in a row.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Snapshot is the name of the KwokClusterSnapshot restored by a Restore operation.
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
 }
 
 // KwokControlPlaneStatus defines the observed state of KwokControlPlane
@@ -57,6 +220,35 @@ type KwokControlPlaneStatus struct {
 	// receive requests and that the VPC infra is ready.
 	// +kubebuilder:default=false
 	Ready bool `json:"ready"`
+	// Operation is the current, or last finished, long-running operation on the kwok runtime.
+	// +optional
+	Operation *OperationStatus `json:"operation,omitempty"`
+	// Hibernated denotes that the components of the cluster are stopped as requested
+	// by spec.hibernate.
+	// +optional
+	Hibernated bool `json:"hibernated,omitempty"`
+	// RestoredSnapshot is the name of the KwokClusterSnapshot restored into the cluster.
+	// +optional
+	RestoredSnapshot string `json:"restoredSnapshot,omitempty"`
+	// AppliedManifests lists the manifests applied to the cluster from spec.manifests.
+	// +optional
+	AppliedManifests []AppliedManifests `json:"appliedManifests,omitempty"`
+
+	// FailureReason will be set in the event that there is a terminal problem
+	// reconciling the control plane and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	FailureReason *errors.ClusterStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set in the event that there is a terminal problem
+	// reconciling the control plane and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Conditions defines current service state of the KwokControlPlane.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -71,6 +263,16 @@ type KwokControlPlane struct {
 	Status KwokControlPlaneStatus `json:"status,omitempty"`
 }
 
+// GetConditions returns the observations of the operational state of the KwokControlPlane resource.
+func (r *KwokControlPlane) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the underlying service state of the KwokControlPlane to the predescribed clusterv1.Conditions.
+func (r *KwokControlPlane) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
 //+kubebuilder:object:root=true
 
 // KwokControlPlaneList contains a list of KwokControlPlane
@@ -0,0 +1,370 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
+
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1beta1"
+)
+
+const (
+	// KwokControlPlaneKind is the kind of the KwokControlPlane.
+	KwokControlPlaneKind = "KwokControlPlane"
+
+	// KwokControlPlaneFinalizer allows the controller to clean up resources on delete.
+	KwokControlPlaneFinalizer = "kwok.controleplane.cluster.x-k8s.io"
+)
+
+// KwokControlPlaneSpec defines the desired state of KwokControlPlane
+type KwokControlPlaneSpec struct {
+	// ControlPlaneEndpoint represents the endpoint used to communicate with the control plane.
+	// +optional
+	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint"`
+
+	// Version is the Kubernetes version of the cluster, e.g. v1.27.1. It is set by the topology
+	// controller for clusters using a ClusterClass. Defaults to the version of kwokctl. Changing it
+	// upgrades a cluster already created in the kwok runtime by installing it again with the new
+	// version, keeping the content of etcd, and rolls out the control plane Machines to it.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Replicas is the number of control plane Machines. The components of the control plane keep
+	// running in the kwok runtime, the Machines are backed by KwokMachines registered as
+	// control-plane Nodes in the kwok cluster. No Machines are created when unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// MachineTemplate is the template of the control plane Machines, required when replicas is set.
+	// +optional
+	MachineTemplate *KwokControlPlaneMachineTemplate `json:"machineTemplate,omitempty"`
+
+	// RolloutStrategy is how the control plane Machines are replaced when the version or the
+	// machine template changes.
+	// +kubebuilder:default={type: "RollingUpdate", rollingUpdate: {maxSurge: 1}}
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// SimulationConfig holds the configuration options for changing the behavior of the simulation.
+	//+optional
+	SimulationConfig *sharedv1.SimulationConfig `json:"simulationConfig,omitempty"`
+
+	// ExistingCluster adopts a cluster already created with `kwokctl create cluster` instead of
+	// creating a new one. The adopted cluster is never reinstalled, and is deleted along with
+	// the control plane.
+	// +optional
+	ExistingCluster *ExistingCluster `json:"existingCluster,omitempty"`
+
+	// Hibernate stops the components of the cluster to save resources, keeping the state
+	// of etcd. Setting it back to false starts the cluster again.
+	// +optional
+	Hibernate bool `json:"hibernate,omitempty"`
+
+	// RestoreFrom is the name of a KwokClusterSnapshot, in the namespace of the control plane,
+	// restored into the cluster once it is created and before it is reported ready.
+	// +optional
+	RestoreFrom string `json:"restoreFrom,omitempty"`
+
+	// Manifests are ConfigMaps or Secrets, in the namespace of the control plane, holding
+	// manifests applied server-side to the cluster once its API server is available.
+	// +optional
+	Manifests []ManifestSource `json:"manifests,omitempty"`
+
+	// ManifestsStrategy is how the manifests are applied.
+	// +kubebuilder:default=ApplyOnce
+	// +optional
+	ManifestsStrategy ManifestsStrategy `json:"manifestsStrategy,omitempty"`
+}
+
+// KwokControlPlaneMachineTemplate defines the template of the control plane Machines.
+type KwokControlPlaneMachineTemplate struct {
+	// Standard object's metadata, set on the control plane Machines.
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// InfrastructureRef is a reference to the KwokMachineTemplate the infrastructure of the
+	// control plane Machines is created from.
+	InfrastructureRef corev1.ObjectReference `json:"infrastructureRef"`
+}
+
+// RolloutStrategyType is the strategy replacing outdated control plane Machines.
+type RolloutStrategyType string
+
+const (
+	// RollingUpdateStrategyType replaces the outdated control plane Machines one at a time, each
+	// after the Nodes of the new Machines are registered.
+	RollingUpdateStrategyType RolloutStrategyType = "RollingUpdate"
+)
+
+// RolloutStrategy describes how outdated control plane Machines are replaced.
+type RolloutStrategy struct {
+	// Type of the rollout, only RollingUpdate is supported.
+	// +kubebuilder:validation:Enum=RollingUpdate
+	// +optional
+	Type RolloutStrategyType `json:"type,omitempty"`
+
+	// RollingUpdate configures the rolling update, when type is RollingUpdate.
+	// +optional
+	RollingUpdate *RollingUpdate `json:"rollingUpdate,omitempty"`
+}
+
+// RollingUpdate configures the rolling update of the control plane Machines.
+type RollingUpdate struct {
+	// MaxSurge is the maximum number of Machines created above the desired replicas during a
+	// rollout, as a number or a percentage of the desired replicas rounded up. With 0, each
+	// outdated Machine is deleted before its replacement is created. Defaults to 1.
+	// +optional
+	MaxSurge *intstr.IntOrString `json:"maxSurge,omitempty"`
+}
+
+// ManifestSourceKind is the kind of the object holding manifests.
+type ManifestSourceKind string
+
+const (
+	// ManifestSourceConfigMap is a ConfigMap holding manifests.
+	ManifestSourceConfigMap ManifestSourceKind = "ConfigMap"
+	// ManifestSourceSecret is a Secret holding manifests.
+	ManifestSourceSecret ManifestSourceKind = "Secret"
+)
+
+// ManifestSource references a ConfigMap or Secret whose data values are YAML manifests,
+// possibly holding several documents.
+type ManifestSource struct {
+	// Kind of the object holding the manifests.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind ManifestSourceKind `json:"kind"`
+
+	// Name of the object holding the manifests.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ManifestsStrategy is how manifests are applied to the cluster.
+// +kubebuilder:validation:Enum=ApplyOnce;Reconcile
+type ManifestsStrategy string
+
+const (
+	// ManifestsStrategyApplyOnce applies the manifests of each source once.
+	ManifestsStrategyApplyOnce ManifestsStrategy = "ApplyOnce"
+	// ManifestsStrategyReconcile applies the manifests on every reconcile, reverting any drift.
+	ManifestsStrategyReconcile ManifestsStrategy = "Reconcile"
+)
+
+// AppliedManifests describes the manifests applied to the cluster from a source.
+type AppliedManifests struct {
+	ManifestSource `json:",inline"`
+
+	// Hash is the hash of the applied manifests.
+	Hash string `json:"hash"`
+
+	// LastAppliedTime is when the manifests were last applied.
+	LastAppliedTime metav1.Time `json:"lastAppliedTime"`
+
+	// Resources are the resources applied from the source.
+	// +optional
+	Resources []AppliedResource `json:"resources,omitempty"`
+}
+
+// AppliedResource is a resource applied to the cluster.
+type AppliedResource struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ExistingCluster references a cluster created with kwokctl.
+type ExistingCluster struct {
+	// Name is the name of the kwokctl cluster.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// WorkDir is the kwokctl working directory the cluster was created in, i.e. $KWOK_WORKDIR,
+	// which defaults to ~/.kwok for kwokctl. Defaults to the working directory of the KwokCluster.
+	// +optional
+	WorkDir string `json:"workDir,omitempty"`
+}
+
+// OperationType is the type of a long-running operation on the kwok runtime.
+type OperationType string
+
+const (
+	// OperationTypeCreate creates the cluster in the kwok runtime.
+	OperationTypeCreate OperationType = "Create"
+	// OperationTypeStart starts the components of the cluster.
+	OperationTypeStart OperationType = "Start"
+	// OperationTypeStop stops the components of the cluster.
+	OperationTypeStop OperationType = "Stop"
+	// OperationTypeRestart restarts unhealthy components of the cluster.
+	OperationTypeRestart OperationType = "Restart"
+	// OperationTypeRestore restores a snapshot into the cluster.
+	OperationTypeRestore OperationType = "Restore"
+	// OperationTypeDelete stops and removes the cluster from the kwok runtime.
+	OperationTypeDelete OperationType = "Delete"
+	// OperationTypeMigrate moves the cluster from the working directory layout of earlier releases.
+	OperationTypeMigrate OperationType = "Migrate"
+	// OperationTypeUpgrade upgrades the cluster to the requested Kubernetes version.
+	OperationTypeUpgrade OperationType = "Upgrade"
+)
+
+// OperationPhase is the phase of a long-running operation on the kwok runtime.
+type OperationPhase string
+
+const (
+	// OperationPhaseRunning means the operation is in progress.
+	OperationPhaseRunning OperationPhase = "Running"
+	// OperationPhaseSucceeded means the operation finished successfully.
+	OperationPhaseSucceeded OperationPhase = "Succeeded"
+	// OperationPhaseFailed means the operation finished with an error.
+	OperationPhaseFailed OperationPhase = "Failed"
+)
+
+// OperationStatus describes a long-running operation on the kwok runtime.
+type OperationStatus struct {
+	// Type is the type of the operation.
+	// +kubebuilder:validation:Enum=Create;Start;Stop;Restart;Restore;Delete;Migrate;Upgrade
+	Type OperationType `json:"type"`
+
+	// Phase is the phase of the operation.
+	// +kubebuilder:validation:Enum=Running;Succeeded;Failed
+	Phase OperationPhase `json:"phase"`
+
+	// StartTime is when the operation was started.
+	StartTime metav1.Time `json:"startTime"`
+
+	// CompletionTime is when the operation finished.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Message is a human readable message about the operation, e.g. the error it failed with.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Attempts is the number of times this type of operation has been attempted in a row.
+	// +optional
+	Attempts int32 `json:"attempts,omitempty"`
+
+	// Snapshot is the name of the KwokClusterSnapshot restored by a Restore operation.
+	// +optional
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+// KwokControlPlaneStatus defines the observed state of KwokControlPlane
+type KwokControlPlaneStatus struct {
+	// LastReconcileDuration is the duration of the last reconcile loop.
+	// +optional
+	LastReconcileDuration *metav1.Duration `json:"lastReconcileDuration,omitempty"`
+	// Initialized denotes whether or not the control plane has the
+	// uploaded kubernetes config-map.
+	// +optional
+	Initialized bool `json:"initialized"`
+	// Ready denotes that the KwokControlPlane API Server is ready to
+	// receive requests and that the VPC infra is ready.
+	// +kubebuilder:default=false
+	Ready bool `json:"ready"`
+	// Version is the Kubernetes version the cluster runs in the kwok runtime.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Selector is the label selector of the control plane Machines, in string form.
+	// +optional
+	Selector string `json:"selector,omitempty"`
+	// Replicas is the number of control plane Machines.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+	// ReadyReplicas is the number of control plane Machines whose Node is registered.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+	// UpdatedReplicas is the number of control plane Machines matching the desired version
+	// and machine template.
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
+	// UnavailableReplicas is the number of control plane Machines whose Node is not registered.
+	// +optional
+	UnavailableReplicas int32 `json:"unavailableReplicas,omitempty"`
+	// Operation is the current, or last finished, long-running operation on the kwok runtime.
+	// +optional
+	Operation *OperationStatus `json:"operation,omitempty"`
+	// Hibernated denotes that the components of the cluster are stopped as requested
+	// by spec.hibernate.
+	// +optional
+	Hibernated bool `json:"hibernated,omitempty"`
+	// RestoredSnapshot is the name of the KwokClusterSnapshot restored into the cluster.
+	// +optional
+	RestoredSnapshot string `json:"restoredSnapshot,omitempty"`
+	// AppliedManifests lists the manifests applied to the cluster from spec.manifests.
+	// +optional
+	AppliedManifests []AppliedManifests `json:"appliedManifests,omitempty"`
+
+	// FailureReason will be set in the event that there is a terminal problem
+	// reconciling the control plane and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	FailureReason *errors.ClusterStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set in the event that there is a terminal problem
+	// reconciling the control plane and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Conditions defines current service state of the KwokControlPlane.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas,selectorpath=.status.selector
+//+kubebuilder:storageversion
+
+// KwokControlPlane is the Schema for the kwokcontrolplanes API
+type KwokControlPlane struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KwokControlPlaneSpec   `json:"spec,omitempty"`
+	Status KwokControlPlaneStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the observations of the operational state of the KwokControlPlane resource.
+func (r *KwokControlPlane) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the underlying service state of the KwokControlPlane to the predescribed clusterv1.Conditions.
+func (r *KwokControlPlane) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// KwokControlPlaneList contains a list of KwokControlPlane
+type KwokControlPlaneList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokControlPlane `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokControlPlane{}, &KwokControlPlaneList{})
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1beta1"
+)
+
+// KwokControlPlaneTemplateSpec defines the desired state of KwokControlPlaneTemplate
+type KwokControlPlaneTemplateSpec struct {
+	// Template is the template of the KwokControlPlanes created from this template.
+	Template KwokControlPlaneTemplateResource `json:"template"`
+}
+
+// KwokControlPlaneTemplateResource describes the data needed to create a KwokControlPlane from
+// a template.
+type KwokControlPlaneTemplateResource struct {
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the desired behavior of the control plane.
+	Spec KwokControlPlaneTemplateResourceSpec `json:"spec"`
+}
+
+// KwokControlPlaneTemplateResourceSpec defines the desired state of a KwokControlPlane created
+// from a template. It omits the fields owned by the topology controller, such as the version,
+// and the ones specific to a single cluster, such as the control plane endpoint.
+type KwokControlPlaneTemplateResourceSpec struct {
+	// RolloutStrategy is how the control plane Machines are replaced when the version or the
+	// machine template changes.
+	// +kubebuilder:default={type: "RollingUpdate", rollingUpdate: {maxSurge: 1}}
+	// +optional
+	RolloutStrategy *RolloutStrategy `json:"rolloutStrategy,omitempty"`
+
+	// SimulationConfig holds the configuration options for changing the behavior of the simulation.
+	// +optional
+	SimulationConfig *sharedv1.SimulationConfig `json:"simulationConfig,omitempty"`
+
+	// Hibernate stops the components of the cluster to save resources, keeping the state
+	// of etcd. Setting it back to false starts the cluster again.
+	// +optional
+	Hibernate bool `json:"hibernate,omitempty"`
+
+	// RestoreFrom is the name of a KwokClusterSnapshot, in the namespace of the control plane,
+	// restored into the cluster once it is created and before it is reported ready.
+	// +optional
+	RestoreFrom string `json:"restoreFrom,omitempty"`
+
+	// Manifests are ConfigMaps or Secrets, in the namespace of the control plane, holding
+	// manifests applied server-side to the cluster once its API server is available.
+	// +optional
+	Manifests []ManifestSource `json:"manifests,omitempty"`
+
+	// ManifestsStrategy is how the manifests are applied.
+	// +kubebuilder:default=ApplyOnce
+	// +optional
+	ManifestsStrategy ManifestsStrategy `json:"manifestsStrategy,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// KwokControlPlaneTemplate is the Schema for the kwokcontrolplanetemplates API, which is used by
+// ClusterClasses to create KwokControlPlanes.
+type KwokControlPlaneTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KwokControlPlaneTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// KwokControlPlaneTemplateList contains a list of KwokControlPlaneTemplate
+type KwokControlPlaneTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokControlPlaneTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokControlPlaneTemplate{}, &KwokControlPlaneTemplateList{})
+}
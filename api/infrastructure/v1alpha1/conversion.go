@@ -0,0 +1,160 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1alpha1"
+)
+
+// ConvertTo converts this KwokCluster to the Hub version (v1beta1).
+func (src *KwokCluster) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1.KwokCluster)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertKwokClusterSpecTo(&src.Spec, &dst.Spec)
+	dst.Status = infrav1.KwokClusterStatus{
+		Ready:                 src.Status.Ready,
+		Conditions:            src.Status.Conditions,
+		FailureDomains:        src.Status.FailureDomains,
+		LastReconcileDuration: sharedv1.ConvertDurationTo(src.Status.LastReconcileDuration),
+	}
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *KwokCluster) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1.KwokCluster)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertKwokClusterSpecFrom(&src.Spec, &dst.Spec)
+	dst.Status = KwokClusterStatus{
+		Ready:                 src.Status.Ready,
+		Conditions:            src.Status.Conditions,
+		FailureDomains:        src.Status.FailureDomains,
+		LastReconcileDuration: sharedv1.ConvertDurationFrom(src.Status.LastReconcileDuration),
+	}
+	return nil
+}
+
+func convertKwokClusterSpecTo(src *KwokClusterSpec, dst *infrav1.KwokClusterSpec) {
+	*dst = infrav1.KwokClusterSpec{
+		BindAddress:          src.BindAddress,
+		Runtime:              src.Runtime,
+		WorkingDir:           src.WorkingDir,
+		ControlPlaneEndpoint: src.ControlPlaneEndpoint,
+		SimulationConfig:     sharedv1.ConvertSimulationConfigTo(src.SimulationConfig),
+	}
+}
+
+func convertKwokClusterSpecFrom(src *infrav1.KwokClusterSpec, dst *KwokClusterSpec) {
+	*dst = KwokClusterSpec{
+		BindAddress:          src.BindAddress,
+		Runtime:              src.Runtime,
+		WorkingDir:           src.WorkingDir,
+		ControlPlaneEndpoint: src.ControlPlaneEndpoint,
+		SimulationConfig:     sharedv1.ConvertSimulationConfigFrom(src.SimulationConfig),
+	}
+}
+
+// ConvertTo converts this KwokMachine to the Hub version (v1beta1).
+func (src *KwokMachine) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1.KwokMachine)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertKwokMachineSpecTo(&src.Spec, &dst.Spec)
+	dst.Status = infrav1.KwokMachineStatus{
+		Ready:                 src.Status.Ready,
+		FailureReason:         src.Status.FailureReason,
+		FailureMessage:        src.Status.FailureMessage,
+		Conditions:            src.Status.Conditions,
+		LastReconcileDuration: sharedv1.ConvertDurationTo(src.Status.LastReconcileDuration),
+	}
+
+	// Restore the fields which have no equivalent in this version.
+	restored := &infrav1.KwokMachine{}
+	if ok, err := utilconversion.UnmarshalData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.Node = restored.Spec.Node
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *KwokMachine) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1.KwokMachine)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	convertKwokMachineSpecFrom(&src.Spec, &dst.Spec)
+	dst.Status = KwokMachineStatus{
+		Ready:                 src.Status.Ready,
+		FailureReason:         src.Status.FailureReason,
+		FailureMessage:        src.Status.FailureMessage,
+		Conditions:            src.Status.Conditions,
+		LastReconcileDuration: sharedv1.ConvertDurationFrom(src.Status.LastReconcileDuration),
+	}
+
+	// Preserve the fields which have no equivalent in this version.
+	return utilconversion.MarshalData(src, dst)
+}
+
+func convertKwokMachineSpecTo(src *KwokMachineSpec, dst *infrav1.KwokMachineSpec) {
+	*dst = infrav1.KwokMachineSpec{
+		ProviderID:       src.ProviderID,
+		SimulationConfig: sharedv1.ConvertSimulationConfigTo(src.SimulationConfig),
+	}
+}
+
+func convertKwokMachineSpecFrom(src *infrav1.KwokMachineSpec, dst *KwokMachineSpec) {
+	*dst = KwokMachineSpec{
+		ProviderID:       src.ProviderID,
+		SimulationConfig: sharedv1.ConvertSimulationConfigFrom(src.SimulationConfig),
+	}
+}
+
+// ConvertTo converts this KwokMachineTemplate to the Hub version (v1beta1). The v1alpha1 version
+// has no machine template nor capacity, they are restored from the annotation set when converting
+// from the hub.
+func (src *KwokMachineTemplate) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*infrav1.KwokMachineTemplate)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = infrav1.KwokMachineTemplateSpec{}
+
+	restored := &infrav1.KwokMachineTemplate{}
+	if ok, err := utilconversion.UnmarshalData(dst, restored); err != nil || !ok {
+		return err
+	}
+	dst.Spec.Template = restored.Spec.Template
+	dst.Status = restored.Status
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *KwokMachineTemplate) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*infrav1.KwokMachineTemplate)
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = KwokMachineTemplateSpec{}
+	dst.Status = KwokMachineTemplateStatus{}
+
+	// Preserve the machine template and capacity, which have no equivalent in this version.
+	return utilconversion.MarshalData(src, dst)
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
+	utilconversion "sigs.k8s.io/cluster-api/util/conversion"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+func TestFuzzyConversion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := infrav1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("for KwokCluster", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:      scheme,
+		Hub:         &infrav1.KwokCluster{},
+		Spoke:       &KwokCluster{},
+		FuzzerFuncs: []fuzzer.FuzzerFuncs{fuzzFuncs},
+	}))
+	t.Run("for KwokMachine", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:      scheme,
+		Hub:         &infrav1.KwokMachine{},
+		Spoke:       &KwokMachine{},
+		FuzzerFuncs: []fuzzer.FuzzerFuncs{fuzzFuncs},
+	}))
+	t.Run("for KwokMachineTemplate", utilconversion.FuzzTestFunc(utilconversion.FuzzTestFuncInput{
+		Scheme:      scheme,
+		Hub:         &infrav1.KwokMachineTemplate{},
+		Spoke:       &KwokMachineTemplate{},
+		FuzzerFuncs: []fuzzer.FuzzerFuncs{fuzzFuncs},
+	}))
+}
+
+func fuzzFuncs(_ runtimeserializer.CodecFactory) []interface{} {
+	return []interface{}{
+		// The zero duration is unset in v1beta1.
+		func(in *infrav1.KwokClusterStatus, c fuzz.Continue) {
+			c.FuzzNoCustom(in)
+			if in.LastReconcileDuration != nil && in.LastReconcileDuration.Duration == 0 {
+				in.LastReconcileDuration = nil
+			}
+		},
+		func(in *infrav1.KwokMachineStatus, c fuzz.Continue) {
+			c.FuzzNoCustom(in)
+			if in.LastReconcileDuration != nil && in.LastReconcileDuration.Duration == 0 {
+				in.LastReconcileDuration = nil
+			}
+		},
+		// The placeholder field is dropped by v1beta1.
+		func(in *KwokMachineTemplateSpec, c fuzz.Continue) {
+			c.FuzzNoCustom(in)
+			in.Foo = ""
+		},
+	}
+}
@@ -28,6 +28,13 @@ import (
 const (
 	// KwokClusterFinalizer allows the controller to clean up resources on delete.
 	KwokClusterFinalizer = "kwokcluster.infrastructure.cluster.x-k8s.io"
+
+	// RuntimeSimulated is a runtime that runs no cluster components at all. The API server of
+	// each cluster is served by the manager from objects kept in memory, which allows scale
+	// testing the Cluster API controllers with thousands of clusters on a single host. The
+	// objects are not validated and no controllers act on them, besides renewing the heartbeat
+	// of the nodes. They are lost when the manager restarts, the clusters are then created again.
+	RuntimeSimulated = "simulated"
 )
 
 // KwokClusterSpec defines the desired state of KwokCluster
@@ -36,16 +43,19 @@ type KwokClusterSpec struct {
 	//+optional
 	BindAddress string `json:"bindAddress,omitempty"`
 
-	// Runtime is the kwok runtime to use.
+	// Runtime is the kwok runtime to use. Besides the kwokctl runtimes, such as docker or
+	// binary, it can be "simulated" to serve the API server of the cluster from the manager.
 	// +kubebuilder:default=docker
 	Runtime string `json:"runtime,omitempty"`
 
-	// WorkingDir is the directory to use for the kwok runtime. If using kind
-	// you will need to mount this as an extra volume.
+	// WorkingDir is the directory to use for the kwok runtime. Each cluster gets its own
+	// directory under it. If using kind you will need to mount this as an extra volume.
 	// +kubebuilder:default=/kwok
 	WorkingDir string `json:"workingDir,omitempty"`
 
 	// ControlPlaneEndpoint represents the endpoint used to communicate with the control plane.
+	// When the Cluster uses a KwokControlPlane this is copied from the control plane, otherwise
+	// it can be set to the endpoint of an external control plane.
 	// +optional
 	ControlPlaneEndpoint clusterv1.APIEndpoint `json:"controlPlaneEndpoint"`
 
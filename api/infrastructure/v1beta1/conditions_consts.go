@@ -0,0 +1,51 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+const (
+	// NodeProvisionedCondition reports whether the Node of the KwokMachine is registered in the
+	// kwok cluster.
+	NodeProvisionedCondition clusterv1.ConditionType = "NodeProvisioned"
+
+	// WaitingForBootstrapDataReason (Severity=Info) is used while the bootstrap data of the Machine
+	// is not available.
+	WaitingForBootstrapDataReason = "WaitingForBootstrapData"
+
+	// NodeProvisioningReason (Severity=Info) is used while the simulated provisioning latency of
+	// the Node has not elapsed.
+	NodeProvisioningReason = "NodeProvisioning"
+
+	// NodeProvisioningFailedReason (Severity=Warning) is used when the Node could not be registered
+	// in the kwok cluster.
+	NodeProvisioningFailedReason = "NodeProvisioningFailed"
+)
+
+const (
+	// InstancesReadyCondition reports whether the Nodes of all the instances of a KwokMachinePool
+	// are registered in the kwok cluster.
+	InstancesReadyCondition clusterv1.ConditionType = "InstancesReady"
+
+	// InstancesProvisioningReason (Severity=Info) is used while instances wait for their simulated
+	// provisioning latency.
+	InstancesProvisioningReason = "InstancesProvisioning"
+
+	// InstanceProvisioningFailedReason (Severity=Warning) is used when the simulated provisioning
+	// of an instance failed, or its Node could not be registered.
+	InstanceProvisioningFailedReason = "InstanceProvisioningFailed"
+)
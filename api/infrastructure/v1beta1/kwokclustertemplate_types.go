@@ -0,0 +1,63 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// KwokClusterTemplateSpec defines the desired state of KwokClusterTemplate
+type KwokClusterTemplateSpec struct {
+	// Template is the template of the KwokClusters created from this template.
+	Template KwokClusterTemplateResource `json:"template"`
+}
+
+// KwokClusterTemplateResource describes the data needed to create a KwokCluster from a template.
+type KwokClusterTemplateResource struct {
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the desired behavior of the cluster.
+	Spec KwokClusterSpec `json:"spec"`
+}
+
+//+kubebuilder:object:root=true
+
+// KwokClusterTemplate is the Schema for the kwokclustertemplates API, which is used by
+// ClusterClasses to create KwokClusters.
+type KwokClusterTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KwokClusterTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// KwokClusterTemplateList contains a list of KwokClusterTemplate
+type KwokClusterTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokClusterTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokClusterTemplate{}, &KwokClusterTemplateList{})
+}
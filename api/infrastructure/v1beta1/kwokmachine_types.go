@@ -0,0 +1,191 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
+
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1beta1"
+)
+
+const (
+	// KwokMachineFinalizer allows the controller to clean up resources on delete.
+	KwokMachineFinalizer = "kwokmachine.infrastructure.cluster.x-k8s.io"
+)
+
+// KwokMachineSpec defines the desired state of KwokMachine
+type KwokMachineSpec struct {
+	// ProviderID is the unique identifier as specified by the cloud provider.
+	ProviderID *string `json:"providerID,omitempty"`
+
+	// SimulationConfig holds the configuration options for changing the behavior of the simulation.
+	//+optional
+	SimulationConfig *sharedv1.SimulationConfig `json:"simulationConfig,omitempty"`
+
+	// Node is the shape of the fake Node registered for the machine.
+	//+optional
+	Node *NodeShape `json:"node,omitempty"`
+}
+
+// NodeShape describes the fake Node registered for a machine.
+type NodeShape struct {
+	// Capacity is the capacity of the Node, e.g. cpu, memory, pods and extended resources such
+	// as example.com/gpu. Extended resources must be whole numbers. The cpu, memory and pods
+	// left unset default to 4, 16Gi and 110.
+	//+optional
+	Capacity corev1.ResourceList `json:"capacity,omitempty"`
+
+	// Allocatable is the part of the capacity of the Node available for scheduling. The
+	// resources left unset default to their capacity.
+	//+optional
+	Allocatable corev1.ResourceList `json:"allocatable,omitempty"`
+
+	// Labels are added to the Node. They may override the well-known hostname, os and arch
+	// labels.
+	//+optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Annotations are added to the Node.
+	//+optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Taints are added to the Node, along with the control plane taint of control plane
+	// machines.
+	//+optional
+	Taints []corev1.Taint `json:"taints,omitempty"`
+
+	// NodeInfo is the system information reported by the Node.
+	//+optional
+	NodeInfo *NodeInfo `json:"nodeInfo,omitempty"`
+}
+
+// NodeInfo is the system information reported by a fake Node.
+type NodeInfo struct {
+	// OperatingSystem is the operating system of the Node. Defaults to linux.
+	//+optional
+	OperatingSystem string `json:"operatingSystem,omitempty"`
+
+	// Architecture is the architecture of the Node. Defaults to amd64.
+	//+optional
+	Architecture string `json:"architecture,omitempty"`
+
+	// KernelVersion is the kernel version of the Node, e.g. "5.15.0-1034-aws".
+	//+optional
+	KernelVersion string `json:"kernelVersion,omitempty"`
+
+	// KubeletVersion is the kubelet version of the Node. Defaults to the version of the
+	// Machine.
+	//+optional
+	KubeletVersion string `json:"kubeletVersion,omitempty"`
+}
+
+// GetCapacity returns the capacity of the Node, with the defaults of the resources left unset.
+func (n *NodeShape) GetCapacity() corev1.ResourceList {
+	capacity := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("4"),
+		corev1.ResourceMemory: resource.MustParse("16Gi"),
+		corev1.ResourcePods:   resource.MustParse("110"),
+	}
+	if n == nil {
+		return capacity
+	}
+	for name, quantity := range n.Capacity {
+		capacity[name] = quantity.DeepCopy()
+	}
+	return capacity
+}
+
+// GetAllocatable returns the allocatable resources of the Node, with the capacity of the resources
+// left unset.
+func (n *NodeShape) GetAllocatable() corev1.ResourceList {
+	allocatable := n.GetCapacity()
+	if n == nil {
+		return allocatable
+	}
+	for name, quantity := range n.Allocatable {
+		allocatable[name] = quantity.DeepCopy()
+	}
+	return allocatable
+}
+
+// KwokMachineStatus defines the observed state of KwokMachine
+type KwokMachineStatus struct {
+	// Ready is true when the provider resource is ready.
+	// +optional
+	// +kubebuilder:default=false
+	Ready bool `json:"ready"`
+
+	// FailureReason will be set in the event that there is a terminal problem
+	// reconciling the Machine and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	FailureReason *errors.MachineStatusError `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set in the event that there is a terminal problem
+	// reconciling the Machine and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Conditions defines current service state of the KwokMachine.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// LastReconcileDuration is the duration of the last reconcile loop.
+	// +optional
+	LastReconcileDuration *metav1.Duration `json:"lastReconcileDuration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// KwokMachine is the Schema for the kwokmachines API
+type KwokMachine struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KwokMachineSpec   `json:"spec,omitempty"`
+	Status KwokMachineStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the observations of the operational state of the KwokMachine resource.
+func (r *KwokMachine) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the underlying service state of the KwokMachine to the predescribed clusterv1.Conditions.
+func (r *KwokMachine) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// KwokMachineList contains a list of KwokMachine
+type KwokMachineList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokMachine `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokMachine{}, &KwokMachineList{})
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/errors"
+)
+
+const (
+	// KwokMachinePoolFinalizer allows the controller to clean up resources on delete.
+	KwokMachinePoolFinalizer = "kwokmachinepool.infrastructure.cluster.x-k8s.io"
+)
+
+// KwokMachinePoolSpec defines the desired state of KwokMachinePool
+type KwokMachinePoolSpec struct {
+	// ProviderID is the identifier of the pool.
+	// +optional
+	ProviderID string `json:"providerID,omitempty"`
+
+	// ProviderIDList are the provider IDs of the Nodes of the pool, set by the controller.
+	// +optional
+	ProviderIDList []string `json:"providerIDList,omitempty"`
+
+	// InstanceSimulation configures the simulated provisioning of the instances of the pool.
+	// +optional
+	InstanceSimulation *InstanceSimulation `json:"instanceSimulation,omitempty"`
+}
+
+// InstanceSimulation configures the simulated provisioning of each instance of a KwokMachinePool.
+type InstanceSimulation struct {
+	// Latency is the time an instance takes to be provisioned before its Node is registered.
+	// +optional
+	Latency metav1.Duration `json:"latency,omitempty"`
+
+	// FailurePercentage is the chance, in percent, of an instance failing to be provisioned once
+	// its latency has elapsed. Failed instances are provisioned again.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	// +optional
+	FailurePercentage int32 `json:"failurePercentage,omitempty"`
+}
+
+// KwokMachinePoolInstanceStatus is the status of an instance of a KwokMachinePool.
+type KwokMachinePoolInstanceStatus struct {
+	// InstanceName is the name of the instance, and of its Node.
+	InstanceName string `json:"instanceName"`
+
+	// ProviderID is the provider ID of the Node of the instance, once registered.
+	// +optional
+	ProviderID string `json:"providerID,omitempty"`
+
+	// Ready is true when the Node of the instance is registered.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// ProvisioningStartTime is when the current attempt to provision the instance started.
+	// +optional
+	ProvisioningStartTime metav1.Time `json:"provisioningStartTime,omitempty"`
+
+	// ProvisioningFailures is the number of simulated provisioning failures of the instance.
+	// +optional
+	ProvisioningFailures int32 `json:"provisioningFailures,omitempty"`
+}
+
+// KwokMachinePoolStatus defines the observed state of KwokMachinePool
+type KwokMachinePoolStatus struct {
+	// Ready is true when all the instances of the pool are provisioned.
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Replicas is the number of instances whose Node is registered.
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// Instances are the statuses of the instances of the pool.
+	// +optional
+	Instances []KwokMachinePoolInstanceStatus `json:"instances,omitempty"`
+
+	// FailureReason will be set in the event that there is a terminal problem
+	// reconciling the MachinePool and will contain a succinct value suitable
+	// for machine interpretation.
+	// +optional
+	FailureReason *errors.MachinePoolStatusFailure `json:"failureReason,omitempty"`
+
+	// FailureMessage will be set in the event that there is a terminal problem
+	// reconciling the MachinePool and will contain a more verbose string suitable
+	// for logging and human consumption.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+
+	// Conditions defines current service state of the KwokMachinePool.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// LastReconcileDuration is the duration of the last reconcile loop.
+	// +optional
+	LastReconcileDuration *metav1.Duration `json:"lastReconcileDuration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="All the instances of the pool are provisioned"
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Instances whose Node is registered"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KwokMachinePool is the Schema for the kwokmachinepools API, the infrastructure of MachinePools
+// backed by fake Nodes in the kwok cluster.
+type KwokMachinePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KwokMachinePoolSpec   `json:"spec,omitempty"`
+	Status KwokMachinePoolStatus `json:"status,omitempty"`
+}
+
+// GetConditions returns the observations of the operational state of the KwokMachinePool resource.
+func (r *KwokMachinePool) GetConditions() clusterv1.Conditions {
+	return r.Status.Conditions
+}
+
+// SetConditions sets the underlying service state of the KwokMachinePool to the predescribed clusterv1.Conditions.
+func (r *KwokMachinePool) SetConditions(conditions clusterv1.Conditions) {
+	r.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// KwokMachinePoolList contains a list of KwokMachinePool
+type KwokMachinePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokMachinePool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokMachinePool{}, &KwokMachinePoolList{})
+}
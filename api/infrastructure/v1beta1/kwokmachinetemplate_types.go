@@ -0,0 +1,74 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+// KwokMachineTemplateSpec defines the desired state of KwokMachineTemplate
+type KwokMachineTemplateSpec struct {
+	// Template is the template of the KwokMachines created from this template.
+	Template KwokMachineTemplateResource `json:"template"`
+}
+
+// KwokMachineTemplateResource describes the data needed to create a KwokMachine from a template.
+type KwokMachineTemplateResource struct {
+	// Standard object's metadata.
+	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#metadata
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec is the specification of the desired behavior of the machine.
+	Spec KwokMachineSpec `json:"spec"`
+}
+
+// KwokMachineTemplateStatus defines the observed state of KwokMachineTemplate
+type KwokMachineTemplateStatus struct {
+	// Capacity is the capacity of the Nodes of the machines created from this template. The
+	// cluster autoscaler reads it to scale node groups from zero.
+	// +optional
+	Capacity corev1.ResourceList `json:"capacity,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+
+// KwokMachineTemplate is the Schema for the kwokmachinetemplates API
+type KwokMachineTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KwokMachineTemplateSpec   `json:"spec,omitempty"`
+	Status KwokMachineTemplateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// KwokMachineTemplateList contains a list of KwokMachineTemplate
+type KwokMachineTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KwokMachineTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KwokMachineTemplate{}, &KwokMachineTemplateList{})
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	sharedv1beta1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1beta1"
+)
+
+// ConvertSimulationConfigTo converts a v1alpha1 SimulationConfig to the v1beta1 version.
+func ConvertSimulationConfigTo(src *SimulationConfig) *sharedv1beta1.SimulationConfig {
+	if src == nil {
+		return nil
+	}
+	dst := &sharedv1beta1.SimulationConfig{}
+	if src.Reconcile != nil {
+		dst.Reconcile = &sharedv1beta1.ReconcileSimulation{Latency: src.Reconcile.Latency}
+	}
+	return dst
+}
+
+// ConvertSimulationConfigFrom converts a v1beta1 SimulationConfig to the v1alpha1 version.
+func ConvertSimulationConfigFrom(src *sharedv1beta1.SimulationConfig) *SimulationConfig {
+	if src == nil {
+		return nil
+	}
+	dst := &SimulationConfig{}
+	if src.Reconcile != nil {
+		dst.Reconcile = &Reconcile{Latency: src.Reconcile.Latency}
+	}
+	return dst
+}
+
+// ConvertDurationTo converts a v1alpha1 duration, which is a raw time.Duration, to the v1beta1
+// version. The zero duration means unset.
+func ConvertDurationTo(src time.Duration) *metav1.Duration {
+	if src == 0 {
+		return nil
+	}
+	return &metav1.Duration{Duration: src}
+}
+
+// ConvertDurationFrom converts a v1beta1 duration to the v1alpha1 version.
+func ConvertDurationFrom(src *metav1.Duration) time.Duration {
+	if src == nil {
+		return 0
+	}
+	return src.Duration
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:object:generate=true
+
+// SimulationConfig holds the configuration options for simulating a real world provider.
+type SimulationConfig struct {
+	// Reconcile holds the configuration options for changing the behavior of the reconciliation loop.
+	// +optional
+	Reconcile *ReconcileSimulation `json:"reconcile,omitempty"`
+}
+
+// ReconcileSimulation holds the configuration options for simulating the reconciliation loop
+// of a real world provider.
+type ReconcileSimulation struct {
+	// Latency is the amount of time the reconciliation takes before reporting the resource
+	// ready, e.g. "30s".
+	// +optional
+	Latency metav1.Duration `json:"latency,omitempty"`
+}
+
+// ReconcileLatency returns the simulated latency of the reconciliation loop, which is zero
+// when none is configured.
+func (c *SimulationConfig) ReconcileLatency() time.Duration {
+	if c == nil || c.Reconcile == nil {
+		return 0
+	}
+	return c.Reconcile.Latency.Duration
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bootstrap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bootstrapv1 "github.com/capi-samples/cluster-api-provider-kwok/api/bootstrap/v1beta1"
+)
+
+func newTestScheme(g *WithT) *runtime.Scheme {
+	s := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(s)).To(Succeed())
+	g.Expect(bootstrapv1.AddToScheme(s)).To(Succeed())
+
+	return s
+}
+
+func newTestKwokConfig(namespace, clusterName string) *bootstrapv1.KwokConfig {
+	return &bootstrapv1.KwokConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-config",
+			Namespace: namespace,
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+		},
+	}
+}
+
+func TestKwokConfigReconcile(t *testing.T) {
+	testCases := []struct {
+		name        string
+		paused      bool
+		expectReady bool
+	}{
+		{
+			name:        "generates the bootstrap data",
+			expectReady: true,
+		},
+		{
+			name:   "does not reconcile paused clusters",
+			paused: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+				Spec:       clusterv1.ClusterSpec{Paused: tc.paused},
+			}
+			config := newTestKwokConfig("default", cluster.Name)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(cluster, config).
+				Build()
+
+			r := &KwokConfigReconciler{Client: fakeClient}
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(config)})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			latest := &bootstrapv1.KwokConfig{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(config), latest)).To(Succeed())
+			g.Expect(latest.Status.Ready).To(Equal(tc.expectReady))
+			if !tc.expectReady {
+				g.Expect(latest.Status.DataSecretName).To(BeNil())
+				return
+			}
+			g.Expect(latest.Status.DataSecretName).To(Equal(pointer.String(config.Name)))
+
+			secret := &corev1.Secret{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKey{Namespace: "default", Name: config.Name}, secret)).To(Succeed())
+			g.Expect(secret.Type).To(Equal(clusterv1.ClusterSecretType))
+			g.Expect(secret.Data).To(HaveKey("value"))
+			g.Expect(metav1.IsControlledBy(secret, latest)).To(BeTrue())
+		})
+	}
+}
+
+// createTestKwokConfig creates a KwokConfig of a Cluster in a namespace of its own.
+func createTestKwokConfig(ctx context.Context, paused bool) (*clusterv1.Cluster, *bootstrapv1.KwokConfig) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "kwok-"}}
+	Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: namespace.Name, Namespace: namespace.Name},
+		Spec:       clusterv1.ClusterSpec{Paused: paused},
+	}
+	Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+
+	config := newTestKwokConfig(namespace.Name, cluster.Name)
+	Expect(k8sClient.Create(ctx, config)).To(Succeed())
+
+	return cluster, config
+}
+
+// kwokConfigReady returns whether the KwokConfig is ready.
+func kwokConfigReady(ctx context.Context, config *bootstrapv1.KwokConfig) func(g Gomega) bool {
+	return func(g Gomega) bool {
+		latest := &bootstrapv1.KwokConfig{}
+		g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(config), latest)).To(Succeed())
+		return latest.Status.Ready
+	}
+}
+
+var _ = Describe("KwokConfig controller", func() {
+	const (
+		eventuallyTimeout    = 30 * time.Second
+		consistentlyDuration = 2 * time.Second
+	)
+
+	It("marks the KwokConfig ready with its bootstrap data", func(ctx SpecContext) {
+		_, config := createTestKwokConfig(ctx, false)
+
+		Eventually(kwokConfigReady(ctx, config), eventuallyTimeout).Should(BeTrue())
+
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(config), secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKey("value"))
+	})
+
+	It("does not reconcile paused clusters", func(ctx SpecContext) {
+		cluster, config := createTestKwokConfig(ctx, true)
+
+		Consistently(kwokConfigReady(ctx, config), consistentlyDuration).Should(BeFalse())
+
+		By("unpausing the cluster")
+		unpaused := cluster.DeepCopy()
+		unpaused.Spec.Paused = false
+		Expect(k8sClient.Patch(ctx, unpaused, client.MergeFrom(cluster))).To(Succeed())
+
+		Eventually(kwokConfigReady(ctx, config), eventuallyTimeout).Should(BeTrue())
+	})
+})
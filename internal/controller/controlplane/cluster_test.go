@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+// createTestKwokMachine creates a worker Machine of the cluster backed by a KwokMachine. The
+// bootstrap data and the owner reference the Machine controller would set are set right away.
+func createTestKwokMachine(ctx context.Context, c *testCluster) *infrav1.KwokMachine {
+	name := c.cluster.Name + "-worker"
+	labels := map[string]string{clusterv1.ClusterNameLabel: c.cluster.Name}
+
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: c.cluster.Namespace, Labels: labels},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: c.cluster.Name,
+			Version:     pointer.String("v1.27.1"),
+			Bootstrap:   clusterv1.Bootstrap{DataSecretName: pointer.String(name)},
+			InfrastructureRef: corev1.ObjectReference{
+				APIVersion: infrav1.GroupVersion.String(),
+				Kind:       "KwokMachine",
+				Name:       name,
+				Namespace:  c.cluster.Namespace,
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, machine)).To(Succeed())
+
+	kwokMachine := &infrav1.KwokMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: c.cluster.Namespace,
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Machine",
+					Name:       machine.Name,
+					UID:        machine.UID,
+				},
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, kwokMachine)).To(Succeed())
+
+	return kwokMachine
+}
+
+var _ = Describe("Cluster with KwokMachines", func() {
+	It("registers the Nodes of the KwokMachines and removes them before the cluster", func(ctx SpecContext) {
+		c := createTestCluster(ctx, false)
+		c.expectReady(ctx)
+
+		By("reporting the control plane ready, as the Cluster controller does")
+		cluster := &clusterv1.Cluster{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(c.cluster), cluster)).To(Succeed())
+		cluster.Status.InfrastructureReady = true
+		cluster.Status.ControlPlaneReady = true
+		conditions.MarkTrue(cluster, clusterv1.ControlPlaneInitializedCondition)
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+		By("registering the Node of a KwokMachine")
+		kwokMachine := createTestKwokMachine(ctx, c)
+		Eventually(func(g Gomega) {
+			latest := &infrav1.KwokMachine{}
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(kwokMachine), latest)).To(Succeed())
+			g.Expect(latest.Status.Ready).To(BeTrue())
+			g.Expect(latest.Spec.ProviderID).NotTo(BeNil())
+		}, eventuallyTimeout).Should(Succeed())
+		Expect(nodes.Has(kwokMachine.Name)).To(BeTrue())
+
+		By("deleting the Node with the KwokMachine while the cluster runs")
+		Expect(k8sClient.Delete(ctx, kwokMachine)).To(Succeed())
+		Eventually(func(g Gomega) {
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(kwokMachine), &infrav1.KwokMachine{})
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}, eventuallyTimeout).Should(Succeed())
+		Expect(nodes.Has(kwokMachine.Name)).To(BeFalse())
+		Expect(backend.HasCluster(c.workDir())).To(BeTrue())
+
+		By("deleting the cluster before removing the control plane")
+		Expect(k8sClient.Delete(ctx, c.controlPlane)).To(Succeed())
+		Eventually(func(g Gomega) {
+			_, err := c.getControlPlane(ctx)
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}, eventuallyTimeout).Should(Succeed())
+		Expect(backend.HasCluster(c.workDir())).To(BeFalse())
+	})
+})
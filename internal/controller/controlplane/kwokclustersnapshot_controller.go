@@ -0,0 +1,257 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/lock"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+const (
+	// SnapshotOperationType is the type of the operations saving snapshots.
+	SnapshotOperationType = "Snapshot"
+
+	// snapshotPollInterval is how often a snapshot waiting for its control plane, or being
+	// saved, is reconciled.
+	snapshotPollInterval = 10 * time.Second
+)
+
+// KwokClusterSnapshotReconciler reconciles a KwokClusterSnapshot object
+type KwokClusterSnapshotReconciler struct {
+	client.Client
+	Scheme           *runtime.Scheme
+	WatchFilterValue string
+
+	// Operations tracks the snapshots being saved in the background.
+	Operations *operation.Tracker
+
+	// Backend runs the clusters to snapshot.
+	Backend services.Backend
+}
+
+//+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kwokclustersnapshots,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kwokclustersnapshots/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kwokclustersnapshots/finalizers,verbs=update
+
+// Reconcile saves the etcd snapshot of the control plane referenced by a KwokClusterSnapshot,
+// and removes it when the KwokClusterSnapshot is deleted.
+func (r *KwokClusterSnapshotReconciler) Reconcile(ctx context.Context, req ctrl.Request) (res ctrl.Result, reterr error) {
+	logger := log.FromContext(ctx)
+
+	snapshot := &controlplanev1.KwokClusterSnapshot{}
+	if err := r.Get(ctx, req.NamespacedName, snapshot); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	patchHelper, err := patch.NewHelper(snapshot, r.Client)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+	defer func() {
+		if err := patchHelper.Patch(ctx, snapshot); err != nil {
+			reterr = err
+		}
+	}()
+
+	if !snapshot.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, snapshot)
+	}
+
+	if controllerutil.AddFinalizer(snapshot, controlplanev1.KwokClusterSnapshotFinalizer) {
+		return reconcile.Result{}, nil
+	}
+
+	switch snapshot.Status.Phase {
+	case controlplanev1.SnapshotPhaseCompleted, controlplanev1.SnapshotPhaseFailed:
+		return reconcile.Result{}, nil
+	case controlplanev1.SnapshotPhaseRunning:
+		if status, ok := r.Operations.Get(r.operationKey(snapshot)); ok {
+			return r.checkSnapshot(ctx, snapshot, status), nil
+		}
+		logger.Info("Snapshot was interrupted, saving it again")
+	}
+
+	cpScope, err := r.controlPlaneScope(ctx, snapshot)
+	if err != nil || cpScope == nil {
+		snapshot.Status.Phase = controlplanev1.SnapshotPhasePending
+		return reconcile.Result{RequeueAfter: snapshotPollInterval}, err
+	}
+
+	path := scope.SnapshotPath(cpScope.KwokCluster.Spec.WorkingDir, snapshot.Namespace, snapshot.Name)
+	r.Operations.Start(r.operationKey(snapshot), SnapshotOperationType, func(ctx context.Context) error {
+		return saveSnapshot(ctx, cpScope, path)
+	})
+
+	logger.Info("Saving snapshot", "cluster", cpScope.Name(), "path", path)
+	snapshot.Status.Phase = controlplanev1.SnapshotPhaseRunning
+	snapshot.Status.Path = path
+
+	return reconcile.Result{RequeueAfter: snapshotPollInterval}, nil
+}
+
+// controlPlaneScope returns the scope of the control plane to snapshot, or nil if it isn't
+// ready to be snapshotted yet.
+func (r *KwokClusterSnapshotReconciler) controlPlaneScope(ctx context.Context, snapshot *controlplanev1.KwokClusterSnapshot) (*scope.ControlPlaneScope, error) {
+	logger := log.FromContext(ctx)
+
+	controlPlane := &controlplanev1.KwokControlPlane{}
+	key := types.NamespacedName{Namespace: snapshot.Namespace, Name: snapshot.Spec.ControlPlaneName}
+	if err := r.Get(ctx, key, controlPlane); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("Waiting for KwokControlPlane to be created", "controlPlane", key)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !controlPlane.Status.Ready {
+		logger.Info("Waiting for KwokControlPlane to be ready", "controlPlane", key)
+		return nil, nil
+	}
+
+	cluster, err := util.GetOwnerCluster(ctx, r.Client, controlPlane.ObjectMeta)
+	if err != nil || cluster == nil {
+		return nil, err
+	}
+
+	kwokCluster := &infrav1.KwokCluster{}
+	kwokClusterRef := types.NamespacedName{
+		Name:      cluster.Spec.InfrastructureRef.Name,
+		Namespace: cluster.Spec.InfrastructureRef.Namespace,
+	}
+	if err := r.Get(ctx, kwokClusterRef, kwokCluster); err != nil {
+		return nil, fmt.Errorf("failed to get kwok cluster ref: %w", err)
+	}
+
+	return scope.NewControlPlaneScope(scope.ControlPlaneScopeParams{
+		Client:       r.Client,
+		Cluster:      cluster,
+		KwokCluster:  kwokCluster,
+		ControlPlane: controlPlane,
+		Operations:   r.Operations,
+		Backend:      r.Backend,
+		Logger:       &logger,
+	})
+}
+
+func (r *KwokClusterSnapshotReconciler) checkSnapshot(ctx context.Context, snapshot *controlplanev1.KwokClusterSnapshot, status operation.Status) reconcile.Result {
+	logger := log.FromContext(ctx)
+
+	if !status.Done() {
+		return reconcile.Result{RequeueAfter: snapshotPollInterval}
+	}
+	r.Operations.Forget(r.operationKey(snapshot))
+
+	if status.Err != nil {
+		logger.Error(status.Err, "Failed to save snapshot")
+		message := status.Err.Error()
+		snapshot.Status.Phase = controlplanev1.SnapshotPhaseFailed
+		snapshot.Status.FailureMessage = &message
+		record.Warnf(snapshot, "SnapshotFailed", "Failed to save snapshot of %q: %v", snapshot.Spec.ControlPlaneName, status.Err)
+		return reconcile.Result{}
+	}
+
+	logger.Info("Snapshot saved", "path", snapshot.Status.Path, "elapsed", status.CompletionTime.Sub(status.StartTime))
+	completionTime := metav1.NewTime(status.CompletionTime)
+	snapshot.Status.Phase = controlplanev1.SnapshotPhaseCompleted
+	snapshot.Status.CompletionTime = &completionTime
+	record.Eventf(snapshot, "SnapshotCompleted", "Saved snapshot of %q", snapshot.Spec.ControlPlaneName)
+
+	return reconcile.Result{}
+}
+
+func (r *KwokClusterSnapshotReconciler) reconcileDelete(ctx context.Context, snapshot *controlplanev1.KwokClusterSnapshot) (ctrl.Result, error) {
+	key := r.operationKey(snapshot)
+	if status, ok := r.Operations.Get(key); ok && !status.Done() {
+		r.Operations.Cancel(key)
+		return reconcile.Result{RequeueAfter: time.Second}, nil
+	}
+	r.Operations.Forget(key)
+
+	if path := snapshot.Status.Path; path != "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return reconcile.Result{}, fmt.Errorf("removing snapshot: %w", err)
+		}
+		log.FromContext(ctx).Info("Removed snapshot", "path", path)
+	}
+
+	controllerutil.RemoveFinalizer(snapshot, controlplanev1.KwokClusterSnapshotFinalizer)
+	return reconcile.Result{}, nil
+}
+
+func (r *KwokClusterSnapshotReconciler) operationKey(snapshot *controlplanev1.KwokClusterSnapshot) string {
+	return "snapshot/" + client.ObjectKeyFromObject(snapshot).String()
+}
+
+// saveSnapshot saves the etcd snapshot of the cluster at path, holding the cluster lock.
+func saveSnapshot(ctx context.Context, cpScope *scope.ControlPlaneScope, path string) error {
+	l := lock.New(cpScope.LockPath())
+	if err := l.Lock(ctx); err != nil {
+		return fmt.Errorf("acquiring cluster lock: %w", err)
+	}
+	defer func() {
+		_ = l.Unlock()
+	}()
+
+	rt, err := cpScope.Backend.Load(ctx, cpScope.Name(), cpScope.WorkDir())
+	if err != nil {
+		return fmt.Errorf("loading cluster %q: %w", cpScope.Name(), err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("creating snapshot dir: %w", err)
+	}
+
+	return rt.SnapshotSave(ctx, path)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KwokClusterSnapshotReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&controlplanev1.KwokClusterSnapshot{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(log.FromContext(ctx), r.WatchFilterValue)).
+		Complete(r)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/kwokctl"
+)
+
+func newSnapshotReconciler(g *WithT, objs ...client.Object) *KwokClusterSnapshotReconciler {
+	s := runtime.NewScheme()
+	g.Expect(controlplanev1.AddToScheme(s)).To(Succeed())
+
+	return &KwokClusterSnapshotReconciler{
+		Client:     fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+		Scheme:     s,
+		Operations: operation.NewTracker(context.Background(), operation.Options{}),
+		Backend:    kwokctl.New(),
+	}
+}
+
+func TestKwokClusterSnapshotWaitsForControlPlane(t *testing.T) {
+	g := NewWithT(t)
+
+	snapshot := &controlplanev1.KwokClusterSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "golden"},
+		Spec:       controlplanev1.KwokClusterSnapshotSpec{ControlPlaneName: "test-control-plane"},
+	}
+	r := newSnapshotReconciler(g, snapshot)
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(snapshot)}
+
+	_, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Get(context.Background(), req.NamespacedName, snapshot)).To(Succeed())
+	g.Expect(snapshot.Finalizers).To(ContainElement(controlplanev1.KwokClusterSnapshotFinalizer))
+
+	res, err := r.Reconcile(context.Background(), req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(snapshotPollInterval))
+	g.Expect(r.Get(context.Background(), req.NamespacedName, snapshot)).To(Succeed())
+	g.Expect(snapshot.Status.Phase).To(Equal(controlplanev1.SnapshotPhasePending))
+}
+
+func TestKwokClusterSnapshotDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "golden.db")
+	g.Expect(os.WriteFile(path, []byte("snapshot"), 0o600)).To(Succeed())
+
+	now := metav1.Now()
+	snapshot := &controlplanev1.KwokClusterSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "golden",
+			Finalizers:        []string{controlplanev1.KwokClusterSnapshotFinalizer},
+			DeletionTimestamp: &now,
+		},
+		Spec: controlplanev1.KwokClusterSnapshotSpec{ControlPlaneName: "test-control-plane"},
+		Status: controlplanev1.KwokClusterSnapshotStatus{
+			Phase: controlplanev1.SnapshotPhaseCompleted,
+			Path:  path,
+		},
+	}
+	r := newSnapshotReconciler(g, snapshot)
+
+	_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(snapshot)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(path).NotTo(BeAnExistingFile())
+}
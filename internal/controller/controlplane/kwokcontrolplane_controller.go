@@ -25,8 +25,10 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -37,11 +39,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1alpha1"
-	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1alpha1"
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
 	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
 	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
 	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/kwok/cluster"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/kwok/machines"
 	"github.com/go-logr/logr"
 )
 
@@ -50,6 +54,12 @@ type KwokControlPlaneReconciler struct {
 	client.Client
 	Scheme           *runtime.Scheme
 	WatchFilterValue string
+
+	// Operations tracks the long-running runtime operations run in the background.
+	Operations *operation.Tracker
+
+	// Backend runs the clusters of the control planes.
+	Backend services.Backend
 }
 
 //+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kwokcontrolplanes,verbs=get;list;watch;create;update;patch;delete
@@ -58,6 +68,12 @@ type KwokControlPlaneReconciler struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokclusters,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokclusters/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachinetemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachines,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -110,6 +126,8 @@ func (r *KwokControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Req
 		Cluster:        cluster,
 		KwokCluster:    kwokCluster,
 		ControlPlane:   kwokControlPlane,
+		Operations:     r.Operations,
+		Backend:        r.Backend,
 		ControllerName: strings.ToLower(kwokControlPlane.Kind),
 		Logger:         &logger,
 	})
@@ -118,7 +136,15 @@ func (r *KwokControlPlaneReconciler) Reconcile(ctx context.Context, req ctrl.Req
 	}
 
 	defer func() {
-		//TODO: update conditions if needed
+		conditions.SetSummary(cpScope.ControlPlane,
+			conditions.WithConditions(
+				controlplanev1.ClusterAvailableCondition,
+				controlplanev1.ComponentsHealthyCondition,
+				controlplanev1.MachinesReadyCondition,
+				controlplanev1.MachinesSpecUpToDateCondition,
+			),
+		)
+
 		if err := cpScope.Close(); err != nil {
 			reterr = err
 		}
@@ -145,8 +171,12 @@ func (r *KwokControlPlaneReconciler) reconcileNormal(ctx context.Context, cpScop
 
 	reconcilers := []services.ReconcilerWithResult{
 		cluster.NewService(cpScope),
+		machines.NewService(cpScope),
 	}
 
+	// The cluster keeps being probed once healthy, so every reconciler runs and the earliest
+	// requeue wins.
+	result := reconcile.Result{}
 	for _, r := range reconcilers {
 		res, err := r.Reconcile(ctx)
 		if err != nil {
@@ -154,18 +184,18 @@ func (r *KwokControlPlaneReconciler) reconcileNormal(ctx context.Context, cpScop
 			//record.Warnf(clusterScope.GCPCluster, "GCPClusterReconcile", "Reconcile error - %v", err)
 			return ctrl.Result{}, err
 		}
-		if res.Requeue || res.RequeueAfter > 0 {
-			return res, nil
-		}
+		result = util.LowestNonZeroResult(result, res)
 	}
 
-	return reconcile.Result{}, nil
+	return result, nil
 }
 
 func (r *KwokControlPlaneReconciler) reconcileDelete(ctx context.Context, cpScope *scope.ControlPlaneScope) (res ctrl.Result, reterr error) {
 	cpScope.Logger.Info("Reconciling KwokControlPlane delete")
 
+	// The Machines go first, so their Nodes are removed while the cluster still runs.
 	reconcilers := []services.ReconcilerWithResult{
+		machines.NewService(cpScope),
 		cluster.NewService(cpScope),
 	}
 
@@ -181,6 +211,12 @@ func (r *KwokControlPlaneReconciler) reconcileDelete(ctx context.Context, cpScop
 		}
 	}
 
+	// Keep the finalizer when the cluster could not be deleted, so the failure stays visible.
+	if reason := cpScope.ControlPlane.Status.FailureReason; reason != nil && *reason == capierrors.DeleteClusterError {
+		cpScope.Logger.Info("Cluster failed to be deleted, keeping finalizer", "reason", *reason)
+		return reconcile.Result{}, nil
+	}
+
 	controllerutil.RemoveFinalizer(cpScope.ControlPlane, controlplanev1.KwokControlPlaneFinalizer)
 
 	return reconcile.Result{}, nil
@@ -193,6 +229,7 @@ func (r *KwokControlPlaneReconciler) SetupWithManager(ctx context.Context, mgr c
 	controlPlane := &controlplanev1.KwokControlPlane{}
 	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(controlPlane).
+		Owns(&clusterv1.Machine{}).
 		WithOptions(options).
 		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(logger, r.WatchFilterValue)).
 		Build(r)
@@ -243,7 +280,7 @@ func (r *KwokControlPlaneReconciler) kwokClusterToKwokControlPlane(ctx context.C
 		}
 
 		controlPlaneRef := cluster.Spec.ControlPlaneRef
-		if controlPlaneRef == nil || controlPlaneRef.Kind != "KwokControlPlane" {
+		if controlPlaneRef == nil || controlPlaneRef.Kind != controlplanev1.KwokControlPlaneKind {
 			logger.V(2).Info("ControlPlaneRef is nil or not KwokControlPlane, skipping mapping")
 			return nil
 		}
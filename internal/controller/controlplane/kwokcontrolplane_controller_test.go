@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controlplane
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+)
+
+const (
+	eventuallyTimeout    = 30 * time.Second
+	consistentlyDuration = 2 * time.Second
+)
+
+// testCluster is a Cluster with its KwokCluster and KwokControlPlane, in its own namespace.
+type testCluster struct {
+	cluster      *clusterv1.Cluster
+	kwokCluster  *infrav1.KwokCluster
+	controlPlane *controlplanev1.KwokControlPlane
+}
+
+// createTestCluster creates a Cluster using a KwokCluster and a KwokControlPlane. The owner
+// references the Cluster controller would set are set right away.
+func createTestCluster(ctx context.Context, paused bool) *testCluster {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "kwok-"}}
+	Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+	name := namespace.Name
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name},
+		Spec: clusterv1.ClusterSpec{
+			Paused: paused,
+			InfrastructureRef: &corev1.ObjectReference{
+				APIVersion: infrav1.GroupVersion.String(),
+				Kind:       "KwokCluster",
+				Name:       name,
+				Namespace:  name,
+			},
+			ControlPlaneRef: &corev1.ObjectReference{
+				APIVersion: controlplanev1.GroupVersion.String(),
+				Kind:       controlplanev1.KwokControlPlaneKind,
+				Name:       name,
+				Namespace:  name,
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+
+	ownerRef := metav1.OwnerReference{
+		APIVersion: clusterv1.GroupVersion.String(),
+		Kind:       "Cluster",
+		Name:       cluster.Name,
+		UID:        cluster.UID,
+	}
+
+	kwokCluster := &infrav1.KwokCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name, OwnerReferences: []metav1.OwnerReference{ownerRef}},
+		Spec: infrav1.KwokClusterSpec{
+			Runtime:    testRuntime,
+			WorkingDir: GinkgoT().TempDir(),
+		},
+	}
+	Expect(k8sClient.Create(ctx, kwokCluster)).To(Succeed())
+
+	controlPlane := &controlplanev1.KwokControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name, OwnerReferences: []metav1.OwnerReference{ownerRef}},
+	}
+	Expect(k8sClient.Create(ctx, controlPlane)).To(Succeed())
+
+	return &testCluster{cluster: cluster, kwokCluster: kwokCluster, controlPlane: controlPlane}
+}
+
+func (c *testCluster) workDir() string {
+	return scope.ClusterWorkDir(c.kwokCluster.Spec.WorkingDir, c.cluster.Name)
+}
+
+// getControlPlane returns the latest version of the KwokControlPlane.
+func (c *testCluster) getControlPlane(ctx context.Context) (*controlplanev1.KwokControlPlane, error) {
+	controlPlane := &controlplanev1.KwokControlPlane{}
+	err := k8sClient.Get(ctx, client.ObjectKeyFromObject(c.controlPlane), controlPlane)
+	return controlPlane, err
+}
+
+// expectReady waits for the control plane and the infrastructure of the cluster to be ready.
+func (c *testCluster) expectReady(ctx context.Context) {
+	Eventually(func(g Gomega) {
+		controlPlane, err := c.getControlPlane(ctx)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(controlPlane.Status.Ready).To(BeTrue())
+		g.Expect(controlPlane.Status.Initialized).To(BeTrue())
+		g.Expect(controlPlane.Spec.ControlPlaneEndpoint.IsValid()).To(BeTrue())
+
+		kwokCluster := &infrav1.KwokCluster{}
+		g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(c.kwokCluster), kwokCluster)).To(Succeed())
+		g.Expect(kwokCluster.Status.Ready).To(BeTrue())
+		g.Expect(kwokCluster.Spec.ControlPlaneEndpoint).To(Equal(controlPlane.Spec.ControlPlaneEndpoint))
+	}, eventuallyTimeout).Should(Succeed())
+}
+
+var _ = Describe("KwokControlPlane controller", func() {
+	It("creates the cluster and makes it ready", func(ctx SpecContext) {
+		c := createTestCluster(ctx, false)
+
+		c.expectReady(ctx)
+		Expect(backend.HasCluster(c.workDir())).To(BeTrue())
+		Expect(backend.Calls()).To(ContainElement(c.cluster.Name + ".Create"))
+
+		_, err := secret.GetFromNamespacedName(ctx, k8sClient, client.ObjectKeyFromObject(c.cluster), secret.Kubeconfig)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("does not reconcile paused clusters", func(ctx SpecContext) {
+		c := createTestCluster(ctx, true)
+
+		Consistently(func(g Gomega) {
+			controlPlane, err := c.getControlPlane(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(controllerutil.ContainsFinalizer(controlPlane, controlplanev1.KwokControlPlaneFinalizer)).To(BeFalse())
+			g.Expect(backend.HasCluster(c.workDir())).To(BeFalse())
+		}, consistentlyDuration).Should(Succeed())
+
+		By("unpausing the cluster")
+		cluster := c.cluster.DeepCopy()
+		cluster.Spec.Paused = false
+		Expect(k8sClient.Patch(ctx, cluster, client.MergeFrom(c.cluster))).To(Succeed())
+		// The control plane is reconciled again once the infrastructure is ready, which is
+		// reported by the Cluster controller.
+		cluster.Status.InfrastructureReady = true
+		Expect(k8sClient.Status().Update(ctx, cluster)).To(Succeed())
+
+		c.expectReady(ctx)
+	})
+
+	It("deletes the cluster before removing the control plane", func(ctx SpecContext) {
+		c := createTestCluster(ctx, false)
+		c.expectReady(ctx)
+
+		backend.FailOn("Delete", errors.New("injected failure"))
+		DeferCleanup(backend.FailOn, "Delete", nil)
+
+		Expect(k8sClient.Delete(ctx, c.controlPlane)).To(Succeed())
+
+		By("keeping the control plane while the cluster can't be deleted")
+		Consistently(func(g Gomega) {
+			controlPlane, err := c.getControlPlane(ctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(controlPlane.DeletionTimestamp.IsZero()).To(BeFalse())
+			g.Expect(backend.HasCluster(c.workDir())).To(BeTrue())
+		}, consistentlyDuration).Should(Succeed())
+
+		By("removing the control plane once the cluster is deleted")
+		backend.FailOn("Delete", nil)
+		Eventually(func(g Gomega) {
+			_, err := c.getControlPlane(ctx)
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}, eventuallyTimeout).Should(Succeed())
+		Expect(backend.HasCluster(c.workDir())).To(BeFalse())
+	})
+})
@@ -17,29 +17,53 @@ limitations under the License.
 package controlplane
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/rest"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
-	controlplanev1alpha1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1alpha1"
+	bootstrapcontroller "github.com/capi-samples/cluster-api-provider-kwok/internal/controller/bootstrap"
+	infracontroller "github.com/capi-samples/cluster-api-provider-kwok/internal/controller/infrastructure"
+	"github.com/capi-samples/cluster-api-provider-kwok/internal/test/testenv"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
 	//+kubebuilder:scaffold:imports
 )
 
 // These tests use Ginkgo (BDD-style Go testing framework). Refer to
 // http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
 
-var cfg *rest.Config
-var k8sClient client.Client
-var testEnv *envtest.Environment
+// testRuntime is the runtime of the clusters created by the suite, served by the fake backend.
+const testRuntime = "docker"
+
+var (
+	testEnv   *envtest.Environment
+	k8sClient client.Client
+	backend   *fakebackend.Backend
+	nodes     = &testNodes{nodes: map[string]*corev1.Node{}}
+	cancel    context.CancelFunc
+)
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -48,33 +72,166 @@ func TestAPIs(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
+	if reason := testenv.SkipReason(); reason != "" {
+		Skip(reason)
+	}
+
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
 	By("bootstrapping test environment")
-	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "..", "config", "crd", "bases")},
-		ErrorIfCRDPathMissing: true,
-	}
-
 	var err error
-	// cfg is defined in this file globally.
-	cfg, err = testEnv.Start()
+	testEnv, err = testenv.New(filepath.Join("..", "..", ".."))
 	Expect(err).NotTo(HaveOccurred())
-	Expect(cfg).NotTo(BeNil())
 
-	err = controlplanev1alpha1.AddToScheme(scheme.Scheme)
+	cfg, err := testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
+	Expect(cfg).NotTo(BeNil())
 
 	//+kubebuilder:scaffold:scheme
 
-	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	k8sClient, err = client.New(cfg, client.Options{Scheme: testEnv.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("starting the controllers with a fake backend")
+	backend = fakebackend.NewBackend(testRuntime)
+	backend.SetAPIServerPort(startTestAPIServer())
+
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme:             testEnv.Scheme,
+		MetricsBindAddress: "0",
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+
+	operations := operation.NewTracker(ctx, operation.Options{
+		Retry: operation.RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second},
+	})
+	options := controller.Options{MaxConcurrentReconciles: 1}
+
+	Expect((&infracontroller.KwokClusterReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Backend: backend,
+	}).SetupWithManager(ctx, mgr, options)).To(Succeed())
+	Expect((&infracontroller.KwokMachineReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(ctx, mgr, options)).To(Succeed())
+	Expect((&KwokControlPlaneReconciler{
+		Client:     mgr.GetClient(),
+		Scheme:     mgr.GetScheme(),
+		Operations: operations,
+		Backend:    backend,
+	}).SetupWithManager(ctx, mgr, options)).To(Succeed())
+	Expect((&bootstrapcontroller.KwokConfigReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(ctx, mgr, options)).To(Succeed())
+
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
 })
 
 var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
+
 	By("tearing down the test environment")
+	cancel()
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+// startTestAPIServer serves the health endpoints probed on the API server of the clusters and
+// the Nodes registered in them, and returns its port.
+func startTestAPIServer() uint32 {
+	mux := http.NewServeMux()
+	for _, path := range []string{"/readyz", "/readyz/etcd"} {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		})
+	}
+	mux.Handle("/api/v1/nodes", nodes)
+	mux.Handle("/api/v1/nodes/", nodes)
+	server := httptest.NewServer(mux)
+	DeferCleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	Expect(err).NotTo(HaveOccurred())
+	port, err := strconv.ParseUint(u.Port(), 10, 32)
+	Expect(err).NotTo(HaveOccurred())
+
+	return uint32(port)
+}
+
+// testNodes serves the Nodes of the API server of the clusters. The clusters of the suite share
+// the API server, and the names of their Nodes are unique.
+type testNodes struct {
+	mu    sync.Mutex
+	nodes map[string]*corev1.Node
+}
+
+// Has returns whether the named Node is registered.
+func (n *testNodes) Has(name string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	_, ok := n.nodes[name]
+	return ok
+}
+
+func (n *testNodes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api/v1/nodes"), "/")
+	var obj runtime.Object
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		list := &corev1.NodeList{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NodeList"}}
+		for _, node := range n.nodes {
+			list.Items = append(list.Items, *node)
+		}
+		obj = list
+	case name == "" && r.Method == http.MethodPost:
+		node := &corev1.Node{}
+		if err := json.NewDecoder(r.Body).Decode(node); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, ok := n.nodes[node.Name]; ok {
+			obj = &apierrors.NewAlreadyExists(corev1.Resource("nodes"), node.Name).ErrStatus
+			break
+		}
+		n.nodes[node.Name] = node
+		obj = node
+	case n.nodes[name] == nil:
+		obj = &apierrors.NewNotFound(corev1.Resource("nodes"), name).ErrStatus
+	case r.Method == http.MethodGet:
+		obj = n.nodes[name]
+	case r.Method == http.MethodDelete:
+		delete(n.nodes, name)
+		obj = &metav1.Status{Status: metav1.StatusSuccess}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if status, ok := obj.(*metav1.Status); ok {
+		status.Kind, status.APIVersion = "Status", "v1"
+		if status.Code != 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(int(status.Code))
+			_ = json.NewEncoder(w).Encode(status)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(obj)
+}
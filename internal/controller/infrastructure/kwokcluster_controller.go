@@ -21,10 +21,12 @@ import (
 	"fmt"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
 	"sigs.k8s.io/cluster-api/util/patch"
@@ -32,12 +34,15 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	kruntime "sigs.k8s.io/kwok/pkg/kwokctl/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1alpha1"
-	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1alpha1"
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 )
@@ -47,6 +52,9 @@ type KwokClusterReconciler struct {
 	client.Client
 	Scheme           *runtime.Scheme
 	WatchFilterValue string
+
+	// Backend runs the clusters, it validates the runtime of the KwokClusters.
+	Backend services.Backend
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokclusters,verbs=get;list;watch;create;update;patch;delete
@@ -81,8 +89,9 @@ func (r *KwokClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	var timerCh <-chan time.Time
-	if kwokCluster.Spec.SimulationConfig != nil && kwokCluster.Spec.SimulationConfig.Reconcile.Latency.Duration != 0 {
-		timerCh = time.After(kwokCluster.Spec.SimulationConfig.Reconcile.Latency.Duration)
+	latency := kwokCluster.Spec.SimulationConfig.ReconcileLatency()
+	if latency != 0 {
+		timerCh = time.After(latency)
 	}
 
 	if annotations.IsPaused(cluster, kwokCluster) {
@@ -92,18 +101,6 @@ func (r *KwokClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	log = log.WithValues("cluster", cluster.Name)
 
-	controlPlane := &controlplanev1.KwokControlPlane{}
-	controlPlaneRef := types.NamespacedName{
-		Name:      cluster.Spec.ControlPlaneRef.Name,
-		Namespace: cluster.Spec.ControlPlaneRef.Namespace,
-	}
-
-	if err := r.Get(ctx, controlPlaneRef, controlPlane); err != nil {
-		return reconcile.Result{}, fmt.Errorf("failed to get control plane ref: %w", err)
-	}
-
-	log = log.WithValues("controlPlane", controlPlaneRef.Name)
-
 	patchHelper, err := patch.NewHelper(kwokCluster, r.Client)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
@@ -117,20 +114,25 @@ func (r *KwokClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	log = log.WithValues("runtime", runtime)
 
-	_, ok := kruntime.DefaultRegistry.Get(runtime)
-	if !ok {
+	if !r.Backend.Supports(runtime) {
 		return reconcile.Result{}, fmt.Errorf("runtime %q not found", runtime)
 	}
 
-	// Set the values from the managed control plane
-	kwokCluster.Status.Ready = true
-	kwokCluster.Spec.ControlPlaneEndpoint = controlPlane.Spec.ControlPlaneEndpoint
+	if err := r.reconcileControlPlaneEndpoint(ctx, cluster, kwokCluster); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// The Cluster reads the endpoint once the KwokCluster is ready, it must be set by then.
+	kwokCluster.Status.Ready = kwokCluster.Spec.ControlPlaneEndpoint.IsValid()
+	if !kwokCluster.Status.Ready {
+		log.Info("Waiting for the control plane endpoint")
+	}
 
 	if err := patchHelper.Patch(ctx, kwokCluster); err != nil {
 		return reconcile.Result{}, fmt.Errorf("failed to patch KwokCluster: %w", err)
 	}
 
-	if kwokCluster.Spec.SimulationConfig != nil && kwokCluster.Spec.SimulationConfig.Reconcile.Latency.Duration != 0 {
+	if latency != 0 {
 		<-timerCh
 	}
 
@@ -139,39 +141,114 @@ func (r *KwokClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return reconcile.Result{}, nil
 }
 
+// reconcileControlPlaneEndpoint sets the control plane endpoint of the KwokCluster. When the Cluster
+// uses a KwokControlPlane the endpoint is copied from it. Any other control plane provider (or no
+// control plane provider at all) owns its own endpoint, so the endpoint set on the KwokCluster spec
+// is left untouched and used as a generic external endpoint.
+func (r *KwokClusterReconciler) reconcileControlPlaneEndpoint(ctx context.Context, cluster *clusterv1.Cluster, kwokCluster *infrav1.KwokCluster) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	controlPlaneRef := cluster.Spec.ControlPlaneRef
+	if !isKwokControlPlane(controlPlaneRef) {
+		log.V(2).Info("Control plane is not a KwokControlPlane, using the endpoint from the KwokCluster", "endpoint", kwokCluster.Spec.ControlPlaneEndpoint)
+		return nil
+	}
+
+	controlPlane := &controlplanev1.KwokControlPlane{}
+	controlPlaneKey := types.NamespacedName{
+		Name:      controlPlaneRef.Name,
+		Namespace: controlPlaneRef.Namespace,
+	}
+	if controlPlaneKey.Namespace == "" {
+		controlPlaneKey.Namespace = cluster.Namespace
+	}
+
+	if err := r.Get(ctx, controlPlaneKey, controlPlane); err != nil {
+		return fmt.Errorf("failed to get control plane ref: %w", err)
+	}
+
+	log.V(2).Info("Using the endpoint from the KwokControlPlane", "controlPlane", controlPlaneKey.Name)
+	kwokCluster.Spec.ControlPlaneEndpoint = controlPlane.Spec.ControlPlaneEndpoint
+
+	return nil
+}
+
+// isKwokControlPlane returns true if the reference points to a KwokControlPlane.
+func isKwokControlPlane(ref *corev1.ObjectReference) bool {
+	if ref == nil {
+		return false
+	}
+
+	return ref.Kind == controlplanev1.KwokControlPlaneKind && ref.GroupVersionKind().Group == controlplanev1.GroupVersion.Group
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *KwokClusterReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
-	//log := ctrl.LoggerFrom(ctx)
+	log := ctrl.LoggerFrom(ctx)
 
 	kwokCluster := &infrav1.KwokCluster{}
 
-	_, err := ctrl.NewControllerManagedBy(mgr).
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(kwokCluster).
-		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(ctrl.LoggerFrom(ctx), r.WatchFilterValue)).Build(r)
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(log, r.WatchFilterValue)).Build(r)
 	if err != nil {
 		return fmt.Errorf("error creating controller: %w", err)
 	}
 
-	// Add a watch for clusterv1.Cluster unpaise
-	// if err = controller.Watch(
-	// 	&source.Kind{Type: &clusterv1.Cluster{}},
-	// 	handler.EnqueueRequestsFromMapFunc(util.ClusterToInfrastructureMapFunc(ctx, infrav1.GroupVersion.WithKind("KwokCluster"), mgr.GetClient(), &infrav1.KwokCluster{})),
-	// 	predicates.ClusterUnpaused(log),
-	// ); err != nil {
-	// 	return fmt.Errorf("failed adding a watch for ready clusters: %w", err)
-	// }
+	// Add a watch for clusterv1.Cluster unpause
+	if err = c.Watch(
+		&source.Kind{Type: &clusterv1.Cluster{}},
+		handler.EnqueueRequestsFromMapFunc(util.ClusterToInfrastructureMapFunc(ctx, infrav1.GroupVersion.WithKind("KwokCluster"), mgr.GetClient(), &infrav1.KwokCluster{})),
+		predicates.ClusterUnpaused(log),
+	); err != nil {
+		return fmt.Errorf("failed adding a watch for ready clusters: %w", err)
+	}
 
 	// Add a watch for KwokControlPlane
-	// if err = controller.Watch(
-	// 	&source.Kind{Type: &controlplanev1.KwokControlPlane{}},
-	// 	handler.EnqueueRequestsFromMapFunc(r.kwokControlPlaneToKwokCluster(ctx, &log)),
-	// ); err != nil {
-	// 	return fmt.Errorf("failed adding watch on KwokControlPlane: %w", err)
-	// }
+	if err = c.Watch(
+		&source.Kind{Type: &controlplanev1.KwokControlPlane{}},
+		handler.EnqueueRequestsFromMapFunc(r.kwokControlPlaneToKwokCluster(ctx, &log)),
+		kwokControlPlaneEndpointChanged(log),
+	); err != nil {
+		return fmt.Errorf("failed adding watch on KwokControlPlane: %w", err)
+	}
 
 	return nil
 }
 
+// kwokControlPlaneEndpointChanged returns a predicate that only lets through KwokControlPlane
+// events where the control plane endpoint has been set or has changed.
+func kwokControlPlaneEndpointChanged(log logr.Logger) predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			controlPlane, ok := e.Object.(*controlplanev1.KwokControlPlane)
+			if !ok {
+				log.V(4).Info("Expected KwokControlPlane", "type", fmt.Sprintf("%T", e.Object))
+				return false
+			}
+
+			return !controlPlane.Spec.ControlPlaneEndpoint.IsZero()
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldControlPlane, ok := e.ObjectOld.(*controlplanev1.KwokControlPlane)
+			if !ok {
+				log.V(4).Info("Expected KwokControlPlane", "type", fmt.Sprintf("%T", e.ObjectOld))
+				return false
+			}
+			newControlPlane, ok := e.ObjectNew.(*controlplanev1.KwokControlPlane)
+			if !ok {
+				log.V(4).Info("Expected KwokControlPlane", "type", fmt.Sprintf("%T", e.ObjectNew))
+				return false
+			}
+
+			return oldControlPlane.Spec.ControlPlaneEndpoint != newControlPlane.Spec.ControlPlaneEndpoint
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
+
 func (r *KwokClusterReconciler) kwokControlPlaneToKwokCluster(ctx context.Context, log *logr.Logger) handler.MapFunc {
 	return func(o client.Object) []ctrl.Request {
 		kwokControlPlane, ok := o.(*controlplanev1.KwokControlPlane)
@@ -203,16 +280,21 @@ func (r *KwokClusterReconciler) kwokControlPlaneToKwokCluster(ctx context.Contex
 		}
 
 		kwokClusterRef := cluster.Spec.InfrastructureRef
-		if kwokClusterRef == nil {
-			log.Info("InfrastructureRef is nil, skipping mapping")
+		if kwokClusterRef == nil || kwokClusterRef.Kind != "KwokCluster" {
+			log.Info("InfrastructureRef is nil or not KwokCluster, skipping mapping")
 			return nil
 		}
 
+		namespace := kwokClusterRef.Namespace
+		if namespace == "" {
+			namespace = cluster.Namespace
+		}
+
 		return []ctrl.Request{
 			{
 				NamespacedName: types.NamespacedName{
 					Name:      kwokClusterRef.Name,
-					Namespace: kwokClusterRef.Namespace,
+					Namespace: namespace,
 				},
 			},
 		}
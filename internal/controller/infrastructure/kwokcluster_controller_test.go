@@ -0,0 +1,406 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+func newTestScheme(g *WithT) *runtime.Scheme {
+	s := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(s)).To(Succeed())
+	g.Expect(expv1.AddToScheme(s)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(s)).To(Succeed())
+	g.Expect(controlplanev1.AddToScheme(s)).To(Succeed())
+
+	return s
+}
+
+func newTestCluster(name string) *clusterv1.Cluster {
+	return &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{
+				APIVersion: infrav1.GroupVersion.String(),
+				Kind:       "KwokCluster",
+				Name:       name,
+			},
+			ControlPlaneRef: &corev1.ObjectReference{
+				APIVersion: controlplanev1.GroupVersion.String(),
+				Kind:       controlplanev1.KwokControlPlaneKind,
+				Name:       name + "-control-plane",
+			},
+		},
+	}
+}
+
+func newTestKwokControlPlane(clusterName string, endpoint clusterv1.APIEndpoint) *controlplanev1.KwokControlPlane {
+	return &controlplanev1.KwokControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-control-plane",
+			Namespace: "default",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       clusterName,
+				},
+			},
+		},
+		Spec: controlplanev1.KwokControlPlaneSpec{
+			ControlPlaneEndpoint: endpoint,
+		},
+	}
+}
+
+// newTestReadyCluster returns an initialized Cluster and its ready KwokControlPlane.
+func newTestReadyCluster(name string) (*clusterv1.Cluster, *controlplanev1.KwokControlPlane) {
+	cluster := newTestCluster(name)
+	cluster.Status.ControlPlaneReady = true
+	conditions.MarkTrue(cluster, clusterv1.ControlPlaneInitializedCondition)
+
+	controlPlane := newTestKwokControlPlane(name, clusterv1.APIEndpoint{Host: "127.0.0.1", Port: 6443})
+	controlPlane.Status.Ready = true
+
+	return cluster, controlPlane
+}
+
+func TestKwokClusterReconcileReady(t *testing.T) {
+	endpoint := clusterv1.APIEndpoint{Host: "127.0.0.1", Port: 6443}
+
+	testCases := []struct {
+		name                 string
+		kwokControlPlane     bool
+		controlPlaneEndpoint clusterv1.APIEndpoint
+		clusterEndpoint      clusterv1.APIEndpoint
+		expectReady          bool
+	}{
+		{
+			name:                 "ready with the endpoint of the KwokControlPlane",
+			kwokControlPlane:     true,
+			controlPlaneEndpoint: endpoint,
+			expectReady:          true,
+		},
+		{
+			name:             "waits for the endpoint of the KwokControlPlane",
+			kwokControlPlane: true,
+		},
+		{
+			name:            "ready with the endpoint set by the user",
+			clusterEndpoint: endpoint,
+			expectReady:     true,
+		},
+		{
+			name: "waits for the endpoint of another control plane",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster := newTestCluster("test")
+			if !tc.kwokControlPlane {
+				cluster.Spec.ControlPlaneRef = &corev1.ObjectReference{
+					APIVersion: "controlplane.cluster.x-k8s.io/v1beta1",
+					Kind:       "KubeadmControlPlane",
+					Name:       "test-control-plane",
+				}
+			}
+			kwokCluster := &infrav1.KwokCluster{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test",
+					Namespace: "default",
+					OwnerReferences: []metav1.OwnerReference{
+						{
+							APIVersion: clusterv1.GroupVersion.String(),
+							Kind:       "Cluster",
+							Name:       cluster.Name,
+						},
+					},
+				},
+				Spec: infrav1.KwokClusterSpec{
+					Runtime:              "docker",
+					ControlPlaneEndpoint: tc.clusterEndpoint,
+				},
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(cluster, kwokCluster, newTestKwokControlPlane("test", tc.controlPlaneEndpoint)).
+				Build()
+
+			r := &KwokClusterReconciler{
+				Client:  fakeClient,
+				Backend: fakebackend.NewBackend("docker"),
+			}
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokCluster)})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			latest := &infrav1.KwokCluster{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokCluster), latest)).To(Succeed())
+			g.Expect(latest.Status.Ready).To(Equal(tc.expectReady))
+		})
+	}
+}
+
+func TestKwokControlPlaneToKwokCluster(t *testing.T) {
+	endpoint := clusterv1.APIEndpoint{Host: "127.0.0.1", Port: 32766}
+
+	externalCluster := newTestCluster("external")
+	externalCluster.Spec.InfrastructureRef.Kind = "DockerCluster"
+
+	deletedControlPlane := newTestKwokControlPlane("test", endpoint)
+	now := metav1.Now()
+	deletedControlPlane.DeletionTimestamp = &now
+
+	testCases := []struct {
+		name     string
+		object   client.Object
+		expected []ctrl.Request
+	}{
+		{
+			name:   "maps to the KwokCluster of the owning cluster",
+			object: newTestKwokControlPlane("test", endpoint),
+			expected: []ctrl.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "default", Name: "test"}},
+			},
+		},
+		{
+			name:   "skips objects that are not a KwokControlPlane",
+			object: &infrav1.KwokCluster{},
+		},
+		{
+			name:   "skips control planes being deleted",
+			object: deletedControlPlane,
+		},
+		{
+			name:   "skips control planes without an endpoint",
+			object: newTestKwokControlPlane("test", clusterv1.APIEndpoint{}),
+		},
+		{
+			name:   "skips control planes without an owning cluster",
+			object: newTestKwokControlPlane("missing", endpoint),
+		},
+		{
+			name:   "skips clusters not using a KwokCluster",
+			object: newTestKwokControlPlane("external", endpoint),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(newTestCluster("test"), externalCluster).
+				Build()
+
+			log := ctrl.LoggerFrom(context.TODO())
+			r := &KwokClusterReconciler{Client: fakeClient}
+
+			requests := r.kwokControlPlaneToKwokCluster(context.TODO(), &log)(tc.object)
+			g.Expect(requests).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestKwokControlPlaneEndpointChanged(t *testing.T) {
+	endpoint := clusterv1.APIEndpoint{Host: "127.0.0.1", Port: 32766}
+	otherEndpoint := clusterv1.APIEndpoint{Host: "127.0.0.1", Port: 32767}
+
+	withoutEndpoint := newTestKwokControlPlane("test", clusterv1.APIEndpoint{})
+	withEndpoint := newTestKwokControlPlane("test", endpoint)
+	withOtherEndpoint := newTestKwokControlPlane("test", otherEndpoint)
+
+	testCases := []struct {
+		name     string
+		event    func(p predicate.Funcs) bool
+		expected bool
+	}{
+		{
+			name: "create without endpoint",
+			event: func(p predicate.Funcs) bool {
+				return p.Create(event.CreateEvent{Object: withoutEndpoint})
+			},
+			expected: false,
+		},
+		{
+			name: "create with endpoint",
+			event: func(p predicate.Funcs) bool {
+				return p.Create(event.CreateEvent{Object: withEndpoint})
+			},
+			expected: true,
+		},
+		{
+			name: "update setting the endpoint",
+			event: func(p predicate.Funcs) bool {
+				return p.Update(event.UpdateEvent{ObjectOld: withoutEndpoint, ObjectNew: withEndpoint})
+			},
+			expected: true,
+		},
+		{
+			name: "update changing the endpoint",
+			event: func(p predicate.Funcs) bool {
+				return p.Update(event.UpdateEvent{ObjectOld: withEndpoint, ObjectNew: withOtherEndpoint})
+			},
+			expected: true,
+		},
+		{
+			name: "update keeping the endpoint",
+			event: func(p predicate.Funcs) bool {
+				return p.Update(event.UpdateEvent{ObjectOld: withEndpoint, ObjectNew: withEndpoint.DeepCopy()})
+			},
+			expected: false,
+		},
+		{
+			name: "update of another kind",
+			event: func(p predicate.Funcs) bool {
+				return p.Update(event.UpdateEvent{ObjectOld: &infrav1.KwokCluster{}, ObjectNew: &infrav1.KwokCluster{}})
+			},
+			expected: false,
+		},
+		{
+			name: "delete",
+			event: func(p predicate.Funcs) bool {
+				return p.Delete(event.DeleteEvent{Object: withEndpoint})
+			},
+			expected: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(tc.event(kwokControlPlaneEndpointChanged(ctrl.Log))).To(Equal(tc.expected))
+		})
+	}
+}
+
+// createTestKwokCluster creates a Cluster in its own namespace, with a KwokCluster using the
+// given runtime and a generic endpoint, as when the control plane is managed by another provider.
+func createTestKwokCluster(ctx context.Context, runtime string, paused bool) (*clusterv1.Cluster, *infrav1.KwokCluster) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "kwok-"}}
+	Expect(k8sClient.Create(ctx, namespace)).To(Succeed())
+	name := namespace.Name
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: name},
+		Spec: clusterv1.ClusterSpec{
+			Paused: paused,
+			InfrastructureRef: &corev1.ObjectReference{
+				APIVersion: infrav1.GroupVersion.String(),
+				Kind:       "KwokCluster",
+				Name:       name,
+				Namespace:  name,
+			},
+		},
+	}
+	Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+
+	kwokCluster := &infrav1.KwokCluster{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: name,
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Cluster",
+					Name:       cluster.Name,
+					UID:        cluster.UID,
+				},
+			},
+		},
+		Spec: infrav1.KwokClusterSpec{
+			Runtime:              runtime,
+			ControlPlaneEndpoint: clusterv1.APIEndpoint{Host: "127.0.0.1", Port: 6443},
+		},
+	}
+	Expect(k8sClient.Create(ctx, kwokCluster)).To(Succeed())
+
+	return cluster, kwokCluster
+}
+
+// kwokClusterReady returns whether the KwokCluster is ready.
+func kwokClusterReady(ctx context.Context, kwokCluster *infrav1.KwokCluster) func(g Gomega) bool {
+	return func(g Gomega) bool {
+		latest := &infrav1.KwokCluster{}
+		g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(kwokCluster), latest)).To(Succeed())
+		return latest.Status.Ready
+	}
+}
+
+var _ = Describe("KwokCluster controller", func() {
+	const (
+		eventuallyTimeout    = 30 * time.Second
+		consistentlyDuration = 2 * time.Second
+	)
+
+	It("marks the KwokCluster ready", func(ctx SpecContext) {
+		_, kwokCluster := createTestKwokCluster(ctx, "docker", false)
+
+		Eventually(kwokClusterReady(ctx, kwokCluster), eventuallyTimeout).Should(BeTrue())
+	})
+
+	It("does not reconcile paused clusters", func(ctx SpecContext) {
+		cluster, kwokCluster := createTestKwokCluster(ctx, "docker", true)
+
+		Consistently(kwokClusterReady(ctx, kwokCluster), consistentlyDuration).Should(BeFalse())
+
+		By("unpausing the cluster")
+		unpaused := cluster.DeepCopy()
+		unpaused.Spec.Paused = false
+		Expect(k8sClient.Patch(ctx, unpaused, client.MergeFrom(cluster))).To(Succeed())
+
+		Eventually(kwokClusterReady(ctx, kwokCluster), eventuallyTimeout).Should(BeTrue())
+	})
+
+	It("does not mark KwokClusters with an unknown runtime ready", func(ctx SpecContext) {
+		_, kwokCluster := createTestKwokCluster(ctx, "unknown", false)
+
+		Consistently(kwokClusterReady(ctx, kwokCluster), consistentlyDuration).Should(BeFalse())
+	})
+})
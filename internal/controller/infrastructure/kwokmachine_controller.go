@@ -18,45 +18,328 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	infrastructurev1alpha1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1alpha1"
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
 )
 
 // KwokMachineReconciler reconciles a KwokMachine object
 type KwokMachineReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme           *runtime.Scheme
+	WatchFilterValue string
+
+	// WorkloadClient returns a client of the kwok cluster of a Cluster. It defaults to a client
+	// built from the kubeconfig Secret of the Cluster.
+	WorkloadClient func(ctx context.Context, cluster client.ObjectKey) (kubernetes.Interface, error)
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachines,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachines/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachines/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines;machines/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kwokcontrolplanes;kwokcontrolplanes/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// Reconcile registers a Node in the kwok cluster for each KwokMachine, once the simulated
+// provisioning latency has elapsed.
+func (r *KwokMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	kwokMachine := &infrav1.KwokMachine{}
+	if err := r.Get(ctx, req.NamespacedName, kwokMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Fetch the Machine.
+	machine, err := util.GetOwnerMachine(ctx, r.Client, kwokMachine.ObjectMeta)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if machine == nil {
+		log.Info("Machine Controller has not yet set OwnerRef")
+		return reconcile.Result{}, nil
+	}
+
+	log = log.WithValues("machine", machine.Name)
+
+	// Fetch the Cluster.
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machine.ObjectMeta)
+	if err != nil {
+		log.Info("Machine is missing cluster label or cluster does not exist")
+		return reconcile.Result{}, nil
+	}
+
+	if annotations.IsPaused(cluster, kwokMachine) {
+		log.Info("KwokMachine or linked Cluster is marked as paused. Won't reconcile")
+		return reconcile.Result{}, nil
+	}
+
+	log = log.WithValues("cluster", cluster.Name)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	patchHelper, err := patch.NewHelper(kwokMachine, r.Client)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+
+	defer func() {
+		conditions.SetSummary(kwokMachine, conditions.WithConditions(infrav1.NodeProvisionedCondition))
+
+		if err := patchHelper.Patch(ctx, kwokMachine, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.NodeProvisionedCondition,
+		}}); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, fmt.Errorf("failed to patch KwokMachine: %w", err)})
+		}
+	}()
+
+	if !kwokMachine.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, cluster, kwokMachine)
+	}
+
+	return r.reconcileNormal(ctx, cluster, machine, kwokMachine)
+}
+
+func (r *KwokMachineReconciler) reconcileNormal(ctx context.Context, cluster *clusterv1.Cluster, machine *clusterv1.Machine, kwokMachine *infrav1.KwokMachine) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	controllerutil.AddFinalizer(kwokMachine, infrav1.KwokMachineFinalizer)
+
+	// The kwok cluster may have been recreated or have lost its state since the Node was
+	// registered, so the Node is registered again when it is missing.
+	if kwokMachine.Status.Ready {
+		exists, err := r.nodeExists(ctx, cluster, kwokMachine.Name)
+		if err != nil || exists {
+			return reconcile.Result{}, err
+		}
+		log.Info("Node is missing, registering it again", "node", kwokMachine.Name)
+	}
+
+	if !conditions.IsTrue(cluster, clusterv1.ControlPlaneInitializedCondition) {
+		log.Info("Waiting for the control plane to be initialized")
+		conditions.MarkFalse(kwokMachine, infrav1.NodeProvisionedCondition, clusterv1.WaitingForControlPlaneAvailableReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{}, nil
+	}
+
+	if machine.Spec.Bootstrap.DataSecretName == nil {
+		log.Info("Waiting for the bootstrap data")
+		conditions.MarkFalse(kwokMachine, infrav1.NodeProvisionedCondition, infrav1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{}, nil
+	}
+
+	if err := validateNodeShape(kwokMachine.Spec.Node); err != nil {
+		log.Error(err, "Invalid node shape")
+		kwokMachine.Status.FailureReason = capierrors.MachineStatusErrorPtr(capierrors.InvalidConfigurationMachineError)
+		kwokMachine.Status.FailureMessage = pointer.String(err.Error())
+		conditions.MarkFalse(kwokMachine, infrav1.NodeProvisionedCondition, infrav1.NodeProvisioningFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return reconcile.Result{}, nil
+	}
+
+	// Simulate the time the Node takes to be provisioned.
+	latency := kwokMachine.Spec.SimulationConfig.ReconcileLatency()
+	if elapsed := time.Since(kwokMachine.CreationTimestamp.Time); elapsed < latency {
+		conditions.MarkFalse(kwokMachine, infrav1.NodeProvisionedCondition, infrav1.NodeProvisioningReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{RequeueAfter: latency - elapsed}, nil
+	}
+
+	workloadClient, err := r.workloadClient(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		conditions.MarkFalse(kwokMachine, infrav1.NodeProvisionedCondition, infrav1.NodeProvisioningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return reconcile.Result{}, fmt.Errorf("failed to get client of the kwok cluster: %w", err)
+	}
+
+	node := desiredNode(machine, kwokMachine)
+	if _, err := workloadClient.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		conditions.MarkFalse(kwokMachine, infrav1.NodeProvisionedCondition, infrav1.NodeProvisioningFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return reconcile.Result{}, fmt.Errorf("failed to create node %q: %w", node.Name, err)
+	}
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the KwokMachine object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.4/pkg/reconcile
-func (r *KwokMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
+	log.Info("Registered node", "node", node.Name)
+	kwokMachine.Spec.ProviderID = pointer.String(node.Spec.ProviderID)
+	kwokMachine.Status.Ready = true
+	conditions.MarkTrue(kwokMachine, infrav1.NodeProvisionedCondition)
 
-	// TODO(user): your logic here
+	return reconcile.Result{}, nil
+}
+
+func (r *KwokMachineReconciler) reconcileDelete(ctx context.Context, cluster *clusterv1.Cluster, kwokMachine *infrav1.KwokMachine) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	skipReason, waitReason, err := workloadClusterState(ctx, r.Client, cluster)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if waitReason != "" {
+		log.Info("Waiting for the control plane to delete node", "reason", waitReason)
+		return reconcile.Result{RequeueAfter: controlPlaneWaitInterval}, nil
+	}
+
+	// The Node is only gone along with the cluster when the cluster can't be reached anymore.
+	workloadClient, err := r.workloadClient(ctx, util.ObjectKey(cluster))
+	switch {
+	case skipReason != "":
+		log.Info("Skipping node deletion", "reason", skipReason)
+	case apierrors.IsNotFound(err):
+		log.Info("Kubeconfig of the cluster is gone, skipping node deletion")
+	case err != nil:
+		return reconcile.Result{}, fmt.Errorf("failed to get client of the kwok cluster: %w", err)
+	default:
+		if err := workloadClient.CoreV1().Nodes().Delete(ctx, kwokMachine.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return reconcile.Result{}, fmt.Errorf("failed to delete node %q: %w", kwokMachine.Name, err)
+		}
+		log.Info("Deleted node", "node", kwokMachine.Name)
+	}
+
+	controllerutil.RemoveFinalizer(kwokMachine, infrav1.KwokMachineFinalizer)
+
+	return reconcile.Result{}, nil
+}
+
+// nodeExists returns whether the Node of a KwokMachine exists in the kwok cluster of the Cluster.
+// It is assumed to exist while the kwok cluster can't be reached.
+func (r *KwokMachineReconciler) nodeExists(ctx context.Context, cluster *clusterv1.Cluster, name string) (bool, error) {
+	goneReason, notReadyReason, err := workloadClusterState(ctx, r.Client, cluster)
+	if err != nil || goneReason != "" || notReadyReason != "" {
+		return true, err
+	}
+
+	workloadClient, err := r.workloadClient(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		return false, fmt.Errorf("failed to get client of the kwok cluster: %w", err)
+	}
+	if _, err := workloadClient.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get node %q: %w", name, err)
+	}
+	return true, nil
+}
 
-	return ctrl.Result{}, nil
+// workloadClient returns a client of the kwok cluster of the Cluster.
+func (r *KwokMachineReconciler) workloadClient(ctx context.Context, cluster client.ObjectKey) (kubernetes.Interface, error) {
+	if r.WorkloadClient != nil {
+		return r.WorkloadClient(ctx, cluster)
+	}
+	return workloadClientFromKubeconfig(ctx, r.Client, cluster)
+}
+
+// desiredNode returns the Node registered in the kwok cluster for the KwokMachine, of the shape
+// of the KwokMachine and with the control plane role for control plane Machines.
+func desiredNode(machine *clusterv1.Machine, kwokMachine *infrav1.KwokMachine) *corev1.Node {
+	node := newFakeNode(kwokMachine.Name, providerID(kwokMachine.Namespace, kwokMachine.Name), pointer.StringDeref(machine.Spec.Version, ""), kwokMachine.Spec.Node)
+
+	if util.IsControlPlaneMachine(machine) {
+		node.Labels["node-role.kubernetes.io/control-plane"] = ""
+		node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{
+			Key:    "node-role.kubernetes.io/control-plane",
+			Effect: corev1.TaintEffectNoSchedule,
+		})
+	}
+
+	return node
 }
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *KwokMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
+func (r *KwokMachineReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	clusterToKwokMachines, err := util.ClusterToObjectsMapper(mgr.GetClient(), &infrav1.KwokMachineList{}, mgr.GetScheme())
+	if err != nil {
+		return fmt.Errorf("failed to create mapper for Cluster to KwokMachines: %w", err)
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&infrastructurev1alpha1.KwokMachine{}).
+		For(&infrav1.KwokMachine{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(log, r.WatchFilterValue)).
+		Watches(
+			&source.Kind{Type: &clusterv1.Machine{}},
+			handler.EnqueueRequestsFromMapFunc(util.MachineToInfrastructureMapFunc(infrav1.GroupVersion.WithKind("KwokMachine"))),
+		).
+		Watches(
+			&source.Kind{Type: &controlplanev1.KwokControlPlane{}},
+			handler.EnqueueRequestsFromMapFunc(r.kwokControlPlaneToKwokMachines(ctx, &log, clusterToKwokMachines)),
+			builder.WithPredicates(kwokControlPlaneBecameReady(log)),
+		).
 		Complete(r)
 }
+
+// kwokControlPlaneBecameReady returns a predicate that only lets through KwokControlPlane
+// updates where the control plane has become ready, e.g. after its kwok cluster was recreated.
+func kwokControlPlaneBecameReady(log logr.Logger) predicate.Funcs {
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldControlPlane, ok := e.ObjectOld.(*controlplanev1.KwokControlPlane)
+			if !ok {
+				log.V(4).Info("Expected KwokControlPlane", "type", fmt.Sprintf("%T", e.ObjectOld))
+				return false
+			}
+			newControlPlane, ok := e.ObjectNew.(*controlplanev1.KwokControlPlane)
+			if !ok {
+				log.V(4).Info("Expected KwokControlPlane", "type", fmt.Sprintf("%T", e.ObjectNew))
+				return false
+			}
+
+			return !oldControlPlane.Status.Ready && newControlPlane.Status.Ready
+		},
+		DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+		GenericFunc: func(e event.GenericEvent) bool { return false },
+	}
+}
+
+func (r *KwokMachineReconciler) kwokControlPlaneToKwokMachines(ctx context.Context, log *logr.Logger, clusterToKwokMachines handler.MapFunc) handler.MapFunc {
+	return func(o client.Object) []ctrl.Request {
+		kwokControlPlane, ok := o.(*controlplanev1.KwokControlPlane)
+		if !ok {
+			log.Error(fmt.Errorf("expected a KwokControlPlane, got %T instead", o), "failed to map KwokControlPlane")
+			return nil
+		}
+
+		cluster, err := util.GetOwnerCluster(ctx, r.Client, kwokControlPlane.ObjectMeta)
+		if err != nil {
+			log.Error(err, "failed to get owning cluster", "kwokcontrolplane", klog.KObj(kwokControlPlane))
+			return nil
+		}
+		if cluster == nil {
+			return nil
+		}
+
+		return clusterToKwokMachines(cluster)
+	}
+}
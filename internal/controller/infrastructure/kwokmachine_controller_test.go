@@ -0,0 +1,322 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1beta1"
+)
+
+func newTestMachine(clusterName string, controlPlane bool) *clusterv1.Machine {
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-machine",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+		},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: clusterName,
+			Version:     pointer.String("v1.27.1"),
+			Bootstrap: clusterv1.Bootstrap{
+				DataSecretName: pointer.String(clusterName + "-bootstrap"),
+			},
+		},
+	}
+	if controlPlane {
+		machine.Labels[clusterv1.MachineControlPlaneLabel] = ""
+	}
+	return machine
+}
+
+func newTestKwokMachine(machine *clusterv1.Machine) *infrav1.KwokMachine {
+	return &infrav1.KwokMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              machine.Name,
+			Namespace:         machine.Namespace,
+			CreationTimestamp: metav1.Now(),
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: clusterv1.GroupVersion.String(),
+					Kind:       "Machine",
+					Name:       machine.Name,
+				},
+			},
+		},
+	}
+}
+
+func TestKwokMachineReconcile(t *testing.T) {
+	initialized := newTestCluster("test")
+	conditions.MarkTrue(initialized, clusterv1.ControlPlaneInitializedCondition)
+
+	testCases := []struct {
+		name          string
+		cluster       *clusterv1.Cluster
+		controlPlane  bool
+		noBootstrap   bool
+		latency       time.Duration
+		node          *infrav1.NodeShape
+		expectReady   bool
+		expectRequeue bool
+		expectReason  string
+	}{
+		{
+			name:         "registers a control plane node",
+			cluster:      initialized,
+			controlPlane: true,
+			expectReady:  true,
+		},
+		{
+			name:        "registers a worker node",
+			cluster:     initialized,
+			expectReady: true,
+		},
+		{
+			name:         "waits for the control plane to be initialized",
+			cluster:      newTestCluster("test"),
+			expectReason: clusterv1.WaitingForControlPlaneAvailableReason,
+		},
+		{
+			name:         "waits for the bootstrap data",
+			cluster:      initialized,
+			noBootstrap:  true,
+			expectReason: infrav1.WaitingForBootstrapDataReason,
+		},
+		{
+			name:          "waits for the provisioning latency",
+			cluster:       initialized,
+			latency:       time.Hour,
+			expectRequeue: true,
+			expectReason:  infrav1.NodeProvisioningReason,
+		},
+		{
+			name:    "fails on fractional extended resources",
+			cluster: initialized,
+			node: &infrav1.NodeShape{
+				Capacity: corev1.ResourceList{"example.com/gpu": resource.MustParse("500m")},
+			},
+			expectReason: infrav1.NodeProvisioningFailedReason,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			machine := newTestMachine("test", tc.controlPlane)
+			if tc.noBootstrap {
+				machine.Spec.Bootstrap.DataSecretName = nil
+			}
+			kwokMachine := newTestKwokMachine(machine)
+			kwokMachine.Spec.SimulationConfig = &sharedv1.SimulationConfig{
+				Reconcile: &sharedv1.ReconcileSimulation{Latency: metav1.Duration{Duration: tc.latency}},
+			}
+			kwokMachine.Spec.Node = tc.node
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(tc.cluster.DeepCopy(), machine, kwokMachine).
+				Build()
+			workloadClient := kubefake.NewSimpleClientset()
+
+			r := &KwokMachineReconciler{
+				Client: fakeClient,
+				WorkloadClient: func(context.Context, client.ObjectKey) (kubernetes.Interface, error) {
+					return workloadClient, nil
+				},
+			}
+
+			res, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokMachine)})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(res.RequeueAfter > 0).To(Equal(tc.expectRequeue))
+
+			latest := &infrav1.KwokMachine{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokMachine), latest)).To(Succeed())
+			g.Expect(latest.Finalizers).To(ContainElement(infrav1.KwokMachineFinalizer))
+			g.Expect(latest.Status.Ready).To(Equal(tc.expectReady))
+			if tc.expectReason != "" {
+				g.Expect(conditions.GetReason(latest, infrav1.NodeProvisionedCondition)).To(Equal(tc.expectReason))
+			}
+
+			node, err := workloadClient.CoreV1().Nodes().Get(context.TODO(), kwokMachine.Name, metav1.GetOptions{})
+			if !tc.expectReady {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(conditions.IsTrue(latest, infrav1.NodeProvisionedCondition)).To(BeTrue())
+			g.Expect(latest.Spec.ProviderID).To(Equal(pointer.String("kwok://default/test-machine")))
+			g.Expect(node.Spec.ProviderID).To(Equal("kwok://default/test-machine"))
+			g.Expect(node.Annotations).To(HaveKeyWithValue(fakeNodeAnnotation, "fake"))
+			g.Expect(node.Status.NodeInfo.KubeletVersion).To(Equal("v1.27.1"))
+			g.Expect(node.Status.Capacity).To(Equal(kwokMachine.Spec.Node.GetCapacity()))
+			g.Expect(node.Status.Allocatable).To(Equal(node.Status.Capacity))
+			if tc.controlPlane {
+				g.Expect(node.Labels).To(HaveKey("node-role.kubernetes.io/control-plane"))
+				g.Expect(node.Spec.Taints).To(HaveLen(1))
+			} else {
+				g.Expect(node.Labels).NotTo(HaveKey("node-role.kubernetes.io/control-plane"))
+				g.Expect(node.Spec.Taints).To(BeEmpty())
+			}
+		})
+	}
+}
+
+func TestKwokMachineReconcileMissingNode(t *testing.T) {
+	testCases := []struct {
+		name             string
+		hibernated       bool
+		expectRegistered bool
+	}{
+		{
+			name:             "registers the missing node of a ready machine again",
+			expectRegistered: true,
+		},
+		{
+			name:       "waits for a hibernated cluster to check the node",
+			hibernated: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster, controlPlane := newTestReadyCluster("test")
+			controlPlane.Spec.Hibernate = tc.hibernated
+			machine := newTestMachine("test", false)
+			kwokMachine := newTestKwokMachine(machine)
+			kwokMachine.Finalizers = []string{infrav1.KwokMachineFinalizer}
+			kwokMachine.Spec.ProviderID = pointer.String("kwok://default/test-machine")
+			kwokMachine.Status.Ready = true
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(cluster, controlPlane, machine, kwokMachine).
+				Build()
+			// The kwok cluster was recreated since the node was registered.
+			workloadClient := kubefake.NewSimpleClientset()
+
+			r := &KwokMachineReconciler{
+				Client: fakeClient,
+				WorkloadClient: func(context.Context, client.ObjectKey) (kubernetes.Interface, error) {
+					return workloadClient, nil
+				},
+			}
+
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokMachine)})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			_, err = workloadClient.CoreV1().Nodes().Get(context.TODO(), kwokMachine.Name, metav1.GetOptions{})
+			if tc.expectRegistered {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+			latest := &infrav1.KwokMachine{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokMachine), latest)).To(Succeed())
+			g.Expect(latest.Status.Ready).To(BeTrue())
+		})
+	}
+}
+
+func TestKwokMachineReconcileDelete(t *testing.T) {
+	testCases := []struct {
+		name             string
+		hibernated       bool
+		noControlPlane   bool
+		expectNodeExists bool
+		expectWait       bool
+	}{
+		{
+			name: "deletes the node",
+		},
+		{
+			name:             "waits for a hibernated cluster to delete the node",
+			hibernated:       true,
+			expectNodeExists: true,
+			expectWait:       true,
+		},
+		{
+			name:             "skips the node deletion when the control plane is gone",
+			noControlPlane:   true,
+			expectNodeExists: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster, controlPlane := newTestReadyCluster("test")
+			controlPlane.Spec.Hibernate = tc.hibernated
+			machine := newTestMachine("test", false)
+			kwokMachine := newTestKwokMachine(machine)
+			kwokMachine.Finalizers = []string{infrav1.KwokMachineFinalizer}
+			objs := []client.Object{cluster, machine, kwokMachine}
+			if !tc.noControlPlane {
+				objs = append(objs, controlPlane)
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(objs...).
+				Build()
+			workloadClient := kubefake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: kwokMachine.Name}})
+
+			r := &KwokMachineReconciler{
+				Client: fakeClient,
+				WorkloadClient: func(context.Context, client.ObjectKey) (kubernetes.Interface, error) {
+					return workloadClient, nil
+				},
+			}
+
+			g.Expect(fakeClient.Delete(context.TODO(), kwokMachine)).To(Succeed())
+			res, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokMachine)})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(res.RequeueAfter > 0).To(Equal(tc.expectWait))
+
+			_, err = workloadClient.CoreV1().Nodes().Get(context.TODO(), kwokMachine.Name, metav1.GetOptions{})
+			if tc.expectNodeExists {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+			err = fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokMachine), &infrav1.KwokMachine{})
+			g.Expect(apierrors.IsNotFound(err)).To(Equal(!tc.expectWait))
+		})
+	}
+}
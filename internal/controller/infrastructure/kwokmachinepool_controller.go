@@ -0,0 +1,346 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	exputil "sigs.k8s.io/cluster-api/exp/util"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+// KwokMachinePoolReconciler reconciles a KwokMachinePool object
+type KwokMachinePoolReconciler struct {
+	client.Client
+	Scheme           *runtime.Scheme
+	WatchFilterValue string
+
+	// WorkloadClient returns a client of the kwok cluster of a Cluster. It defaults to a client
+	// built from the kubeconfig Secret of the Cluster.
+	WorkloadClient func(ctx context.Context, cluster client.ObjectKey) (kubernetes.Interface, error)
+
+	// randIntn returns a random number in [0,n) to simulate provisioning failures. It defaults
+	// to rand.Intn.
+	randIntn func(n int) int
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachinepools,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachinepools/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=kwokmachinepools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools;machinepools/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters;clusters/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=kwokcontrolplanes;kwokcontrolplanes/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// Reconcile scales the instances of a KwokMachinePool to the replicas of its MachinePool, and
+// registers a Node in the kwok cluster for each instance once its simulated provisioning is done.
+func (r *KwokMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, reterr error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	kwokMachinePool := &infrav1.KwokMachinePool{}
+	if err := r.Get(ctx, req.NamespacedName, kwokMachinePool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// Fetch the MachinePool.
+	machinePool, err := exputil.GetOwnerMachinePool(ctx, r.Client, kwokMachinePool.ObjectMeta)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if machinePool == nil {
+		log.Info("MachinePool Controller has not yet set OwnerRef")
+		return reconcile.Result{}, nil
+	}
+
+	log = log.WithValues("machinePool", machinePool.Name)
+
+	// Fetch the Cluster.
+	cluster, err := util.GetClusterFromMetadata(ctx, r.Client, machinePool.ObjectMeta)
+	if err != nil {
+		log.Info("MachinePool is missing cluster label or cluster does not exist")
+		return reconcile.Result{}, nil
+	}
+
+	if annotations.IsPaused(cluster, kwokMachinePool) {
+		log.Info("KwokMachinePool or linked Cluster is marked as paused. Won't reconcile")
+		return reconcile.Result{}, nil
+	}
+
+	log = log.WithValues("cluster", cluster.Name)
+	ctx = ctrl.LoggerInto(ctx, log)
+
+	patchHelper, err := patch.NewHelper(kwokMachinePool, r.Client)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to init patch helper: %w", err)
+	}
+
+	defer func() {
+		conditions.SetSummary(kwokMachinePool, conditions.WithConditions(infrav1.InstancesReadyCondition))
+
+		if err := patchHelper.Patch(ctx, kwokMachinePool, patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.InstancesReadyCondition,
+		}}); err != nil {
+			reterr = kerrors.NewAggregate([]error{reterr, fmt.Errorf("failed to patch KwokMachinePool: %w", err)})
+		}
+	}()
+
+	if !kwokMachinePool.ObjectMeta.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, cluster, kwokMachinePool)
+	}
+
+	return r.reconcileNormal(ctx, cluster, machinePool, kwokMachinePool)
+}
+
+func (r *KwokMachinePoolReconciler) reconcileNormal(ctx context.Context, cluster *clusterv1.Cluster, machinePool *expv1.MachinePool, kwokMachinePool *infrav1.KwokMachinePool) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	controllerutil.AddFinalizer(kwokMachinePool, infrav1.KwokMachinePoolFinalizer)
+
+	if !conditions.IsTrue(cluster, clusterv1.ControlPlaneInitializedCondition) {
+		log.Info("Waiting for the control plane to be initialized")
+		conditions.MarkFalse(kwokMachinePool, infrav1.InstancesReadyCondition, clusterv1.WaitingForControlPlaneAvailableReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{}, nil
+	}
+
+	if machinePool.Spec.Template.Spec.Bootstrap.DataSecretName == nil {
+		log.Info("Waiting for the bootstrap data")
+		conditions.MarkFalse(kwokMachinePool, infrav1.InstancesReadyCondition, infrav1.WaitingForBootstrapDataReason, clusterv1.ConditionSeverityInfo, "")
+		return reconcile.Result{}, nil
+	}
+
+	workloadClient, err := r.workloadClient(ctx, util.ObjectKey(cluster))
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("failed to get client of the kwok cluster: %w", err)
+	}
+
+	replicas := int(pointer.Int32Deref(machinePool.Spec.Replicas, 1))
+	if err := r.scaleDown(ctx, workloadClient, kwokMachinePool, replicas); err != nil {
+		return reconcile.Result{}, err
+	}
+	for len(kwokMachinePool.Status.Instances) < replicas {
+		kwokMachinePool.Status.Instances = append(kwokMachinePool.Status.Instances, infrav1.KwokMachinePoolInstanceStatus{
+			InstanceName:          fmt.Sprintf("%s-%s", kwokMachinePool.Name, util.RandomString(5)),
+			ProvisioningStartTime: metav1.Now(),
+		})
+	}
+
+	res, err := r.provisionInstances(ctx, workloadClient, machinePool, kwokMachinePool)
+
+	kwokMachinePool.Spec.ProviderIDList = []string{}
+	for _, instance := range kwokMachinePool.Status.Instances {
+		if instance.Ready {
+			kwokMachinePool.Spec.ProviderIDList = append(kwokMachinePool.Spec.ProviderIDList, instance.ProviderID)
+		}
+	}
+	kwokMachinePool.Status.Replicas = int32(len(kwokMachinePool.Spec.ProviderIDList))
+	kwokMachinePool.Status.Ready = len(kwokMachinePool.Spec.ProviderIDList) == replicas
+	if kwokMachinePool.Spec.ProviderID == "" {
+		kwokMachinePool.Spec.ProviderID = providerID(kwokMachinePool.Namespace, kwokMachinePool.Name)
+	}
+
+	return res, err
+}
+
+// provisionInstances registers the Nodes of the instances whose simulated provisioning latency
+// has elapsed, unless their provisioning fails. Failed instances are provisioned again.
+func (r *KwokMachinePoolReconciler) provisionInstances(ctx context.Context, workloadClient kubernetes.Interface, machinePool *expv1.MachinePool, kwokMachinePool *infrav1.KwokMachinePool) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	simulation := kwokMachinePool.Spec.InstanceSimulation
+	if simulation == nil {
+		simulation = &infrav1.InstanceSimulation{}
+	}
+	latency := simulation.Latency.Duration
+	version := pointer.StringDeref(machinePool.Spec.Template.Spec.Version, "")
+
+	res := reconcile.Result{}
+	provisioning := 0
+	failed := []string{}
+	var errs []error
+	for i := range kwokMachinePool.Status.Instances {
+		instance := &kwokMachinePool.Status.Instances[i]
+		if instance.Ready {
+			continue
+		}
+
+		if elapsed := time.Since(instance.ProvisioningStartTime.Time); elapsed < latency {
+			provisioning++
+			res = util.LowestNonZeroResult(res, reconcile.Result{RequeueAfter: latency - elapsed})
+			continue
+		}
+
+		if r.provisioningFails(simulation.FailurePercentage) {
+			log.Info("Simulated provisioning failure", "instance", instance.InstanceName)
+			record.Warnf(kwokMachinePool, "InstanceProvisioningFailed", "Simulated provisioning failure of instance %q", instance.InstanceName)
+			instance.ProvisioningFailures++
+			instance.ProvisioningStartTime = metav1.Now()
+			failed = append(failed, instance.InstanceName)
+			res = util.LowestNonZeroResult(res, reconcile.Result{Requeue: true, RequeueAfter: latency})
+			continue
+		}
+
+		node := newFakeNode(instance.InstanceName, providerID(kwokMachinePool.Namespace, instance.InstanceName), version, nil)
+		if _, err := workloadClient.CoreV1().Nodes().Create(ctx, node, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			failed = append(failed, instance.InstanceName)
+			errs = append(errs, fmt.Errorf("failed to create node %q: %w", node.Name, err))
+			continue
+		}
+
+		log.Info("Registered node", "node", node.Name)
+		instance.ProviderID = node.Spec.ProviderID
+		instance.Ready = true
+	}
+
+	switch {
+	case len(failed) > 0:
+		conditions.MarkFalse(kwokMachinePool, infrav1.InstancesReadyCondition, infrav1.InstanceProvisioningFailedReason, clusterv1.ConditionSeverityWarning, "Instances %v failed to be provisioned", failed)
+	case provisioning > 0:
+		conditions.MarkFalse(kwokMachinePool, infrav1.InstancesReadyCondition, infrav1.InstancesProvisioningReason, clusterv1.ConditionSeverityInfo, "%d of %d instances are provisioning", provisioning, len(kwokMachinePool.Status.Instances))
+	default:
+		conditions.MarkTrue(kwokMachinePool, infrav1.InstancesReadyCondition)
+	}
+
+	return res, kerrors.NewAggregate(errs)
+}
+
+// provisioningFails returns true when a simulated provisioning fails, with the given chance.
+func (r *KwokMachinePoolReconciler) provisioningFails(failurePercentage int32) bool {
+	if failurePercentage <= 0 {
+		return false
+	}
+	randIntn := r.randIntn
+	if randIntn == nil {
+		randIntn = rand.Intn
+	}
+	return randIntn(100) < int(failurePercentage)
+}
+
+// scaleDown removes instances above the replicas, the ones still provisioning first, then the
+// newest ones, and deletes their Nodes.
+func (r *KwokMachinePoolReconciler) scaleDown(ctx context.Context, workloadClient kubernetes.Interface, kwokMachinePool *infrav1.KwokMachinePool, replicas int) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	for len(kwokMachinePool.Status.Instances) > replicas {
+		instances := kwokMachinePool.Status.Instances
+		i := len(instances) - 1
+		for j := len(instances) - 1; j >= 0; j-- {
+			if !instances[j].Ready {
+				i = j
+				break
+			}
+		}
+
+		instance := instances[i]
+		if instance.Ready {
+			if err := workloadClient.CoreV1().Nodes().Delete(ctx, instance.InstanceName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete node %q: %w", instance.InstanceName, err)
+			}
+			log.Info("Deleted node", "node", instance.InstanceName)
+		}
+		kwokMachinePool.Status.Instances = append(instances[:i], instances[i+1:]...)
+	}
+
+	return nil
+}
+
+func (r *KwokMachinePoolReconciler) reconcileDelete(ctx context.Context, cluster *clusterv1.Cluster, kwokMachinePool *infrav1.KwokMachinePool) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+
+	skipReason, waitReason, err := workloadClusterState(ctx, r.Client, cluster)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if waitReason != "" {
+		log.Info("Waiting for the control plane to delete nodes", "reason", waitReason)
+		return reconcile.Result{RequeueAfter: controlPlaneWaitInterval}, nil
+	}
+
+	// The Nodes are only gone along with the cluster when the cluster can't be reached anymore.
+	workloadClient, err := r.workloadClient(ctx, util.ObjectKey(cluster))
+	switch {
+	case skipReason != "":
+		log.Info("Skipping node deletion", "reason", skipReason)
+	case apierrors.IsNotFound(err):
+		log.Info("Kubeconfig of the cluster is gone, skipping node deletion")
+	case err != nil:
+		return reconcile.Result{}, fmt.Errorf("failed to get client of the kwok cluster: %w", err)
+	default:
+		for _, instance := range kwokMachinePool.Status.Instances {
+			if err := workloadClient.CoreV1().Nodes().Delete(ctx, instance.InstanceName, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				return reconcile.Result{}, fmt.Errorf("failed to delete node %q: %w", instance.InstanceName, err)
+			}
+		}
+		log.Info("Deleted nodes", "instances", len(kwokMachinePool.Status.Instances))
+	}
+
+	controllerutil.RemoveFinalizer(kwokMachinePool, infrav1.KwokMachinePoolFinalizer)
+
+	return reconcile.Result{}, nil
+}
+
+// workloadClient returns a client of the kwok cluster of the Cluster.
+func (r *KwokMachinePoolReconciler) workloadClient(ctx context.Context, cluster client.ObjectKey) (kubernetes.Interface, error) {
+	if r.WorkloadClient != nil {
+		return r.WorkloadClient(ctx, cluster)
+	}
+	return workloadClientFromKubeconfig(ctx, r.Client, cluster)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KwokMachinePoolReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager, options controller.Options) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.KwokMachinePool{}).
+		WithOptions(options).
+		WithEventFilter(predicates.ResourceNotPausedAndHasFilterLabel(log, r.WatchFilterValue)).
+		Watches(
+			&source.Kind{Type: &expv1.MachinePool{}},
+			handler.EnqueueRequestsFromMapFunc(exputil.MachinePoolToInfrastructureMapFunc(infrav1.GroupVersion.WithKind("KwokMachinePool"), log)),
+		).
+		Complete(r)
+}
@@ -0,0 +1,270 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+func newTestMachinePool(clusterName string, replicas int32) *expv1.MachinePool {
+	return &expv1.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      clusterName + "-pool",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: clusterName},
+		},
+		Spec: expv1.MachinePoolSpec{
+			ClusterName: clusterName,
+			Replicas:    pointer.Int32(replicas),
+			Template: clusterv1.MachineTemplateSpec{
+				Spec: clusterv1.MachineSpec{
+					ClusterName: clusterName,
+					Version:     pointer.String("v1.27.1"),
+					Bootstrap: clusterv1.Bootstrap{
+						DataSecretName: pointer.String(clusterName + "-bootstrap"),
+					},
+				},
+			},
+		},
+	}
+}
+
+func newTestKwokMachinePool(machinePool *expv1.MachinePool, instances ...infrav1.KwokMachinePoolInstanceStatus) *infrav1.KwokMachinePool {
+	return &infrav1.KwokMachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       machinePool.Name,
+			Namespace:  machinePool.Namespace,
+			Finalizers: []string{infrav1.KwokMachinePoolFinalizer},
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					APIVersion: expv1.GroupVersion.String(),
+					Kind:       "MachinePool",
+					Name:       machinePool.Name,
+				},
+			},
+		},
+		Status: infrav1.KwokMachinePoolStatus{Instances: instances},
+	}
+}
+
+// newTestInstance returns a ready instance of a KwokMachinePool, and its Node.
+func newTestInstance(name string) (infrav1.KwokMachinePoolInstanceStatus, *corev1.Node) {
+	instance := infrav1.KwokMachinePoolInstanceStatus{
+		InstanceName:          name,
+		ProviderID:            providerID("default", name),
+		Ready:                 true,
+		ProvisioningStartTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+	}
+	return instance, newFakeNode(name, instance.ProviderID, "v1.27.1", nil)
+}
+
+func TestKwokMachinePoolReconcile(t *testing.T) {
+	readyInstance, readyNode := newTestInstance("test-pool-ready")
+
+	testCases := []struct {
+		name           string
+		replicas       int32
+		simulation     *infrav1.InstanceSimulation
+		instances      []infrav1.KwokMachinePoolInstanceStatus
+		nodes          []*corev1.Node
+		expectReady    bool
+		expectReplicas int32
+		expectRequeue  bool
+		expectReason   string
+		expectFailures int32
+	}{
+		{
+			name:           "scales up",
+			replicas:       3,
+			instances:      []infrav1.KwokMachinePoolInstanceStatus{readyInstance},
+			nodes:          []*corev1.Node{readyNode},
+			expectReady:    true,
+			expectReplicas: 3,
+		},
+		{
+			name:           "scales down",
+			replicas:       0,
+			instances:      []infrav1.KwokMachinePoolInstanceStatus{readyInstance},
+			nodes:          []*corev1.Node{readyNode},
+			expectReady:    true,
+			expectReplicas: 0,
+		},
+		{
+			name:          "waits for the provisioning latency of the instances",
+			replicas:      2,
+			simulation:    &infrav1.InstanceSimulation{Latency: metav1.Duration{Duration: time.Hour}},
+			expectRequeue: true,
+			expectReason:  infrav1.InstancesProvisioningReason,
+		},
+		{
+			name:           "retries instances failing to be provisioned",
+			replicas:       2,
+			simulation:     &infrav1.InstanceSimulation{Latency: metav1.Duration{Duration: time.Minute}, FailurePercentage: 100},
+			instances:      []infrav1.KwokMachinePoolInstanceStatus{{InstanceName: "test-pool-failing", ProvisioningStartTime: metav1.NewTime(time.Now().Add(-time.Hour))}, readyInstance},
+			nodes:          []*corev1.Node{readyNode},
+			expectReplicas: 1,
+			expectRequeue:  true,
+			expectReason:   infrav1.InstanceProvisioningFailedReason,
+			expectFailures: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster := newTestCluster("test")
+			conditions.MarkTrue(cluster, clusterv1.ControlPlaneInitializedCondition)
+			machinePool := newTestMachinePool("test", tc.replicas)
+			kwokMachinePool := newTestKwokMachinePool(machinePool, tc.instances...)
+			kwokMachinePool.Spec.InstanceSimulation = tc.simulation
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(cluster, machinePool, kwokMachinePool).
+				Build()
+			workloadClient := kubefake.NewSimpleClientset()
+			for _, node := range tc.nodes {
+				g.Expect(workloadClient.Tracker().Add(node.DeepCopy())).To(Succeed())
+			}
+
+			r := &KwokMachinePoolReconciler{
+				Client: fakeClient,
+				WorkloadClient: func(context.Context, client.ObjectKey) (kubernetes.Interface, error) {
+					return workloadClient, nil
+				},
+				randIntn: func(int) int { return 0 },
+			}
+
+			res, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokMachinePool)})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(!res.IsZero()).To(Equal(tc.expectRequeue))
+
+			latest := &infrav1.KwokMachinePool{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokMachinePool), latest)).To(Succeed())
+			g.Expect(latest.Status.Instances).To(HaveLen(int(tc.replicas)))
+			g.Expect(latest.Status.Ready).To(Equal(tc.expectReady))
+			g.Expect(latest.Status.Replicas).To(Equal(tc.expectReplicas))
+			g.Expect(latest.Spec.ProviderIDList).To(HaveLen(int(tc.expectReplicas)))
+			if tc.expectReason != "" {
+				g.Expect(conditions.GetReason(latest, infrav1.InstancesReadyCondition)).To(Equal(tc.expectReason))
+			} else {
+				g.Expect(conditions.IsTrue(latest, infrav1.InstancesReadyCondition)).To(BeTrue())
+			}
+
+			var failures int32
+			for _, instance := range latest.Status.Instances {
+				failures += instance.ProvisioningFailures
+			}
+			g.Expect(failures).To(Equal(tc.expectFailures))
+
+			nodes, err := workloadClient.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(nodes.Items).To(HaveLen(int(tc.expectReplicas)))
+			for _, providerID := range latest.Spec.ProviderIDList {
+				g.Expect(nodes.Items).To(ContainElement(HaveField("Spec.ProviderID", providerID)))
+			}
+		})
+	}
+}
+
+func TestKwokMachinePoolReconcileDelete(t *testing.T) {
+	testCases := []struct {
+		name             string
+		hibernated       bool
+		noControlPlane   bool
+		expectNodeExists bool
+		expectWait       bool
+	}{
+		{
+			name: "deletes the nodes",
+		},
+		{
+			name:             "waits for a hibernated cluster to delete the nodes",
+			hibernated:       true,
+			expectNodeExists: true,
+			expectWait:       true,
+		},
+		{
+			name:             "skips the node deletion when the control plane is gone",
+			noControlPlane:   true,
+			expectNodeExists: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster, controlPlane := newTestReadyCluster("test")
+			controlPlane.Spec.Hibernate = tc.hibernated
+			machinePool := newTestMachinePool("test", 1)
+			instance, node := newTestInstance("test-pool-ready")
+			kwokMachinePool := newTestKwokMachinePool(machinePool, instance)
+			objs := []client.Object{cluster, machinePool, kwokMachinePool}
+			if !tc.noControlPlane {
+				objs = append(objs, controlPlane)
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(objs...).
+				Build()
+			workloadClient := kubefake.NewSimpleClientset(node)
+
+			r := &KwokMachinePoolReconciler{
+				Client: fakeClient,
+				WorkloadClient: func(context.Context, client.ObjectKey) (kubernetes.Interface, error) {
+					return workloadClient, nil
+				},
+			}
+
+			g.Expect(fakeClient.Delete(context.TODO(), kwokMachinePool)).To(Succeed())
+			res, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokMachinePool)})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(res.RequeueAfter > 0).To(Equal(tc.expectWait))
+
+			_, err = workloadClient.CoreV1().Nodes().Get(context.TODO(), node.Name, metav1.GetOptions{})
+			if tc.expectNodeExists {
+				g.Expect(err).NotTo(HaveOccurred())
+			} else {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			}
+			err = fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokMachinePool), &infrav1.KwokMachinePool{})
+			g.Expect(apierrors.IsNotFound(err)).To(Equal(!tc.expectWait))
+		})
+	}
+}
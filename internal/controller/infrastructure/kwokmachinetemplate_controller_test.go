@@ -0,0 +1,100 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+func TestKwokMachineTemplateReconcile(t *testing.T) {
+	testCases := []struct {
+		name           string
+		node           *infrav1.NodeShape
+		expectCapacity corev1.ResourceList
+	}{
+		{
+			name: "reports the default capacity",
+			expectCapacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("16Gi"),
+				corev1.ResourcePods:   resource.MustParse("110"),
+			},
+		},
+		{
+			name: "reports the capacity of the node shape",
+			node: &infrav1.NodeShape{
+				Capacity: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("16"),
+					"example.com/gpu":     resource.MustParse("2"),
+					corev1.ResourceMemory: resource.MustParse("64Gi"),
+				},
+			},
+			expectCapacity: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("16"),
+				corev1.ResourceMemory: resource.MustParse("64Gi"),
+				corev1.ResourcePods:   resource.MustParse("110"),
+				"example.com/gpu":     resource.MustParse("2"),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			kwokMachineTemplate := &infrav1.KwokMachineTemplate{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-template",
+					Namespace: "default",
+				},
+				Spec: infrav1.KwokMachineTemplateSpec{
+					Template: infrav1.KwokMachineTemplateResource{
+						Spec: infrav1.KwokMachineSpec{Node: tc.node},
+					},
+				},
+			}
+
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(kwokMachineTemplate).
+				Build()
+
+			r := &KwokMachineTemplateReconciler{Client: fakeClient}
+			_, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(kwokMachineTemplate)})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			latest := &infrav1.KwokMachineTemplate{}
+			g.Expect(fakeClient.Get(context.TODO(), client.ObjectKeyFromObject(kwokMachineTemplate), latest)).To(Succeed())
+			g.Expect(latest.Status.Capacity).To(HaveLen(len(tc.expectCapacity)))
+			for name, quantity := range tc.expectCapacity {
+				g.Expect(latest.Status.Capacity[name].Equal(quantity)).To(BeTrue(), "capacity of %s", name)
+			}
+		})
+	}
+}
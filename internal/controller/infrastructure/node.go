@@ -0,0 +1,184 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+const (
+	// providerIDPrefix is the prefix of the provider IDs of the fake Nodes.
+	providerIDPrefix = "kwok://"
+
+	// fakeNodeAnnotation marks the Nodes managed by the kwok controller of the cluster.
+	fakeNodeAnnotation = "kwok.x-k8s.io/node"
+
+	// controlPlaneWaitInterval is how often the deletion of Nodes checks whether the control
+	// plane is ready again.
+	controlPlaneWaitInterval = 10 * time.Second
+)
+
+// providerID returns the provider ID of the fake Node of a KwokMachine or of an instance of a
+// KwokMachinePool.
+func providerID(namespace, name string) string {
+	return fmt.Sprintf("%s%s/%s", providerIDPrefix, namespace, name)
+}
+
+// newFakeNode returns a Node of the given shape to register in the kwok cluster. The fake node
+// annotation hands the Node over to the kwok controller, which keeps its status up to date.
+func newFakeNode(name, providerID, kubeletVersion string, shape *infrav1.NodeShape) *corev1.Node {
+	nodeInfo := corev1.NodeSystemInfo{
+		OperatingSystem: "linux",
+		Architecture:    "amd64",
+		KubeletVersion:  kubeletVersion,
+	}
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Spec: corev1.NodeSpec{
+			ProviderID: providerID,
+		},
+		Status: corev1.NodeStatus{
+			Capacity:    shape.GetCapacity(),
+			Allocatable: shape.GetAllocatable(),
+		},
+	}
+
+	if shape != nil {
+		if shape.NodeInfo != nil {
+			nodeInfo.KernelVersion = shape.NodeInfo.KernelVersion
+			if shape.NodeInfo.OperatingSystem != "" {
+				nodeInfo.OperatingSystem = shape.NodeInfo.OperatingSystem
+			}
+			if shape.NodeInfo.Architecture != "" {
+				nodeInfo.Architecture = shape.NodeInfo.Architecture
+			}
+			if shape.NodeInfo.KubeletVersion != "" {
+				nodeInfo.KubeletVersion = shape.NodeInfo.KubeletVersion
+			}
+		}
+		for k, v := range shape.Annotations {
+			node.Annotations[k] = v
+		}
+		node.Spec.Taints = append(node.Spec.Taints, shape.Taints...)
+	}
+
+	node.Labels[corev1.LabelHostname] = name
+	node.Labels[corev1.LabelOSStable] = nodeInfo.OperatingSystem
+	node.Labels[corev1.LabelArchStable] = nodeInfo.Architecture
+	if shape != nil {
+		for k, v := range shape.Labels {
+			node.Labels[k] = v
+		}
+	}
+	node.Annotations[fakeNodeAnnotation] = "fake"
+	node.Status.NodeInfo = nodeInfo
+
+	return node
+}
+
+// validateNodeShape checks the extended resources of a node shape are whole numbers, as the API
+// server rejects Nodes with fractional extended resources.
+func validateNodeShape(shape *infrav1.NodeShape) error {
+	if shape == nil {
+		return nil
+	}
+	for _, resources := range []corev1.ResourceList{shape.Capacity, shape.Allocatable} {
+		for name, quantity := range resources {
+			if isExtendedResourceName(name) && quantity.MilliValue()%1000 != 0 {
+				return fmt.Errorf("extended resource %q must be a whole number, got %s", name, quantity.String())
+			}
+		}
+	}
+	return nil
+}
+
+// isExtendedResourceName returns whether a resource is an extended resource, i.e. a resource
+// with a domain outside of kubernetes.io.
+func isExtendedResourceName(name corev1.ResourceName) bool {
+	return strings.Contains(string(name), "/") && !strings.Contains(string(name), corev1.ResourceDefaultNamespacePrefix)
+}
+
+// workloadClusterState returns why the kwok cluster of a Cluster can't be reached. goneReason is
+// set when the Cluster or its control plane is gone, and the Nodes go along with the kwok cluster.
+// notReadyReason is set while the control plane is not ready, e.g. while it is restored, upgraded
+// or hibernated, and keeps its Nodes. Both are empty when the kwok cluster is ready.
+func workloadClusterState(ctx context.Context, c client.Client, cluster *clusterv1.Cluster) (goneReason, notReadyReason string, err error) {
+	if !cluster.DeletionTimestamp.IsZero() {
+		return "Cluster is being deleted", "", nil
+	}
+	if !isKwokControlPlane(cluster.Spec.ControlPlaneRef) {
+		if !cluster.Status.ControlPlaneReady {
+			return "", "control plane is not ready", nil
+		}
+		return "", "", nil
+	}
+
+	controlPlane := &controlplanev1.KwokControlPlane{}
+	key := client.ObjectKey{Namespace: cluster.Spec.ControlPlaneRef.Namespace, Name: cluster.Spec.ControlPlaneRef.Name}
+	if key.Namespace == "" {
+		key.Namespace = cluster.Namespace
+	}
+	if err := c.Get(ctx, key, controlPlane); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "control plane is gone", "", nil
+		}
+		return "", "", fmt.Errorf("failed to get control plane: %w", err)
+	}
+
+	switch {
+	case !controlPlane.DeletionTimestamp.IsZero():
+		return "control plane is being deleted", "", nil
+	case controlPlane.Spec.Hibernate || controlPlane.Status.Hibernated:
+		return "", "control plane is hibernated", nil
+	case !controlPlane.Status.Ready || !cluster.Status.ControlPlaneReady:
+		return "", "control plane is not ready", nil
+	}
+	return "", "", nil
+}
+
+// workloadClientFromKubeconfig returns a client of the kwok cluster of a Cluster, built from the
+// kubeconfig Secret of the Cluster.
+func workloadClientFromKubeconfig(ctx context.Context, c client.Client, cluster client.ObjectKey) (kubernetes.Interface, error) {
+	data, err := kubeconfig.FromSecret(ctx, c, cluster)
+	if err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.RESTConfigFromKubeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create REST configuration: %w", err)
+	}
+	return kubernetes.NewForConfig(config)
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+func TestNewFakeNode(t *testing.T) {
+	g := NewWithT(t)
+
+	shape := &infrav1.NodeShape{
+		Capacity: corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("8"),
+			"example.com/gpu":  resource.MustParse("4"),
+		},
+		Allocatable: corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("7500m"),
+		},
+		Labels: map[string]string{
+			"node.kubernetes.io/instance-type": "gpu.large",
+			corev1.LabelArchStable:             "custom",
+		},
+		Annotations: map[string]string{"example.com/owner": "team-a"},
+		Taints: []corev1.Taint{{
+			Key:    "example.com/gpu",
+			Effect: corev1.TaintEffectNoSchedule,
+		}},
+		NodeInfo: &infrav1.NodeInfo{
+			Architecture:  "arm64",
+			KernelVersion: "5.15.0",
+		},
+	}
+
+	node := newFakeNode("test-node", "kwok://default/test-node", "v1.27.1", shape)
+
+	g.Expect(node.Labels).To(Equal(map[string]string{
+		corev1.LabelHostname:               "test-node",
+		corev1.LabelOSStable:               "linux",
+		corev1.LabelArchStable:             "custom",
+		"node.kubernetes.io/instance-type": "gpu.large",
+	}))
+	g.Expect(node.Annotations).To(Equal(map[string]string{
+		fakeNodeAnnotation:  "fake",
+		"example.com/owner": "team-a",
+	}))
+	g.Expect(node.Spec.Taints).To(Equal(shape.Taints))
+	g.Expect(node.Status.NodeInfo).To(Equal(corev1.NodeSystemInfo{
+		OperatingSystem: "linux",
+		Architecture:    "arm64",
+		KernelVersion:   "5.15.0",
+		KubeletVersion:  "v1.27.1",
+	}))
+	g.Expect(node.Status.Capacity.Cpu().String()).To(Equal("8"))
+	g.Expect(node.Status.Capacity.Pods().String()).To(Equal("110"))
+	g.Expect(node.Status.Allocatable.Cpu().String()).To(Equal("7500m"))
+	g.Expect(node.Status.Allocatable.Memory().String()).To(Equal("16Gi"))
+	g.Expect(node.Status.Allocatable).To(HaveKey(corev1.ResourceName("example.com/gpu")))
+}
+
+func TestValidateNodeShape(t *testing.T) {
+	testCases := []struct {
+		name      string
+		shape     *infrav1.NodeShape
+		expectErr bool
+	}{
+		{
+			name: "no shape",
+		},
+		{
+			name: "whole extended resources and fractional cpu",
+			shape: &infrav1.NodeShape{
+				Capacity:    corev1.ResourceList{"example.com/gpu": resource.MustParse("2")},
+				Allocatable: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("500m")},
+			},
+		},
+		{
+			name: "fractional extended resource capacity",
+			shape: &infrav1.NodeShape{
+				Capacity: corev1.ResourceList{"example.com/gpu": resource.MustParse("1.5")},
+			},
+			expectErr: true,
+		},
+		{
+			name: "fractional extended resource allocatable",
+			shape: &infrav1.NodeShape{
+				Allocatable: corev1.ResourceList{"example.com/fpga": resource.MustParse("100m")},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := validateNodeShape(tc.shape)
+			if tc.expectErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+		})
+	}
+}
+
+func TestWorkloadClusterState(t *testing.T) {
+	now := metav1.Now()
+
+	testCases := []struct {
+		name           string
+		cluster        func(*clusterv1.Cluster)
+		controlPlane   func(*controlplanev1.KwokControlPlane)
+		noControlPlane bool
+		expectSkip     bool
+		expectWait     bool
+	}{
+		{
+			name: "deletes the nodes of a ready cluster",
+		},
+		{
+			name: "skips when the cluster is being deleted",
+			cluster: func(c *clusterv1.Cluster) {
+				c.DeletionTimestamp = &now
+				c.Finalizers = []string{clusterv1.ClusterFinalizer}
+			},
+			expectSkip: true,
+		},
+		{
+			name:       "waits when the control plane of the cluster is not ready",
+			cluster:    func(c *clusterv1.Cluster) { c.Status.ControlPlaneReady = false },
+			expectWait: true,
+		},
+		{
+			name:           "skips when the control plane is gone",
+			noControlPlane: true,
+			expectSkip:     true,
+		},
+		{
+			name: "skips when the control plane is being deleted",
+			controlPlane: func(cp *controlplanev1.KwokControlPlane) {
+				cp.DeletionTimestamp = &now
+				cp.Finalizers = []string{controlplanev1.KwokControlPlaneFinalizer}
+			},
+			expectSkip: true,
+		},
+		{
+			name:         "waits when the control plane is hibernated",
+			controlPlane: func(cp *controlplanev1.KwokControlPlane) { cp.Spec.Hibernate = true },
+			expectWait:   true,
+		},
+		{
+			name:         "waits when the control plane is not ready",
+			controlPlane: func(cp *controlplanev1.KwokControlPlane) { cp.Status.Ready = false },
+			expectWait:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster, controlPlane := newTestReadyCluster("test")
+			if tc.cluster != nil {
+				tc.cluster(cluster)
+			}
+			if tc.controlPlane != nil {
+				tc.controlPlane(controlPlane)
+			}
+			objs := []client.Object{cluster}
+			if !tc.noControlPlane {
+				objs = append(objs, controlPlane)
+			}
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(newTestScheme(g)).
+				WithObjects(objs...).
+				Build()
+
+			skipReason, waitReason, err := workloadClusterState(context.TODO(), fakeClient, cluster)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(skipReason != "").To(Equal(tc.expectSkip))
+			g.Expect(waitReason != "").To(Equal(tc.expectWait))
+		})
+	}
+}
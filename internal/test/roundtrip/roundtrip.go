@@ -0,0 +1,69 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package roundtrip checks the API types of the provider survive serialization.
+package roundtrip
+
+import (
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/apitesting/fuzzer"
+	apiroundtrip "k8s.io/apimachinery/pkg/api/apitesting/roundtrip"
+	metafuzzer "k8s.io/apimachinery/pkg/apis/meta/fuzzer"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+)
+
+// seedEnv overrides the seed of the fuzzer, to reproduce a failure.
+const seedEnv = "ROUNDTRIP_SEED"
+
+// RunForGroupVersion fuzzes every type of a group version and checks it survives a JSON and
+// YAML round trip, and a deep copy, without losing any field. The seed of the fuzzer is logged
+// and can be set through ROUNDTRIP_SEED to reproduce a failure.
+func RunForGroupVersion(t *testing.T, addToScheme func(*runtime.Scheme) error, gv schema.GroupVersion) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := addToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := time.Now().UnixNano()
+	if v := os.Getenv(seedEnv); v != "" {
+		var err error
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			t.Fatalf("invalid %s %q: %v", seedEnv, v, err)
+		}
+	}
+	t.Logf("fuzzing with %s=%d", seedEnv, seed)
+
+	codecs := serializer.NewCodecFactory(scheme)
+	f := fuzzer.FuzzerFor(metafuzzer.Funcs, rand.NewSource(seed), codecs)
+
+	for kind := range scheme.KnownTypes(gv) {
+		if apiroundtrip.GlobalNonRoundTrippableTypes().Has(kind) {
+			continue
+		}
+		t.Run(kind, func(t *testing.T) {
+			apiroundtrip.RoundTripSpecificKindWithoutProtobuf(t, gv.WithKind(kind), scheme, codecs, f, nil)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testenv sets up test environments running the CRDs of the provider along with the
+// ones of Cluster API, for the integration suites of the controllers.
+package testenv
+
+import (
+	"errors"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+
+	bootstrapv1 "github.com/capi-samples/cluster-api-provider-kwok/api/bootstrap/v1beta1"
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+const clusterAPIModule = "sigs.k8s.io/cluster-api"
+
+// SkipReason is set when the binaries of the test environment are not installed, in which
+// case the suites are skipped. `make test` installs them.
+func SkipReason() string {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		return "KUBEBUILDER_ASSETS is not set, run the integration suites with make test"
+	}
+	return ""
+}
+
+// New returns a test environment installing the CRDs of the provider, found under root, the
+// root of the repository, and the CRDs of the Cluster API version the provider builds with.
+func New(root string) (*envtest.Environment, error) {
+	capiCRDs, err := clusterAPICRDPath()
+	if err != nil {
+		return nil, err
+	}
+
+	return &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join(root, "config", "crd", "bases"),
+			capiCRDs,
+		},
+		ErrorIfCRDPathMissing: true,
+		Scheme:                Scheme(),
+	}, nil
+}
+
+// Scheme returns a scheme with the types of Kubernetes, Cluster API and the provider.
+func Scheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+	_ = bootstrapv1.AddToScheme(scheme)
+	_ = controlplanev1.AddToScheme(scheme)
+	_ = infrav1.AddToScheme(scheme)
+	return scheme
+}
+
+// clusterAPICRDPath returns the directory of the CRDs of Cluster API in the module cache.
+func clusterAPICRDPath() (string, error) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", errors.New("reading build info")
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path != clusterAPIModule {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+
+		modCache := os.Getenv("GOMODCACHE")
+		if modCache == "" {
+			modCache = filepath.Join(build.Default.GOPATH, "pkg", "mod")
+		}
+		return filepath.Join(modCache, dep.Path+"@"+dep.Version, "config", "crd", "bases"), nil
+	}
+
+	return "", fmt.Errorf("module %s not found in build info", clusterAPIModule)
+}
@@ -32,14 +32,15 @@ import (
 	"k8s.io/klog/v2/klogr"
 	"k8s.io/utils/pointer"
 
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
 	_ "sigs.k8s.io/kwok/pkg/kwokctl/runtime/binary"
 	_ "sigs.k8s.io/kwok/pkg/kwokctl/runtime/compose"
@@ -48,14 +49,22 @@ import (
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	expclusterv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 
-	bootstrapv1 "github.com/capi-samples/cluster-api-provider-kwok/api/bootstrap/v1alpha1"
-	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1alpha1"
-	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1alpha1"
+	bootstrapv1alpha1 "github.com/capi-samples/cluster-api-provider-kwok/api/bootstrap/v1alpha1"
+	bootstrapv1 "github.com/capi-samples/cluster-api-provider-kwok/api/bootstrap/v1beta1"
+	controlplanev1alpha1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1alpha1"
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1alpha1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1alpha1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
 
-	//bootstrapcontroller "github.com/capi-samples/cluster-api-provider-kwok/internal/controller/bootstrap"
+	bootstrapcontroller "github.com/capi-samples/cluster-api-provider-kwok/internal/controller/bootstrap"
 	controlplanecontroller "github.com/capi-samples/cluster-api-provider-kwok/internal/controller/controlplane"
 	infracontroller "github.com/capi-samples/cluster-api-provider-kwok/internal/controller/infrastructure"
 	"github.com/capi-samples/cluster-api-provider-kwok/pkg/consts"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/gc"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/kwokctl"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/simulated"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -72,20 +81,46 @@ var (
 	watchFilterValue            string
 	profilerAddress             string
 	syncPeriod                  time.Duration
-	//webhookPort                 int
-	//webhookCertDir              string
-	healthAddr string
+	webhookPort                 int
+	webhookCertDir              string
+	healthAddr                  string
 
 	controlPlaneConcurrency int
 	clusterConcurrency      int
 	machineConcurrency      int
+	machinePoolConcurrency  int
+	configConcurrency       int
+
+	restConfigQPS        float32
+	restConfigBurst      int
+	rateLimiterBaseDelay time.Duration
+	rateLimiterMaxDelay  time.Duration
+
+	createTimeout        time.Duration
+	startTimeout         time.Duration
+	stopTimeout          time.Duration
+	deleteTimeout        time.Duration
+	snapshotTimeout      time.Duration
+	upgradeTimeout       time.Duration
+	migrateTimeout       time.Duration
+	operationMaxAttempts int32
+	operationBaseDelay   time.Duration
+	operationMaxDelay    time.Duration
+
+	gcWorkDirs    []string
+	gcInterval    time.Duration
+	gcGracePeriod time.Duration
+	gcDryRun      bool
 )
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(infrav1alpha1.AddToScheme(scheme))
 	utilruntime.Must(infrav1.AddToScheme(scheme))
+	utilruntime.Must(controlplanev1alpha1.AddToScheme(scheme))
 	utilruntime.Must(controlplanev1.AddToScheme(scheme))
+	utilruntime.Must(bootstrapv1alpha1.AddToScheme(scheme))
 	utilruntime.Must(bootstrapv1.AddToScheme(scheme))
 	utilruntime.Must(clusterv1.AddToScheme(scheme))
 	utilruntime.Must(expclusterv1.AddToScheme(scheme))
@@ -121,16 +156,77 @@ func initFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&clusterConcurrency, "cluster-concurrency", 1,
 		"Number of cluster resources to process simultaneously")
 
-	fs.IntVar(&clusterConcurrency, "machine-concurrency", 1,
+	fs.IntVar(&machineConcurrency, "machine-concurrency", 1,
 		"Number of machine resources to process simultaneously")
 
+	fs.IntVar(&machinePoolConcurrency, "machinepool-concurrency", 1,
+		"Number of machine pool resources to process simultaneously")
+
+	fs.IntVar(&configConcurrency, "config-concurrency", 1,
+		"Number of bootstrap config resources to process simultaneously")
+
+	fs.Float32Var(&restConfigQPS, "kube-api-qps", consts.DefaultKubeAPIQPS,
+		"Maximum queries per second from the controller client to the Kubernetes API server")
+
+	fs.IntVar(&restConfigBurst, "kube-api-burst", consts.DefaultKubeAPIBurst,
+		"Maximum number of queries that should be allowed in one burst from the controller client to the Kubernetes API server")
+
+	fs.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", consts.DefaultRateLimiterBaseDelay,
+		"Delay before requeueing an object whose reconcile failed, doubled with every failure")
+
+	fs.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", consts.DefaultRateLimiterMaxDelay,
+		"Maximum delay before requeueing an object whose reconcile failed")
+
+	fs.DurationVar(&createTimeout, "runtime-create-timeout", consts.DefaultCreateTimeout,
+		"Timeout for creating a cluster in the kwok runtime")
+
+	fs.DurationVar(&startTimeout, "runtime-start-timeout", consts.DefaultStartTimeout,
+		"Timeout for starting the components of a cluster in the kwok runtime")
+
+	fs.DurationVar(&stopTimeout, "runtime-stop-timeout", consts.DefaultStopTimeout,
+		"Timeout for stopping the components of a cluster in the kwok runtime")
+
+	fs.DurationVar(&deleteTimeout, "runtime-delete-timeout", consts.DefaultDeleteTimeout,
+		"Timeout for deleting a cluster from the kwok runtime")
+
+	fs.DurationVar(&snapshotTimeout, "runtime-snapshot-timeout", consts.DefaultSnapshotTimeout,
+		"Timeout for saving or restoring an etcd snapshot of a cluster in the kwok runtime")
+
+	fs.DurationVar(&upgradeTimeout, "runtime-upgrade-timeout", consts.DefaultUpgradeTimeout,
+		"Timeout for upgrading a cluster in the kwok runtime to a new Kubernetes version")
+
+	fs.DurationVar(&migrateTimeout, "runtime-migrate-timeout", consts.DefaultMigrateTimeout,
+		"Timeout for migrating a cluster in the kwok runtime from the legacy working directory layout")
+
+	fs.Int32Var(&operationMaxAttempts, "runtime-operation-max-attempts", consts.DefaultOperationMaxAttempts,
+		"Number of attempts of a kwok runtime operation before its failure is considered terminal. Set to 0 to retry forever")
+
+	fs.DurationVar(&operationBaseDelay, "runtime-operation-base-delay", consts.DefaultOperationBaseDelay,
+		"Delay before retrying a failed kwok runtime operation, doubled with every failed attempt")
+
+	fs.DurationVar(&operationMaxDelay, "runtime-operation-max-delay", consts.DefaultOperationMaxDelay,
+		"Maximum delay between retries of a failed kwok runtime operation")
+
+	fs.StringSliceVar(&gcWorkDirs, "gc-work-dirs", []string{consts.DefaultWorkDir},
+		"Working directories searched for orphaned kwok clusters, on top of the ones of the existing KwokClusters")
+
+	fs.DurationVar(&gcInterval, "gc-interval", consts.DefaultGCInterval,
+		"Interval between garbage collections of orphaned kwok clusters. Set to 0 to disable garbage collection")
+
+	fs.DurationVar(&gcGracePeriod, "gc-grace-period", consts.DefaultGCGracePeriod,
+		"Time a kwok cluster must stay orphaned before it is garbage collected")
+
+	fs.BoolVar(&gcDryRun, "gc-dry-run", false,
+		"Only report orphaned kwok clusters, without deleting them")
+
 	fs.DurationVar(&syncPeriod, "sync-period", consts.DefaultSyncPeriod,
 		"The minimum interval at which watched resources are reconciled (e.g. 15m)")
 
-	// fs.IntVar(&webhookPort, "webhook-port", consts.DefaultWebhookPort, "Webhook Server port")
+	fs.IntVar(&webhookPort, "webhook-port", consts.DefaultWebhookPort,
+		"Webhook Server port")
 
-	// fs.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
-	// 	"Webhook cert dir, only used when webhook-port is specified.")
+	fs.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
+		"Webhook cert dir, only used when webhook-port is specified.")
 
 	fs.StringVar(&healthAddr, "health-addr", ":9440",
 		"The address the health endpoint binds to.")
@@ -152,7 +248,11 @@ func main() {
 		}()
 	}
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	restConfig := ctrl.GetConfigOrDie()
+	restConfig.QPS = restConfigQPS
+	restConfig.Burst = restConfigBurst
+
+	mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
 		Scheme:             scheme,
 		MetricsBindAddress: metricsBindAddr,
 		LeaderElection:     enableLeaderElection,
@@ -166,8 +266,8 @@ func main() {
 			&corev1.ConfigMap{},
 		},
 		HealthProbeBindAddress: healthAddr,
-		//Port
-		//CertDir
+		Port:                   webhookPort,
+		CertDir:                webhookCertDir,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -175,8 +275,10 @@ func main() {
 	}
 
 	setupProbes(mgr)
-	setupReconcilers(ctx, mgr)
-	//setupWebhooks(mgr)
+	backend := services.MultiBackend{simulated.New(), kwokctl.New()}
+	setupReconcilers(ctx, mgr, backend)
+	setupGarbageCollector(mgr, backend)
+	setupWebhooks(mgr)
 
 	setupLog.Info("starting manager")
 
@@ -187,44 +289,160 @@ func main() {
 }
 
 func setupProbes(mgr ctrl.Manager) {
-	//TODO: change to webhook ports when we have them
-	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
+	if err := mgr.AddHealthzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
 }
 
-func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
+// operationTimeouts returns the timeouts of the kwok runtime operations, by operation type.
+func operationTimeouts() map[string]time.Duration {
+	return map[string]time.Duration{
+		string(controlplanev1.OperationTypeCreate):   createTimeout,
+		string(controlplanev1.OperationTypeStart):    startTimeout,
+		string(controlplanev1.OperationTypeStop):     stopTimeout,
+		string(controlplanev1.OperationTypeRestart):  startTimeout,
+		string(controlplanev1.OperationTypeDelete):   deleteTimeout,
+		string(controlplanev1.OperationTypeRestore):  snapshotTimeout,
+		string(controlplanev1.OperationTypeUpgrade):  upgradeTimeout,
+		string(controlplanev1.OperationTypeMigrate):  migrateTimeout,
+		controlplanecontroller.SnapshotOperationType: snapshotTimeout,
+	}
+}
+
+func setupReconcilers(ctx context.Context, mgr ctrl.Manager, backend services.Backend) {
+	operations := operation.NewTracker(ctx, operation.Options{
+		Timeouts: operationTimeouts(),
+		Retry: operation.RetryPolicy{
+			MaxAttempts: operationMaxAttempts,
+			BaseDelay:   operationBaseDelay,
+			MaxDelay:    operationMaxDelay,
+		},
+	})
+
 	if err := (&infracontroller.KwokClusterReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(ctx, mgr, controller.Options{MaxConcurrentReconciles: clusterConcurrency, RecoverPanic: pointer.Bool(true)}); err != nil {
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+		Backend:          backend,
+	}).SetupWithManager(ctx, mgr, controllerOptions(clusterConcurrency)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KwokCluster")
 		os.Exit(1)
 	}
-	//if err := (&infracontroller.KwokMachineReconciler{
-	// 	Client: mgr.GetClient(),
-	// 	Scheme: mgr.GetScheme(),
-	// }).SetupWithManager(mgr); err != nil {
-	// 	setupLog.Error(err, "unable to create controller", "controller", "KwokMachine")
-	// 	os.Exit(1)
-	// }
+	if err := (&infracontroller.KwokMachineReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(ctx, mgr, controllerOptions(machineConcurrency)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KwokMachine")
+		os.Exit(1)
+	}
+	if err := (&infracontroller.KwokMachineTemplateReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(ctx, mgr, controllerOptions(machineConcurrency)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KwokMachineTemplate")
+		os.Exit(1)
+	}
+	if err := (&infracontroller.KwokMachinePoolReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(ctx, mgr, controllerOptions(machinePoolConcurrency)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KwokMachinePool")
+		os.Exit(1)
+	}
 	if err := (&controlplanecontroller.KwokControlPlaneReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(ctx, mgr, controller.Options{MaxConcurrentReconciles: controlPlaneConcurrency, RecoverPanic: pointer.Bool(true)}); err != nil {
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+		Operations:       operations,
+		Backend:          backend,
+	}).SetupWithManager(ctx, mgr, controllerOptions(controlPlaneConcurrency)); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KwokControlPlane")
 		os.Exit(1)
 	}
-	// if err := (&bootstrapcontroller.KwokConfigReconciler{
-	// 	Client: mgr.GetClient(),
-	// 	Scheme: mgr.GetScheme(),
-	// }).SetupWithManager(mgr); err != nil {
-	// 	setupLog.Error(err, "unable to create controller", "controller", "KwokConfig")
-	// 	os.Exit(1)
-	// }
+	if err := (&controlplanecontroller.KwokClusterSnapshotReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+		Operations:       operations,
+		Backend:          backend,
+	}).SetupWithManager(ctx, mgr, controllerOptions(controlPlaneConcurrency)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KwokClusterSnapshot")
+		os.Exit(1)
+	}
+	if err := (&bootstrapcontroller.KwokConfigReconciler{
+		Client:           mgr.GetClient(),
+		Scheme:           mgr.GetScheme(),
+		WatchFilterValue: watchFilterValue,
+	}).SetupWithManager(ctx, mgr, controllerOptions(configConcurrency)); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KwokConfig")
+		os.Exit(1)
+	}
+}
+
+func setupGarbageCollector(mgr ctrl.Manager, backend services.Backend) {
+	if gcInterval <= 0 {
+		setupLog.Info("Garbage collection of orphaned clusters is disabled")
+		return
+	}
+
+	if err := mgr.Add(gc.NewCollector(mgr.GetClient(), gc.Options{
+		WorkDirs:    gcWorkDirs,
+		Interval:    gcInterval,
+		GracePeriod: gcGracePeriod,
+		DryRun:      gcDryRun,
+		Backend:     backend,
+	})); err != nil {
+		setupLog.Error(err, "unable to add garbage collector")
+		os.Exit(1)
+	}
+}
+
+// setupWebhooks registers the webhooks, which serve the conversion between the API versions.
+func setupWebhooks(mgr ctrl.Manager) {
+	if err := (&infrav1.KwokCluster{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "KwokCluster")
+		os.Exit(1)
+	}
+	if err := (&infrav1.KwokMachine{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "KwokMachine")
+		os.Exit(1)
+	}
+	if err := (&infrav1.KwokMachineTemplate{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "KwokMachineTemplate")
+		os.Exit(1)
+	}
+	if err := (&controlplanev1.KwokControlPlane{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "KwokControlPlane")
+		os.Exit(1)
+	}
+	if err := (&controlplanev1.KwokClusterSnapshot{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "KwokClusterSnapshot")
+		os.Exit(1)
+	}
+	if err := (&bootstrapv1.KwokConfig{}).SetupWebhookWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "KwokConfig")
+		os.Exit(1)
+	}
+}
+
+// controllerOptions returns the options of a controller processing concurrency objects at a time,
+// with the workqueue rate limiting configured by flags.
+func controllerOptions(concurrency int) controller.Options {
+	return controller.Options{
+		MaxConcurrentReconciles: concurrency,
+		RecoverPanic:            pointer.Bool(true),
+		RateLimiter: workqueue.NewMaxOfRateLimiter(
+			workqueue.NewItemExponentialFailureRateLimiter(rateLimiterBaseDelay, rateLimiterMaxDelay),
+			// The overall rate limit of the default controller-runtime rate limiter.
+			&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		),
+	}
 }
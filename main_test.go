@@ -0,0 +1,66 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/consts"
+)
+
+func TestOperationTimeouts(t *testing.T) {
+	testCases := []struct {
+		name   string
+		args   []string
+		opType controlplanev1.OperationType
+		expect time.Duration
+	}{
+		{
+			name:   "upgrades with the default timeout",
+			opType: controlplanev1.OperationTypeUpgrade,
+			expect: consts.DefaultUpgradeTimeout,
+		},
+		{
+			name:   "upgrades with the configured timeout",
+			args:   []string{"--runtime-upgrade-timeout=1h"},
+			opType: controlplanev1.OperationTypeUpgrade,
+			expect: time.Hour,
+		},
+		{
+			name:   "migrates with the default timeout",
+			opType: controlplanev1.OperationTypeMigrate,
+			expect: consts.DefaultMigrateTimeout,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			initFlags(fs)
+			g.Expect(fs.Parse(tc.args)).To(Succeed())
+
+			g.Expect(operationTimeouts()).To(HaveKeyWithValue(string(tc.opType), tc.expect))
+		})
+	}
+}
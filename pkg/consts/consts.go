@@ -38,4 +38,63 @@ const (
 
 	// DefaultSyncPeriod is the default resync period for the controller manager's cache.
 	DefaultSyncPeriod = 10 * time.Minute
+
+	// DefaultWorkDir is the default working directory of the kwok runtimes.
+	DefaultWorkDir = "/kwok"
+
+	// DefaultGCInterval is the default interval between garbage collections of orphaned clusters.
+	DefaultGCInterval = 5 * time.Minute
+
+	// DefaultGCGracePeriod is the default time a cluster must stay orphaned before it is
+	// garbage collected.
+	DefaultGCGracePeriod = 10 * time.Minute
+
+	// DefaultKubeAPIQPS is the default maximum queries per second from the controller client
+	// to the Kubernetes API server.
+	DefaultKubeAPIQPS = 20
+
+	// DefaultKubeAPIBurst is the default maximum burst of queries from the controller client
+	// to the Kubernetes API server.
+	DefaultKubeAPIBurst = 30
+
+	// DefaultRateLimiterBaseDelay is the default delay before requeueing an object whose
+	// reconcile failed.
+	DefaultRateLimiterBaseDelay = 5 * time.Millisecond
+
+	// DefaultRateLimiterMaxDelay is the default maximum delay before requeueing an object whose
+	// reconcile failed.
+	DefaultRateLimiterMaxDelay = 1000 * time.Second
+
+	// DefaultCreateTimeout is the default timeout for creating a cluster in the kwok runtime.
+	DefaultCreateTimeout = 10 * time.Minute
+
+	// DefaultStartTimeout is the default timeout for starting the components of a cluster.
+	DefaultStartTimeout = 10 * time.Minute
+
+	// DefaultStopTimeout is the default timeout for stopping the components of a cluster.
+	DefaultStopTimeout = 5 * time.Minute
+
+	// DefaultDeleteTimeout is the default timeout for deleting a cluster from the kwok runtime.
+	DefaultDeleteTimeout = 5 * time.Minute
+
+	// DefaultSnapshotTimeout is the default timeout for saving or restoring an etcd snapshot.
+	DefaultSnapshotTimeout = 5 * time.Minute
+
+	// DefaultUpgradeTimeout is the default timeout for upgrading a cluster, which is installed
+	// again with the new version and gets its etcd snapshot back.
+	DefaultUpgradeTimeout = 30 * time.Minute
+
+	// DefaultMigrateTimeout is the default timeout for migrating a cluster from the legacy
+	// working directory layout, which is installed again and gets its etcd snapshot back.
+	DefaultMigrateTimeout = 30 * time.Minute
+
+	// DefaultOperationMaxAttempts is the default number of attempts of a runtime operation before
+	// its failure is considered terminal.
+	DefaultOperationMaxAttempts = 5
+
+	// DefaultOperationBaseDelay is the default delay before retrying a failed runtime operation.
+	DefaultOperationBaseDelay = 10 * time.Second
+
+	// DefaultOperationMaxDelay is the default maximum delay between retries of a runtime operation.
+	DefaultOperationMaxDelay = 5 * time.Minute
 )
@@ -0,0 +1,240 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gc garbage collects kwok clusters left behind when their KwokControlPlane is gone
+// without the cluster being deleted, e.g. when the finalizer was removed by hand.
+package gc
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/lock"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// Options configures a Collector.
+type Options struct {
+	// WorkDirs are the working directories searched for clusters, on top of the ones of the
+	// existing KwokClusters.
+	WorkDirs []string
+
+	// Interval is the interval between garbage collections.
+	Interval time.Duration
+
+	// GracePeriod is how long a cluster must stay orphaned before it is deleted.
+	GracePeriod time.Duration
+
+	// DryRun only reports the orphaned clusters, without deleting them.
+	DryRun bool
+
+	// Backend deletes the orphaned clusters.
+	Backend services.Backend
+}
+
+// Collector periodically deletes the kwok clusters whose ownership marker points to a
+// KwokControlPlane that no longer exists.
+type Collector struct {
+	client  client.Reader
+	options Options
+
+	// firstSeen is when each orphaned cluster, keyed by its working directory, was first found.
+	firstSeen map[string]time.Time
+
+	now       func() time.Time
+	uninstall func(ctx context.Context, root, name string) error
+}
+
+// NewCollector creates a new garbage collector.
+func NewCollector(c client.Reader, options Options) *Collector {
+	collector := &Collector{
+		client:    c,
+		options:   options,
+		firstSeen: map[string]time.Time{},
+		now:       time.Now,
+	}
+	collector.uninstall = collector.uninstallCluster
+	return collector
+}
+
+// Start runs the garbage collection every interval until ctx is done.
+func (c *Collector) Start(ctx context.Context) error {
+	logger := ctrl.LoggerFrom(ctx).WithName("gc")
+	ctx = ctrl.LoggerInto(ctx, logger)
+
+	logger.Info("Starting garbage collector", "interval", c.options.Interval, "gracePeriod", c.options.GracePeriod, "dryRun", c.options.DryRun)
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.Collect(ctx); err != nil {
+			logger.Error(err, "Garbage collection failed")
+		}
+	}, c.options.Interval)
+
+	return nil
+}
+
+// NeedLeaderElection makes sure only the leader garbage collects clusters.
+func (c *Collector) NeedLeaderElection() bool {
+	return true
+}
+
+// Collect runs a garbage collection.
+func (c *Collector) Collect(ctx context.Context) error {
+	logger := ctrl.LoggerFrom(ctx)
+
+	roots, err := c.workDirs(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	seen := map[string]bool{}
+	for _, root := range roots {
+		names, err := c.options.Backend.List(scope.ClustersDir(root))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing clusters in %q: %w", root, err))
+			continue
+		}
+
+		for _, name := range names {
+			dir := scope.ClusterWorkDir(root, name)
+			log := logger.WithValues("cluster", name, "workDir", dir)
+
+			orphaned, err := c.isOrphaned(ctx, dir)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("checking cluster %q: %w", dir, err))
+				continue
+			}
+			if !orphaned {
+				continue
+			}
+			seen[dir] = true
+
+			firstSeen, ok := c.firstSeen[dir]
+			if !ok {
+				firstSeen = c.now()
+				c.firstSeen[dir] = firstSeen
+				log.Info("Found orphaned cluster")
+			}
+			if c.now().Sub(firstSeen) < c.options.GracePeriod {
+				continue
+			}
+
+			if c.options.DryRun {
+				log.Info("Orphaned cluster would be deleted, skipping in dry-run mode", "orphanedFor", c.now().Sub(firstSeen))
+				continue
+			}
+
+			log.Info("Deleting orphaned cluster", "orphanedFor", c.now().Sub(firstSeen))
+			if err := c.uninstall(ctx, root, name); err != nil {
+				errs = append(errs, fmt.Errorf("deleting cluster %q: %w", dir, err))
+				continue
+			}
+			delete(c.firstSeen, dir)
+			delete(seen, dir)
+			collectedClusters.Inc()
+		}
+	}
+
+	// Forget the clusters that are gone or were adopted again.
+	for dir := range c.firstSeen {
+		if !seen[dir] {
+			delete(c.firstSeen, dir)
+		}
+	}
+	orphanedClusters.Set(float64(len(c.firstSeen)))
+
+	collectionErrors.Add(float64(len(errs)))
+	return kerrors.NewAggregate(errs)
+}
+
+// workDirs returns the configured working directories along with the ones of all KwokClusters.
+func (c *Collector) workDirs(ctx context.Context) ([]string, error) {
+	kwokClusters := &infrav1.KwokClusterList{}
+	if err := c.client.List(ctx, kwokClusters); err != nil {
+		return nil, fmt.Errorf("listing KwokClusters: %w", err)
+	}
+
+	dirs := map[string]bool{}
+	for _, dir := range c.options.WorkDirs {
+		dirs[filepath.Clean(dir)] = true
+	}
+	for i := range kwokClusters.Items {
+		if dir := kwokClusters.Items[i].Spec.WorkingDir; dir != "" {
+			dirs[filepath.Clean(dir)] = true
+		}
+	}
+
+	roots := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		roots = append(roots, dir)
+	}
+	sort.Strings(roots)
+
+	return roots, nil
+}
+
+// isOrphaned returns true if the cluster in dir was created for a KwokControlPlane that no
+// longer exists. Clusters without an ownership marker were not created by the provider.
+func (c *Collector) isOrphaned(ctx context.Context, dir string) (bool, error) {
+	owner, err := ReadOwner(dir)
+	if err != nil || owner == nil {
+		return false, err
+	}
+
+	controlPlane := &controlplanev1.KwokControlPlane{}
+	if err := c.client.Get(ctx, client.ObjectKey{Namespace: owner.Namespace, Name: owner.Name}, controlPlane); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	// A KwokControlPlane recreated with the same name doesn't own the old cluster.
+	return controlPlane.UID != owner.UID, nil
+}
+
+func (c *Collector) uninstallCluster(ctx context.Context, root, name string) error {
+	l := lock.New(scope.ClusterLockPath(root, name))
+	if err := l.Lock(ctx); err != nil {
+		return fmt.Errorf("acquiring cluster lock: %w", err)
+	}
+	defer func() {
+		_ = l.Unlock()
+	}()
+
+	rt, err := c.options.Backend.Load(ctx, name, scope.ClusterWorkDir(root, name))
+	if err != nil {
+		return fmt.Errorf("loading cluster: %w", err)
+	}
+
+	if err := rt.Down(ctx); err != nil {
+		ctrl.LoggerFrom(ctx).Info("Failed to stop orphaned cluster, uninstalling it anyway", "cluster", name, "reason", err)
+	}
+
+	return rt.Delete(ctx)
+}
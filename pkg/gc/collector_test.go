@@ -0,0 +1,89 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/kwokctl"
+)
+
+func TestCollect(t *testing.T) {
+	g := NewWithT(t)
+
+	s := runtime.NewScheme()
+	g.Expect(infrav1.AddToScheme(s)).To(Succeed())
+	g.Expect(controlplanev1.AddToScheme(s)).To(Succeed())
+
+	root := t.TempDir()
+	newCluster := func(name string, owner *Owner) {
+		dir := scope.ClusterWorkDir(root, name)
+		g.Expect(os.MkdirAll(dir, 0o750)).To(Succeed())
+		if owner != nil {
+			g.Expect(WriteOwner(dir, *owner)).To(Succeed())
+		}
+	}
+
+	newCluster("owned", &Owner{Namespace: "default", Name: "owned", UID: "uid-owned"})
+	newCluster("orphaned", &Owner{Namespace: "default", Name: "orphaned", UID: "uid-orphaned"})
+	newCluster("replaced", &Owner{Namespace: "default", Name: "replaced", UID: "uid-old"})
+	newCluster("unmanaged", nil)
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(s).
+		WithObjects(
+			&controlplanev1.KwokControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "owned", UID: "uid-owned"}},
+			&controlplanev1.KwokControlPlane{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "replaced", UID: "uid-new"}},
+		).
+		Build()
+
+	now := time.Now()
+	var uninstalled []string
+
+	collector := NewCollector(fakeClient, Options{WorkDirs: []string{root}, GracePeriod: time.Minute, Backend: kwokctl.New()})
+	collector.now = func() time.Time { return now }
+	collector.uninstall = func(_ context.Context, _, name string) error {
+		uninstalled = append(uninstalled, name)
+		return nil
+	}
+
+	g.Expect(collector.Collect(context.Background())).To(Succeed())
+	g.Expect(uninstalled).To(BeEmpty(), "orphans are kept during the grace period")
+	g.Expect(collector.firstSeen).To(HaveLen(2))
+
+	now = now.Add(time.Minute)
+	collector.options.DryRun = true
+	g.Expect(collector.Collect(context.Background())).To(Succeed())
+	g.Expect(uninstalled).To(BeEmpty(), "orphans are kept in dry-run mode")
+
+	collector.options.DryRun = false
+	g.Expect(collector.Collect(context.Background())).To(Succeed())
+	g.Expect(uninstalled).To(ConsistOf("orphaned", "replaced"))
+	g.Expect(collector.firstSeen).To(BeEmpty())
+}
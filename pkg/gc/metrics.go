@@ -0,0 +1,43 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	orphanedClusters = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "capk_gc_orphaned_clusters",
+		Help: "Number of kwok clusters found without an owning KwokControlPlane in the last garbage collection.",
+	})
+
+	collectedClusters = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "capk_gc_collected_clusters_total",
+		Help: "Total number of orphaned kwok clusters deleted by the garbage collector.",
+	})
+
+	collectionErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "capk_gc_errors_total",
+		Help: "Total number of errors while garbage collecting orphaned kwok clusters.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(orphanedClusters, collectedClusters, collectionErrors)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// OwnerFileName is the name of the ownership marker written in the working directory of every
+// cluster created by the provider. Clusters without it are never garbage collected.
+const OwnerFileName = "capk-owner.json"
+
+// Owner identifies the KwokControlPlane a kwok cluster was created for.
+type Owner struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       types.UID `json:"uid"`
+}
+
+// WriteOwner writes the ownership marker of the cluster in dir.
+func WriteOwner(dir string, owner Owner) error {
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return fmt.Errorf("marshalling owner: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, OwnerFileName), data, 0o640); err != nil {
+		return fmt.Errorf("writing owner: %w", err)
+	}
+
+	return nil
+}
+
+// ReadOwner reads the ownership marker of the cluster in dir. It returns nil if there is none.
+func ReadOwner(dir string) (*Owner, error) {
+	data, err := os.ReadFile(filepath.Join(dir, OwnerFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading owner: %w", err)
+	}
+
+	owner := &Owner{}
+	if err := json.Unmarshal(data, owner); err != nil {
+		return nil, fmt.Errorf("unmarshalling owner: %w", err)
+	}
+
+	return owner, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lock provides file based locks, so kwokctl operations on a cluster are serialized
+// across reconciles and across manager replicas sharing the same work dir.
+package lock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often a held lock is retried while waiting for it.
+const pollInterval = 100 * time.Millisecond
+
+// FileLock is an exclusive advisory lock on a file. Locks are held per open file, so two
+// FileLocks on the same path exclude each other even within the same process.
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+// New returns a lock on the file at path. The file and its parent directory are created when
+// the lock is first acquired.
+func New(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path returns the path of the lock file.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// TryLock acquires the lock without waiting. It returns false if the lock is held elsewhere.
+func (l *FileLock) TryLock() (bool, error) {
+	if l.file != nil {
+		return false, fmt.Errorf("lock %q is already held", l.path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o750); err != nil {
+		return false, fmt.Errorf("creating lock dir: %w", err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return false, fmt.Errorf("opening lock file: %w", err)
+	}
+
+	locked, err := tryLockFile(file)
+	if err != nil || !locked {
+		_ = file.Close()
+		return false, err
+	}
+
+	l.file = file
+	return true, nil
+}
+
+// Lock waits until the lock is acquired or ctx is done.
+func (l *FileLock) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		locked, err := l.TryLock()
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for lock %q: %w", l.path, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Unlock releases the lock. The lock file is left in place, removing it would race with
+// other processes waiting on it.
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+
+	file := l.file
+	l.file = nil
+
+	if err := unlockFile(file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("releasing lock %q: %w", l.path, err)
+	}
+
+	return file.Close()
+}
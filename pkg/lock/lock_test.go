@@ -0,0 +1,51 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lock
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFileLock(t *testing.T) {
+	g := NewWithT(t)
+
+	path := filepath.Join(t.TempDir(), "locks", "test.lock")
+	first := New(path)
+	second := New(path)
+
+	locked, err := first.TryLock()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(locked).To(BeTrue())
+
+	locked, err = second.TryLock()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(locked).To(BeFalse(), "the lock is held by another file")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	g.Expect(second.Lock(ctx)).To(MatchError(context.DeadlineExceeded))
+
+	g.Expect(first.Unlock()).To(Succeed())
+	g.Expect(second.Lock(context.Background())).To(Succeed())
+	g.Expect(second.Unlock()).To(Succeed())
+	g.Expect(second.Unlock()).To(Succeed(), "unlocking a released lock is a no-op")
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operation
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// RetryPolicy configures how failed operations are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times an operation is attempted before its failure is
+	// considered terminal. Zero means operations are retried forever.
+	MaxAttempts int32
+
+	// BaseDelay is the delay before the first retry, it doubles with every failed attempt.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between retries.
+	MaxDelay time.Duration
+}
+
+// Backoff returns how long to wait before retrying an operation that failed the given number
+// of times.
+func (p RetryPolicy) Backoff(attempts int32) time.Duration {
+	if attempts <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := int32(1); i < attempts; i++ {
+		// Stop doubling before the delay overflows when it isn't capped.
+		if delay > math.MaxInt64/2 {
+			break
+		}
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return delay
+}
+
+// Exhausted returns true if no more attempts are allowed after the given number of failed ones.
+func (p RetryPolicy) Exhausted(attempts int32) bool {
+	return p.MaxAttempts > 0 && attempts >= p.MaxAttempts
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error as permanent, so the operation that returned it is not retried.
+// Errors are considered transient unless marked otherwise.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns true if the error, or any error it wraps, was marked as permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
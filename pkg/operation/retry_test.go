@@ -0,0 +1,85 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   10 * time.Second,
+		MaxDelay:    time.Minute,
+	}
+
+	testCases := []struct {
+		attempts int32
+		expected time.Duration
+	}{
+		{attempts: 0, expected: 0},
+		{attempts: 1, expected: 10 * time.Second},
+		{attempts: 2, expected: 20 * time.Second},
+		{attempts: 3, expected: 40 * time.Second},
+		{attempts: 4, expected: time.Minute},
+		{attempts: 100, expected: time.Minute},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d attempts", tc.attempts), func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(policy.Backoff(tc.attempts)).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestRetryPolicyBackoffUncapped(t *testing.T) {
+	g := NewWithT(t)
+
+	policy := RetryPolicy{BaseDelay: 10 * time.Second}
+
+	g.Expect(policy.Backoff(3)).To(Equal(40 * time.Second))
+	for _, attempts := range []int32{40, 64, 100, math.MaxInt32} {
+		g.Expect(policy.Backoff(attempts)).To(BeNumerically(">", math.MaxInt64/2), "%d attempts", attempts)
+	}
+}
+
+func TestRetryPolicyExhausted(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(RetryPolicy{MaxAttempts: 3}.Exhausted(2)).To(BeFalse())
+	g.Expect(RetryPolicy{MaxAttempts: 3}.Exhausted(3)).To(BeTrue())
+	g.Expect(RetryPolicy{}.Exhausted(100)).To(BeFalse())
+}
+
+func TestPermanent(t *testing.T) {
+	g := NewWithT(t)
+
+	err := errors.New("boom")
+	g.Expect(IsPermanent(err)).To(BeFalse())
+	g.Expect(IsPermanent(Permanent(err))).To(BeTrue())
+	g.Expect(IsPermanent(fmt.Errorf("wrapped: %w", Permanent(err)))).To(BeTrue())
+	g.Expect(Permanent(err)).To(MatchError(err))
+	g.Expect(Permanent(nil)).To(BeNil())
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operation tracks long-running operations that are run in the background,
+// so reconcilers can start them and poll for their result instead of blocking a worker.
+package operation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Options configures a Tracker.
+type Options struct {
+	// Timeouts is the timeout of each operation type. Operations without a timeout run until
+	// they finish or are cancelled.
+	Timeouts map[string]time.Duration
+
+	// Retry is the policy used to retry failed operations.
+	Retry RetryPolicy
+}
+
+// Func is the function run by an operation.
+type Func func(ctx context.Context) error
+
+// Status is the observed state of an operation.
+type Status struct {
+	// Type is the type of the operation, e.g. Create or Delete.
+	Type string
+	// StartTime is when the operation was started.
+	StartTime time.Time
+	// CompletionTime is when the operation finished, it is zero while the operation is running.
+	CompletionTime time.Time
+	// Err is the error returned by the operation, if any.
+	Err error
+}
+
+// Done returns true if the operation has finished.
+func (s Status) Done() bool {
+	return !s.CompletionTime.IsZero()
+}
+
+type operation struct {
+	status Status
+	cancel context.CancelFunc
+}
+
+// Tracker runs operations in the background keyed by the cluster they act on. Only one
+// operation can be in flight per key.
+type Tracker struct {
+	ctx     context.Context
+	options Options
+
+	mu         sync.Mutex
+	operations map[string]*operation
+}
+
+// NewTracker creates a new tracker. Operations are run with a context derived from ctx, so
+// cancelling it cancels all the operations in flight.
+func NewTracker(ctx context.Context, options Options) *Tracker {
+	return &Tracker{
+		ctx:        ctx,
+		options:    options,
+		operations: map[string]*operation{},
+	}
+}
+
+// RetryPolicy returns the policy used to retry failed operations.
+func (t *Tracker) RetryPolicy() RetryPolicy {
+	return t.options.Retry
+}
+
+// Start runs fn in the background for the given key. If an operation is already tracked for
+// the key, no new operation is started and the status of the tracked one is returned along
+// with false.
+func (t *Tracker) Start(key, opType string, fn Func) (Status, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if op, ok := t.operations[key]; ok {
+		return op.status, false
+	}
+
+	var (
+		ctx     context.Context
+		cancel  context.CancelFunc
+		timeout = t.options.Timeouts[opType]
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(t.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(t.ctx)
+	}
+
+	op := &operation{
+		status: Status{
+			Type:      opType,
+			StartTime: time.Now(),
+		},
+		cancel: cancel,
+	}
+	t.operations[key] = op
+
+	go func() {
+		defer cancel()
+
+		err := fn(ctx)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		op.status.CompletionTime = time.Now()
+		op.status.Err = err
+	}()
+
+	return op.status, true
+}
+
+// Get returns the status of the operation tracked for the given key.
+func (t *Tracker) Get(key string) (Status, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	op, ok := t.operations[key]
+	if !ok {
+		return Status{}, false
+	}
+
+	return op.status, true
+}
+
+// Cancel cancels the context of the operation tracked for the given key. The operation is
+// still tracked until it returns and is forgotten.
+func (t *Tracker) Cancel(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if op, ok := t.operations[key]; ok {
+		op.cancel()
+	}
+}
+
+// Forget stops tracking the operation for the given key once it has finished, so a new
+// operation can be started. It returns false if the operation is still running.
+func (t *Tracker) Forget(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	op, ok := t.operations[key]
+	if !ok {
+		return true
+	}
+	if !op.status.Done() {
+		return false
+	}
+
+	delete(t.operations, key)
+	return true
+}
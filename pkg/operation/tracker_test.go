@@ -0,0 +1,92 @@
+/*
+Copyright 2023 The Kubernetes Authors..
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTracker(t *testing.T) {
+	g := NewWithT(t)
+
+	tracker := NewTracker(context.Background(), Options{})
+	release := make(chan struct{})
+
+	status, started := tracker.Start("ns/cluster", "Create", func(ctx context.Context) error {
+		<-release
+		return errors.New("boom")
+	})
+	g.Expect(started).To(BeTrue())
+	g.Expect(status.Type).To(Equal("Create"))
+	g.Expect(status.Done()).To(BeFalse())
+
+	_, started = tracker.Start("ns/cluster", "Delete", func(ctx context.Context) error { return nil })
+	g.Expect(started).To(BeFalse(), "only one operation can be in flight per key")
+	g.Expect(tracker.Forget("ns/cluster")).To(BeFalse(), "running operations can't be forgotten")
+
+	close(release)
+	g.Eventually(func() bool {
+		status, _ := tracker.Get("ns/cluster")
+		return status.Done()
+	}, time.Second).Should(BeTrue())
+
+	status, ok := tracker.Get("ns/cluster")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(status.Err).To(MatchError("boom"))
+
+	g.Expect(tracker.Forget("ns/cluster")).To(BeTrue())
+	_, ok = tracker.Get("ns/cluster")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestTrackerCancel(t *testing.T) {
+	g := NewWithT(t)
+
+	tracker := NewTracker(context.Background(), Options{})
+	tracker.Start("ns/cluster", "Create", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	tracker.Cancel("ns/cluster")
+	g.Eventually(func() error {
+		status, _ := tracker.Get("ns/cluster")
+		return status.Err
+	}, time.Second).Should(MatchError(context.Canceled))
+}
+
+func TestTrackerTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	tracker := NewTracker(context.Background(), Options{
+		Timeouts: map[string]time.Duration{"Create": 10 * time.Millisecond},
+	})
+	tracker.Start("ns/cluster", "Create", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	g.Eventually(func() error {
+		status, _ := tracker.Get("ns/cluster")
+		return status.Err
+	}, time.Second).Should(MatchError(context.DeadlineExceeded))
+}
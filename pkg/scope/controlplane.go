@@ -2,15 +2,16 @@ package scope
 
 import (
 	"context"
+	"path/filepath"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	//"sigs.k8s.io/kwok/pkg/utils/path"
-
-	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1alpha1"
-	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1alpha1"
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/patch"
 )
@@ -21,6 +22,8 @@ type ControlPlaneScopeParams struct {
 	Cluster        *clusterv1.Cluster
 	KwokCluster    *infrav1.KwokCluster
 	ControlPlane   *controlplanev1.KwokControlPlane
+	Operations     *operation.Tracker
+	Backend        services.Backend
 	ControllerName string
 }
 
@@ -34,6 +37,12 @@ func NewControlPlaneScope(params ControlPlaneScopeParams) (*ControlPlaneScope, e
 	if params.Logger == nil {
 		return nil, errors.New("failed to generate new scope from nil logger")
 	}
+	if params.Operations == nil {
+		return nil, errors.New("failed to generate new scope from nil operation tracker")
+	}
+	if params.Backend == nil {
+		return nil, errors.New("failed to generate new scope from nil backend")
+	}
 
 	cpScope := &ControlPlaneScope{
 		Logger:       params.Logger,
@@ -41,6 +50,8 @@ func NewControlPlaneScope(params ControlPlaneScopeParams) (*ControlPlaneScope, e
 		Cluster:      params.Cluster,
 		KwokCluster:  params.KwokCluster,
 		ControlPlane: params.ControlPlane,
+		Operations:   params.Operations,
+		Backend:      params.Backend,
 		patchHelper:  nil,
 	}
 
@@ -60,6 +71,12 @@ type ControlPlaneScope struct {
 	ControlPlane *controlplanev1.KwokControlPlane
 	KwokCluster  *infrav1.KwokCluster
 
+	// Operations tracks the long-running runtime operations of the control plane.
+	Operations *operation.Tracker
+
+	// Backend runs the cluster of the control plane.
+	Backend services.Backend
+
 	Logger      *logr.Logger
 	patchHelper *patch.Helper
 }
@@ -73,17 +90,37 @@ func (s *ControlPlaneScope) Runtime() string {
 	return runtime
 }
 
+// Name returns the name of the cluster in the kwok runtime.
 func (s *ControlPlaneScope) Name() string {
+	if existing := s.ControlPlane.Spec.ExistingCluster; existing != nil {
+		return existing.Name
+	}
 	return s.Cluster.Name
 }
 
+// IsAdopted returns true if the control plane adopts a cluster created with kwokctl.
+func (s *ControlPlaneScope) IsAdopted() bool {
+	return s.ControlPlane.Spec.ExistingCluster != nil
+}
+
+// OperationKey returns the key used to track long-running runtime operations for the control plane.
+func (s *ControlPlaneScope) OperationKey() string {
+	return client.ObjectKeyFromObject(s.ControlPlane).String()
+}
+
 func (s *ControlPlaneScope) PatchObject() error {
 	return s.patchHelper.Patch(
 		context.TODO(),
 		s.ControlPlane,
-		// patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
-		// 	infrav1.XYZCondition,
-		// }}
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			controlplanev1.ClusterAvailableCondition,
+			controlplanev1.ComponentsHealthyCondition,
+			controlplanev1.SnapshotRestoredCondition,
+			controlplanev1.ManifestsAppliedCondition,
+			controlplanev1.MachinesReadyCondition,
+			controlplanev1.MachinesSpecUpToDateCondition,
+		}},
 	)
 }
 
@@ -92,12 +129,65 @@ func (s *ControlPlaneScope) Close() error {
 	return s.PatchObject()
 }
 
-// WorkDir returns the working directory for the provider.
+// WorkDir returns the working directory of the kwok runtime for the cluster. Like kwokctl,
+// every cluster gets its own directory so clusters sharing a KwokCluster working dir don't
+// overwrite each other's state.
 func (s *ControlPlaneScope) WorkDir() string {
-	//return path.WorkDir()
+	return ClusterWorkDir(s.workDirRoot(), s.Name())
+}
+
+// LockPath returns the path of the file locked while running kwokctl operations on the cluster.
+func (s *ControlPlaneScope) LockPath() string {
+	return ClusterLockPath(s.workDirRoot(), s.Name())
+}
+
+// LegacyWorkDir returns the working directory clusters were created in before every cluster got
+// its own, i.e. the working directory of the KwokCluster itself.
+func (s *ControlPlaneScope) LegacyWorkDir() string {
+	return s.workDirRoot()
+}
+
+// MigrationSnapshotPath returns the path of the etcd snapshot taken while moving the cluster out
+// of its legacy working directory. It is removed once restored into the moved cluster.
+func (s *ControlPlaneScope) MigrationSnapshotPath() string {
+	return filepath.Join(ClustersDir(s.workDirRoot()), s.Name()+".migration.db")
+}
+
+// UpgradeSnapshotPath returns the path of the etcd snapshot taken while upgrading the cluster to
+// another Kubernetes version. It is removed once restored into the upgraded cluster.
+func (s *ControlPlaneScope) UpgradeSnapshotPath() string {
+	return filepath.Join(ClustersDir(s.workDirRoot()), s.Name()+".upgrade.db")
+}
+
+func (s *ControlPlaneScope) workDirRoot() string {
+	if existing := s.ControlPlane.Spec.ExistingCluster; existing != nil && existing.WorkDir != "" {
+		return existing.WorkDir
+	}
 	return s.KwokCluster.Spec.WorkingDir
 }
 
+// ClustersDir returns the directory holding the working directories of the clusters under root.
+func ClustersDir(root string) string {
+	return filepath.Join(root, "clusters")
+}
+
+// ClusterWorkDir returns the working directory of the named cluster under root.
+func ClusterWorkDir(root, name string) string {
+	return filepath.Join(ClustersDir(root), name)
+}
+
+// SnapshotPath returns the path of the etcd snapshot of the named KwokClusterSnapshot under root.
+// Snapshots live outside of the clusters' working directories so they outlive the cluster.
+func SnapshotPath(root, namespace, name string) string {
+	return filepath.Join(root, "snapshots", namespace, name+".db")
+}
+
+// ClusterLockPath returns the path of the lock file of the named cluster under root. It lives
+// outside of the cluster's working directory, which is removed when the cluster is deleted.
+func ClusterLockPath(root, name string) string {
+	return filepath.Join(root, "locks", name+".lock")
+}
+
 func (s *ControlPlaneScope) ClusterAddress() string {
 	if s.KwokCluster.Spec.BindAddress != "" {
 		return s.KwokCluster.Spec.BindAddress
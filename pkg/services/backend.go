@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+)
+
+// Backend runs the clusters of kwok control planes. The kwokctl runtimes are the default
+// implementation, other backends can replace them or wrap them to add metrics, tracing or
+// fault injection.
+type Backend interface {
+	// Supports reports whether the backend can create clusters with the given runtime.
+	Supports(runtime string) bool
+
+	// Cluster returns the cluster called name with its files in workDir, created with the
+	// given runtime. The cluster doesn't need to exist yet.
+	Cluster(runtime, name, workDir string) (BackendCluster, error)
+
+	// Load returns the existing cluster called name with its files in workDir, whichever
+	// runtime created it. The returned error wraps os.ErrNotExist when there is no cluster.
+	Load(ctx context.Context, name, workDir string) (BackendCluster, error)
+
+	// List returns the names of the clusters with their files in dir.
+	List(dir string) ([]string, error)
+}
+
+// BackendCluster is a cluster run by a Backend.
+type BackendCluster interface {
+	// Available checks whether the runtime of the cluster can be used.
+	Available(ctx context.Context) error
+
+	// Config returns the configuration of the cluster. It fails when the cluster isn't created.
+	Config(ctx context.Context) (*internalversion.KwokctlConfiguration, error)
+
+	// Create saves the configuration of the cluster and installs it, without starting it.
+	Create(ctx context.Context, conf *internalversion.KwokctlConfiguration) error
+
+	// Delete uninstalls the cluster and removes its files.
+	Delete(ctx context.Context) error
+
+	// Up starts the cluster, creating its components if needed.
+	Up(ctx context.Context) error
+
+	// Down stops the cluster and removes its components.
+	Down(ctx context.Context) error
+
+	// Stop stops the components of the cluster, keeping them and their state.
+	Stop(ctx context.Context) error
+
+	// StartComponent starts a component of the cluster.
+	StartComponent(ctx context.Context, name string) error
+
+	// StopComponent stops a component of the cluster.
+	StopComponent(ctx context.Context, name string) error
+
+	// SnapshotSave saves a snapshot of the etcd of the cluster to path.
+	SnapshotSave(ctx context.Context, path string) error
+
+	// SnapshotRestore restores the etcd of the cluster from the snapshot at path.
+	SnapshotRestore(ctx context.Context, path string) error
+}
@@ -0,0 +1,276 @@
+// Package fake implements an in-memory backend for tests. It runs nothing, it records the
+// calls made to its clusters and can be programmed to fail them.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// Backend is a fake services.Backend keeping its clusters in memory.
+type Backend struct {
+	mu sync.Mutex
+
+	runtimes      map[string]bool
+	clusters      map[string]*clusterState
+	errors        map[string]error
+	calls         []string
+	apiServerPort uint32
+}
+
+var _ services.Backend = &Backend{}
+
+// clusterState is the state of a cluster, shared by all the BackendClusters returned for it.
+type clusterState struct {
+	name    string
+	workDir string
+	conf    *internalversion.KwokctlConfiguration
+	running bool
+}
+
+// NewBackend returns an empty backend supporting the given runtimes.
+func NewBackend(runtimes ...string) *Backend {
+	b := &Backend{
+		runtimes: map[string]bool{},
+		clusters: map[string]*clusterState{},
+		errors:   map[string]error{},
+	}
+	for _, runtime := range runtimes {
+		b.runtimes[runtime] = true
+	}
+	return b
+}
+
+// AddCluster adds a created cluster, running when running is true, and creates its working
+// directory.
+func (b *Backend) AddCluster(name, workDir string, conf *internalversion.KwokctlConfiguration, running bool) error {
+	if err := os.MkdirAll(workDir, 0o750); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clusters[workDir] = &clusterState{
+		name:    name,
+		workDir: workDir,
+		conf:    conf,
+		running: running,
+	}
+	return nil
+}
+
+// HasCluster returns true if the cluster in workDir is created.
+func (b *Backend) HasCluster(workDir string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.clusters[workDir]
+	return ok && state.conf != nil
+}
+
+// IsRunning returns true if the cluster in workDir is running.
+func (b *Backend) IsRunning(workDir string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.clusters[workDir]
+	return ok && state.running
+}
+
+// SetAPIServerPort makes the clusters created from now on use port for their API server, so
+// tests can serve the API of the clusters themselves.
+func (b *Backend) SetAPIServerPort(port uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.apiServerPort = port
+}
+
+// FailOn makes every call to the given method of the clusters return err, until it is
+// called again with a nil error.
+func (b *Backend) FailOn(method string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		delete(b.errors, method)
+		return
+	}
+	b.errors[method] = err
+}
+
+// Calls returns the calls made to the clusters, as "<cluster>.<method>", in order.
+func (b *Backend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.calls...)
+}
+
+func (b *Backend) Supports(runtime string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.runtimes[runtime]
+}
+
+func (b *Backend) Cluster(runtime, name, workDir string) (services.BackendCluster, error) {
+	if !b.Supports(runtime) {
+		return nil, fmt.Errorf("runtime %q not found", runtime)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.clusters[workDir]; !ok {
+		b.clusters[workDir] = &clusterState{name: name, workDir: workDir}
+	}
+	return &cluster{backend: b, workDir: workDir}, nil
+}
+
+func (b *Backend) Load(_ context.Context, name, workDir string) (services.BackendCluster, error) {
+	if !b.HasCluster(workDir) {
+		return nil, fmt.Errorf("cluster %q: %w", name, os.ErrNotExist)
+	}
+	return &cluster{backend: b, workDir: workDir}, nil
+}
+
+func (b *Backend) List(dir string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var names []string
+	for workDir, state := range b.clusters {
+		if state.conf != nil && filepath.Dir(workDir) == filepath.Clean(dir) {
+			names = append(names, state.name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// call records a call to a method of the cluster in workDir and, unless it is programmed to
+// fail, applies fn to the state of the cluster.
+func (b *Backend) call(workDir, method string, fn func(state *clusterState) error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.clusters[workDir]
+	if !ok {
+		return fmt.Errorf("cluster in %q: %w", workDir, os.ErrNotExist)
+	}
+
+	b.calls = append(b.calls, state.name+"."+method)
+	if err := b.errors[method]; err != nil {
+		return err
+	}
+	if fn == nil {
+		return nil
+	}
+	return fn(state)
+}
+
+// cluster is a BackendCluster of the fake backend.
+type cluster struct {
+	backend *Backend
+	workDir string
+}
+
+// created fails unless the cluster is created.
+func created(state *clusterState) error {
+	if state.conf == nil {
+		return fmt.Errorf("cluster %q: %w", state.name, os.ErrNotExist)
+	}
+	return nil
+}
+
+func (c *cluster) Available(_ context.Context) error {
+	return c.backend.call(c.workDir, "Available", nil)
+}
+
+func (c *cluster) Config(_ context.Context) (*internalversion.KwokctlConfiguration, error) {
+	var conf *internalversion.KwokctlConfiguration
+	err := c.backend.call(c.workDir, "Config", func(state *clusterState) error {
+		if err := created(state); err != nil {
+			return err
+		}
+		conf = state.conf.DeepCopy()
+		return nil
+	})
+	return conf, err
+}
+
+// Create creates the working directory of the cluster, like kwokctl does, so files can be
+// stored along with the cluster.
+func (c *cluster) Create(_ context.Context, conf *internalversion.KwokctlConfiguration) error {
+	return c.backend.call(c.workDir, "Create", func(state *clusterState) error {
+		if err := os.MkdirAll(c.workDir, 0o750); err != nil {
+			return err
+		}
+		state.conf = conf.DeepCopy()
+		if c.backend.apiServerPort != 0 {
+			state.conf.Options.KubeApiserverPort = c.backend.apiServerPort
+		}
+		return nil
+	})
+}
+
+// Delete removes the working directory of the cluster, like kwokctl does.
+func (c *cluster) Delete(_ context.Context) error {
+	return c.backend.call(c.workDir, "Delete", func(state *clusterState) error {
+		if err := os.RemoveAll(c.workDir); err != nil {
+			return err
+		}
+		delete(c.backend.clusters, c.workDir)
+		return nil
+	})
+}
+
+func (c *cluster) Up(_ context.Context) error {
+	return c.backend.call(c.workDir, "Up", func(state *clusterState) error {
+		if err := created(state); err != nil {
+			return err
+		}
+		state.running = true
+		return nil
+	})
+}
+
+func (c *cluster) Down(_ context.Context) error {
+	return c.backend.call(c.workDir, "Down", func(state *clusterState) error {
+		state.running = false
+		return nil
+	})
+}
+
+func (c *cluster) Stop(_ context.Context) error {
+	return c.backend.call(c.workDir, "Stop", func(state *clusterState) error {
+		state.running = false
+		return nil
+	})
+}
+
+func (c *cluster) StartComponent(_ context.Context, _ string) error {
+	return c.backend.call(c.workDir, "StartComponent", created)
+}
+
+func (c *cluster) StopComponent(_ context.Context, _ string) error {
+	return c.backend.call(c.workDir, "StopComponent", created)
+}
+
+func (c *cluster) SnapshotSave(_ context.Context, _ string) error {
+	return c.backend.call(c.workDir, "SnapshotSave", created)
+}
+
+func (c *cluster) SnapshotRestore(_ context.Context, _ string) error {
+	return c.backend.call(c.workDir, "SnapshotRestore", created)
+}
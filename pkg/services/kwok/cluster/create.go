@@ -3,6 +3,8 @@ package cluster
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -11,88 +13,340 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/kubeconfig"
 	"sigs.k8s.io/cluster-api/util/record"
 	"sigs.k8s.io/cluster-api/util/secret"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
 	"sigs.k8s.io/kwok/pkg/config"
-	"sigs.k8s.io/kwok/pkg/kwokctl/runtime"
 	"sigs.k8s.io/kwok/pkg/utils/format"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/gc"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
 )
 
 func (s *Service) Reconcile(ctx context.Context) (ctrl.Result, error) {
 	logger := s.scope.Logger
 	logger.Info("Reconciling KwokControlPlane")
 
+	if reason := s.scope.ControlPlane.Status.FailureReason; reason != nil {
+		logger.Info("Control plane has a terminal failure, skipping reconcile", "reason", *reason)
+		return ctrl.Result{}, nil
+	}
+
+	finished, running := s.checkOperation()
+	if running {
+		return ctrl.Result{RequeueAfter: operationPollInterval}, nil
+	}
+	if finished != nil && finished.Err != nil {
+		return s.handleOperationError(finished), nil
+	}
+
+	if s.scope.IsAdopted() {
+		rt, err := s.loadExistingCluster(ctx)
+		if err != nil || rt == nil {
+			return ctrl.Result{}, err
+		}
+
+		return s.reconcileCluster(ctx, rt)
+	}
+
 	kwokctlConfiguration := config.GetKwokctlConfiguration(ctx)
 
-	buildRuntime, ok := runtime.DefaultRegistry.Get(s.scope.Runtime())
-	if !ok {
-		return ctrl.Result{}, fmt.Errorf("runtime %q not found", s.scope.Runtime())
+	if !s.scope.Backend.Supports(s.scope.Runtime()) {
+		s.setFailure(capierrors.InvalidConfigurationClusterError, fmt.Errorf("runtime %q not found", s.scope.Runtime()))
+		return ctrl.Result{}, nil
 	}
-	rt, err := buildRuntime(s.scope.Name(), s.scope.WorkDir())
+	rt, err := s.scope.Backend.Cluster(s.scope.Runtime(), s.scope.Name(), s.scope.WorkDir())
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("runtime %v not available: %w", s.scope.Runtime(), err)
 	}
 
-	_, err = rt.Config(ctx)
-	if err == nil {
-		logger.Info("Cluster already exists")
-
-		ready, err := rt.Ready(ctx)
+	_, configErr := rt.Config(ctx)
+	_, statErr := os.Stat(s.scope.MigrationSnapshotPath())
+	if migrating := statErr == nil; migrating || configErr != nil {
+		legacy, err := s.loadLegacyCluster(ctx)
 		if err != nil {
-			logger.Error(err, "Failed to check cluster status")
 			return ctrl.Result{}, err
 		}
-		if ready {
-			logger.Info("Cluster is already ready")
-			return ctrl.Result{}, nil
+		if migrating || legacy != nil {
+			return s.reconcileMigration(rt, legacy), nil
 		}
-	} else {
-		start := time.Now()
-		logger.Info("Cluster is creating")
+	}
 
-		err = rt.SetConfig(ctx, kwokctlConfiguration)
-		if err != nil {
-			logger.Error(err, "Failed to set config")
-			return ctrl.Result{}, err
+	if err := configErr; err != nil {
+		conf := kwokctlConfiguration.DeepCopy()
+		applyClusterNetwork(conf, s.scope.Cluster.Spec.ClusterNetwork)
+		if s.scope.Runtime() == infrav1.RuntimeSimulated {
+			// The simulated API server runs in the manager, and only listens on the address its
+			// clients are given.
+			addExtraArgs(conf, "kube-apiserver", internalversion.ExtraArgs{Key: "bind-address", Value: s.scope.ClusterAddress()})
 		}
-		err = rt.Save(ctx)
-		if err != nil {
-			logger.Error(err, "Failed to save config", err)
-			return ctrl.Result{}, err
+		if version := s.scope.ControlPlane.Spec.Version; version != "" {
+			versioned, versionErr := withKubeVersion(ctx, conf, version)
+			if versionErr != nil {
+				return ctrl.Result{}, versionErr
+			}
+			conf = versioned
 		}
+		if s.scope.ControlPlane.Status.Initialized {
+			// The cluster was removed behind our back, recreate it where clients expect it.
+			logger.Info("Cluster is missing from the runtime, recreating it", "reason", err)
+			record.Warnf(s.scope.ControlPlane, "ClusterRecreating", "Cluster %q is missing from the %s runtime, recreating it", s.scope.Name(), s.scope.Runtime())
+			conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterRecreatingReason, clusterv1.ConditionSeverityWarning, "Cluster is missing from the runtime")
+			s.scope.ControlPlane.Status.Ready = false
 
-		err = rt.Install(ctx)
-		if err != nil {
-			logger.Error(err, "Failed to setup config")
-			return ctrl.Result{}, err
+			// The recreated cluster is empty, the manifests have to be applied again.
+			s.scope.ControlPlane.Status.AppliedManifests = nil
+			conditions.Delete(s.scope.ControlPlane, controlplanev1.ManifestsAppliedCondition)
+
+			if port := s.scope.ControlPlane.Spec.ControlPlaneEndpoint.Port; port != 0 {
+				conf.Options.KubeApiserverPort = uint32(port)
+			}
+		} else {
+			if remaining := s.provisioningDelay(); remaining > 0 {
+				logger.V(2).Info("Simulating cluster provisioning", "remaining", remaining)
+				conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterCreatingReason, clusterv1.ConditionSeverityInfo, "")
+				return ctrl.Result{RequeueAfter: remaining}, nil
+			}
+
+			logger.Info("Cluster is creating")
+			conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterCreatingReason, clusterv1.ConditionSeverityInfo, "")
 		}
-		logger.Info("Cluster is created",
-			"elapsed", time.Since(start),
-		)
+
+		return s.startOperation(controlplanev1.OperationTypeCreate, func(ctx context.Context) error {
+			start := time.Now()
+
+			if err := rt.Create(ctx, conf); err != nil {
+				return err
+			}
+			if err := gc.WriteOwner(s.scope.WorkDir(), s.owner()); err != nil {
+				return fmt.Errorf("failed to write owner: %w", err)
+			}
+
+			logger.Info("Cluster is created",
+				"elapsed", time.Since(start),
+			)
+			return nil
+		}), nil
+	}
+
+	return s.reconcileCluster(ctx, rt)
+}
+
+// provisioningDelay returns how much longer the provisioning of the cluster is simulated to take.
+// It honours the reconcile latency of the simulation config without blocking the worker.
+func (s *Service) provisioningDelay() time.Duration {
+	latency := s.scope.ControlPlane.Spec.SimulationConfig.ReconcileLatency()
+	if latency == 0 {
+		return 0
+	}
+
+	readyAt := s.scope.ControlPlane.CreationTimestamp.Add(latency)
+	return time.Until(readyAt)
+}
+
+// loadExistingCluster loads the kwokctl cluster adopted by the control plane. It returns nil
+// when the cluster can't be adopted, after reporting a terminal failure.
+func (s *Service) loadExistingCluster(ctx context.Context) (services.BackendCluster, error) {
+	rt, err := s.scope.Backend.Load(ctx, s.scope.Name(), s.scope.WorkDir())
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("loading cluster %q: %w", s.scope.Name(), err)
+		}
+
+		// Adopted clusters are never reinstalled, the configuration they were created with is unknown.
+		if s.scope.ControlPlane.Status.Initialized {
+			s.setFailure(capierrors.UpdateClusterError, fmt.Errorf("adopted cluster %q is missing from %q", s.scope.Name(), s.scope.WorkDir()))
+		} else {
+			s.setFailure(capierrors.InvalidConfigurationClusterError, fmt.Errorf("cluster %q to adopt not found in %q", s.scope.Name(), s.scope.WorkDir()))
+		}
+		return nil, nil
+	}
+
+	if err := rt.Available(ctx); err != nil {
+		return nil, fmt.Errorf("runtime of cluster %q not available: %w", s.scope.Name(), err)
+	}
+
+	owner, err := gc.ReadOwner(s.scope.WorkDir())
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && (owner.Namespace != s.scope.ControlPlane.Namespace || owner.Name != s.scope.ControlPlane.Name) {
+		s.setFailure(capierrors.InvalidConfigurationClusterError, fmt.Errorf("cluster %q is already owned by KwokControlPlane %s/%s", s.scope.Name(), owner.Namespace, owner.Name))
+		return nil, nil
+	}
+
+	return rt, nil
+}
+
+// reconcileCluster reconciles a cluster that exists in the kwok runtime.
+func (s *Service) reconcileCluster(ctx context.Context, rt services.BackendCluster) (ctrl.Result, error) {
+	if err := s.reconcileOwner(); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconciling owner: %w", err)
+	}
+
+	config, err := rt.Config(ctx)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("getting kwok runtime config: %w", err)
 	}
+	port := config.Options.KubeApiserverPort
+	s.scope.ControlPlane.Status.Version = config.Options.KubeVersion
 
-	if err := s.reconcileKubeconfig(ctx, rt); err != nil {
+	if err := s.reconcileKubeconfig(ctx, port); err != nil {
 		return ctrl.Result{}, fmt.Errorf("reconciling kubeconfig: %w", err)
 	}
 
-	start := time.Now()
-	logger.Info("Cluster is starting")
-	err = rt.Up(ctx)
+	s.reconcileControlPlaneEndpoint(port)
+
+	if s.scope.ControlPlane.Spec.Hibernate {
+		return s.reconcileHibernation(rt)
+	}
+
+	return s.reconcileHealth(ctx, rt)
+}
+
+// reconcileHealth probes the components of the cluster, starting the cluster when its API server
+// is not serving and restarting any other component that is unhealthy.
+func (s *Service) reconcileHealth(ctx context.Context, rt services.BackendCluster) (ctrl.Result, error) {
+	logger := s.scope.Logger
+
+	config, err := rt.Config(ctx)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("getting kwok runtime config: %w", err)
+	}
+
+	client, err := s.clusterClient(config.Options.KubeApiserverPort)
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to start cluster %q: %w", s.scope.Name(), err)
+		return ctrl.Result{}, fmt.Errorf("creating client for cluster: %w", err)
+	}
+
+	unhealthy := probeComponents(ctx, client)
+	if len(unhealthy) > 0 && unhealthy[0].name == componentKubeApiserver {
+		s.scope.ControlPlane.Status.Ready = false
+
+		switch {
+		case s.scope.ControlPlane.Status.Hibernated:
+			logger.Info("Cluster is resuming from hibernation")
+			record.Eventf(s.scope.ControlPlane, "ClusterResuming", "Resuming cluster %q from hibernation", s.scope.Name())
+			conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterResumingReason, clusterv1.ConditionSeverityInfo, "")
+		case s.scope.ControlPlane.Status.Initialized:
+			logger.Info("Cluster is unavailable, starting it", "reason", unhealthy[0].err)
+			record.Warnf(s.scope.ControlPlane, "ClusterUnavailable", "API server of cluster %q is unavailable, starting the cluster: %v", s.scope.Name(), unhealthy[0].err)
+			conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterUnavailableReason, clusterv1.ConditionSeverityWarning, unhealthy[0].err.Error())
+		default:
+			logger.Info("Cluster is starting")
+			conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterStartingReason, clusterv1.ConditionSeverityInfo, "")
+		}
+
+		return s.startOperation(controlplanev1.OperationTypeStart, func(ctx context.Context) error {
+			start := time.Now()
+
+			if err := rt.Up(ctx); err != nil {
+				return fmt.Errorf("failed to start cluster %q: %w", s.scope.Name(), err)
+			}
+
+			logger.Info("Cluster is started",
+				"elapsed", time.Since(start),
+			)
+			return nil
+		}), nil
+	}
+
+	if res, upgrading, err := s.reconcileUpgrade(ctx, rt, config); upgrading || err != nil {
+		return res, err
 	}
-	logger.Info("Cluster is started",
-		"elapsed", time.Since(start),
-	)
 
+	if res, restoring, err := s.reconcileRestore(ctx, rt); restoring || err != nil {
+		return res, err
+	}
+
+	logger.Info("Cluster is ready")
+	conditions.MarkTrue(s.scope.ControlPlane, controlplanev1.ClusterAvailableCondition)
 	s.scope.ControlPlane.Status.Initialized = true
+	s.scope.ControlPlane.Status.Ready = true
+	s.scope.ControlPlane.Status.Hibernated = false
+
+	if err := s.reconcileManifests(ctx, s.clusterRestConfig(config.Options.KubeApiserverPort)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("reconciling manifests: %w", err)
+	}
+
+	if len(unhealthy) == 0 {
+		conditions.MarkTrue(s.scope.ControlPlane, controlplanev1.ComponentsHealthyCondition)
+		return ctrl.Result{RequeueAfter: healthProbeInterval}, nil
+	}
 
-	return ctrl.Result{}, nil
+	names := make([]string, 0, len(unhealthy))
+	for _, c := range unhealthy {
+		logger.Info("Component is unhealthy", "component", c.name, "reason", c.err)
+		names = append(names, c.name)
+	}
+	record.Warnf(s.scope.ControlPlane, "ComponentsRestarting", "Restarting unhealthy components %s of cluster %q", strings.Join(names, ", "), s.scope.Name())
+	conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.ComponentsHealthyCondition, controlplanev1.ComponentsRestartingReason, clusterv1.ConditionSeverityWarning, "Restarting unhealthy components: %s", strings.Join(names, ", "))
+
+	return s.startOperation(controlplanev1.OperationTypeRestart, func(ctx context.Context) error {
+		for _, name := range names {
+			// The component may already be gone, starting it is what matters.
+			if err := rt.StopComponent(ctx, name); err != nil {
+				logger.V(2).Info("Failed to stop component", "component", name, "reason", err)
+			}
+			if err := rt.StartComponent(ctx, name); err != nil {
+				return fmt.Errorf("failed to restart component %q: %w", name, err)
+			}
+			logger.Info("Component is restarted", "component", name)
+		}
+		return nil
+	}), nil
 }
 
-func (s *Service) reconcileKubeconfig(ctx context.Context, rt runtime.Runtime) error {
+// reconcileOwner makes sure the cluster is marked as owned by the control plane, so it isn't
+// garbage collected while the control plane exists.
+func (s *Service) reconcileOwner() error {
+	owner, err := gc.ReadOwner(s.scope.WorkDir())
+	if err != nil {
+		return err
+	}
+	if owner != nil && *owner == s.owner() {
+		return nil
+	}
+
+	s.scope.Logger.Info("Marking cluster as owned by the control plane")
+	if err := gc.WriteOwner(s.scope.WorkDir(), s.owner()); err != nil {
+		return err
+	}
+
+	if s.scope.IsAdopted() && owner == nil {
+		record.Eventf(s.scope.ControlPlane, "ClusterAdopted", "Adopted cluster %q from %q", s.scope.Name(), s.scope.WorkDir())
+	}
+
+	return nil
+}
+
+func (s *Service) owner() gc.Owner {
+	return gc.Owner{
+		Namespace: s.scope.ControlPlane.Namespace,
+		Name:      s.scope.ControlPlane.Name,
+		UID:       s.scope.ControlPlane.UID,
+	}
+}
+
+func (s *Service) reconcileControlPlaneEndpoint(port uint32) {
+	endpoint := clusterv1.APIEndpoint{
+		Host: s.scope.ClusterAddress(),
+		Port: int32(port),
+	}
+	if s.scope.ControlPlane.Spec.ControlPlaneEndpoint != endpoint {
+		s.scope.Logger.Info("Setting control plane endpoint", "host", endpoint.Host, "port", endpoint.Port)
+		s.scope.ControlPlane.Spec.ControlPlaneEndpoint = endpoint
+	}
+}
+
+func (s *Service) reconcileKubeconfig(ctx context.Context, port uint32) error {
 	logger := s.scope.Logger
 
 	logger.Info("Reconciling kubeconfig for cluster", "cluster", s.scope.Name())
@@ -108,7 +362,7 @@ func (s *Service) reconcileKubeconfig(ctx context.Context, rt runtime.Runtime) e
 			return errors.Wrap(err, "failed to get kubeconfig secret")
 		}
 
-		if createErr := s.createKubeconfigSecret(ctx, &clusterRef, rt); createErr != nil {
+		if createErr := s.createKubeconfigSecret(ctx, &clusterRef, port); createErr != nil {
 			return fmt.Errorf("creating kubeconfig secret: %w", err)
 		}
 	} else {
@@ -118,13 +372,7 @@ func (s *Service) reconcileKubeconfig(ctx context.Context, rt runtime.Runtime) e
 	return nil
 }
 
-func (s *Service) createKubeconfigSecret(ctx context.Context, clusterRef *types.NamespacedName, rt runtime.Runtime) error {
-	config, err := rt.Config(ctx)
-	if err != nil {
-		return fmt.Errorf("getting kwock runtime config: %w", err)
-	}
-	conf := &config.Options
-
+func (s *Service) createKubeconfigSecret(ctx context.Context, clusterRef *types.NamespacedName, port uint32) error {
 	controllerOwnerRef := *metav1.NewControllerRef(s.scope.ControlPlane, s.scope.Cluster.Spec.ControlPlaneRef.GroupVersionKind())
 
 	clusterName := s.scope.Name()
@@ -143,7 +391,7 @@ func (s *Service) createKubeconfigSecret(ctx context.Context, clusterRef *types.
 		APIVersion: api.SchemeGroupVersion.Version,
 		Clusters: map[string]*api.Cluster{
 			clusterName: {
-				Server: scheme + "://" + address + ":" + format.String(conf.KubeApiserverPort),
+				Server: scheme + "://" + address + ":" + format.String(port),
 			},
 		},
 		Contexts: map[string]*api.Context{
@@ -6,15 +6,37 @@ import (
 	"os"
 	"time"
 
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/kwok/pkg/kwokctl/runtime"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
 )
 
 func (s *Service) Delete(ctx context.Context) (ctrl.Result, error) {
 	logger := s.scope.Logger
 	logger.Info("Reconciling KwokControlPlane delete")
 
-	rt, err := runtime.DefaultRegistry.Load(ctx, s.scope.Name(), s.scope.WorkDir())
+	if reason := s.scope.ControlPlane.Status.FailureReason; reason != nil && *reason == capierrors.DeleteClusterError {
+		logger.Info("Control plane has a terminal delete failure, skipping delete", "reason", *reason)
+		return ctrl.Result{}, nil
+	}
+
+	// Any other operation in flight is superseded by the deletion.
+	key := s.scope.OperationKey()
+	if status, ok := s.scope.Operations.Get(key); ok && !status.Done() && status.Type != string(controlplanev1.OperationTypeDelete) {
+		logger.Info("Cancelling operation before deleting the cluster", "operation", status.Type)
+		s.scope.Operations.Cancel(key)
+	}
+
+	finished, running := s.checkOperation()
+	if running {
+		return ctrl.Result{RequeueAfter: operationPollInterval}, nil
+	}
+	if finished != nil && finished.Type == string(controlplanev1.OperationTypeDelete) && finished.Err != nil {
+		return s.handleOperationError(finished), nil
+	}
+
+	rt, err := s.scope.Backend.Load(ctx, s.scope.Name(), s.scope.WorkDir())
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			logger.V(2).Info("Cluster does not exists, no action")
@@ -25,25 +47,27 @@ func (s *Service) Delete(ctx context.Context) (ctrl.Result, error) {
 		return ctrl.Result{}, err
 	}
 
-	logger.Info("Cluster is stopping")
-	start := time.Now()
-	err = rt.Down(ctx)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-	logger.Info("Cluster is stopped",
-		"elapsed", time.Since(start),
-	)
+	return s.startOperation(controlplanev1.OperationTypeDelete, func(ctx context.Context) error {
+		logger.Info("Cluster is stopping")
+		start := time.Now()
+		err := rt.Down(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info("Cluster is stopped",
+			"elapsed", time.Since(start),
+		)
 
-	start = time.Now()
-	logger.Info("Cluster is deleting")
-	err = rt.Uninstall(ctx)
-	if err != nil {
-		return ctrl.Result{}, err
-	}
-	logger.Info("Cluster is deleted",
-		"elapsed", time.Since(start),
-	)
+		start = time.Now()
+		logger.Info("Cluster is deleting")
+		err = rt.Delete(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Info("Cluster is deleted",
+			"elapsed", time.Since(start),
+		)
 
-	return ctrl.Result{}, nil
+		return nil
+	}), nil
 }
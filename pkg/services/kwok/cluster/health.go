@@ -0,0 +1,122 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// healthProbeInterval is how often the components of a ready cluster are probed.
+	healthProbeInterval = time.Minute
+
+	// healthProbeTimeout is the timeout of the requests made to probe a component.
+	healthProbeTimeout = 10 * time.Second
+
+	// nodeHeartbeatTimeout is how old the heartbeat of a node can be before kwok-controller,
+	// which renews it every 20s, is considered unhealthy.
+	nodeHeartbeatTimeout = 2 * time.Minute
+)
+
+const (
+	componentKubeApiserver  = "kube-apiserver"
+	componentEtcd           = "etcd"
+	componentKwokController = "kwok-controller"
+)
+
+// componentProbe checks the health of a component of the kwok cluster.
+type componentProbe struct {
+	component string
+	probe     func(ctx context.Context, client kubernetes.Interface) error
+}
+
+// componentProbes are run in order. The API server comes first as the other probes go through it.
+var componentProbes = []componentProbe{
+	{component: componentKubeApiserver, probe: probeReadyz("/readyz")},
+	{component: componentEtcd, probe: probeReadyz("/readyz/etcd")},
+	{component: componentKwokController, probe: probeNodeHeartbeats},
+}
+
+// unhealthyComponent is a component that failed its probe.
+type unhealthyComponent struct {
+	name string
+	err  error
+}
+
+// probeComponents probes the components of the kwok cluster and returns the unhealthy ones.
+// If the API server is unhealthy the other components are not probed.
+func probeComponents(ctx context.Context, client kubernetes.Interface) []unhealthyComponent {
+	var unhealthy []unhealthyComponent
+	for _, p := range componentProbes {
+		if err := p.probe(ctx, client); err != nil {
+			unhealthy = append(unhealthy, unhealthyComponent{name: p.component, err: err})
+			if p.component == componentKubeApiserver {
+				break
+			}
+		}
+	}
+
+	return unhealthy
+}
+
+func probeReadyz(path string) func(ctx context.Context, client kubernetes.Interface) error {
+	return func(ctx context.Context, client kubernetes.Interface) error {
+		ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+		defer cancel()
+
+		body, err := client.Discovery().RESTClient().Get().AbsPath(path).DoRaw(ctx)
+		if err != nil {
+			return fmt.Errorf("get %s: %w", path, err)
+		}
+		if string(body) != "ok" {
+			return fmt.Errorf("get %s: %s", path, body)
+		}
+
+		return nil
+	}
+}
+
+// probeNodeHeartbeats checks that kwok-controller keeps renewing the heartbeat of the nodes it
+// manages. A cluster without nodes is always healthy, as there is nothing to tell from.
+func probeNodeHeartbeats(ctx context.Context, client kubernetes.Interface) error {
+	ctx, cancel := context.WithTimeout(ctx, healthProbeTimeout)
+	defer cancel()
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing nodes: %w", err)
+	}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		for _, condition := range node.Status.Conditions {
+			if condition.Type != corev1.NodeReady || condition.LastHeartbeatTime.IsZero() {
+				continue
+			}
+			if age := time.Since(condition.LastHeartbeatTime.Time); age > nodeHeartbeatTimeout {
+				return fmt.Errorf("heartbeat of node %q is %s old", node.Name, age.Round(time.Second))
+			}
+		}
+	}
+
+	return nil
+}
+
+// clusterRestConfig returns the config to reach the API server of the kwok cluster, like
+// through the kubeconfig generated for the cluster.
+func (s *Service) clusterRestConfig(port uint32) *rest.Config {
+	return &rest.Config{
+		Host:    fmt.Sprintf("http://%s:%d", s.scope.ClusterAddress(), port),
+		Timeout: healthProbeTimeout,
+	}
+}
+
+// clusterClient returns a client for the API server of the kwok cluster.
+func (s *Service) clusterClient(port uint32) (kubernetes.Interface, error) {
+	return kubernetes.NewForConfig(s.clusterRestConfig(port))
+}
@@ -0,0 +1,107 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func newTestNode(name string, heartbeat time.Time) corev1.Node {
+	return corev1.Node{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Node"},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{
+					Type:              corev1.NodeReady,
+					Status:            corev1.ConditionTrue,
+					LastHeartbeatTime: metav1.NewTime(heartbeat),
+				},
+			},
+		},
+	}
+}
+
+func TestProbeComponents(t *testing.T) {
+	testCases := []struct {
+		name      string
+		readyz    int
+		etcd      int
+		nodes     []corev1.Node
+		unhealthy []string
+	}{
+		{
+			name:   "healthy cluster",
+			readyz: http.StatusOK,
+			etcd:   http.StatusOK,
+			nodes:  []corev1.Node{newTestNode("node-0", time.Now())},
+		},
+		{
+			name:      "API server down skips the other probes",
+			readyz:    http.StatusInternalServerError,
+			etcd:      http.StatusInternalServerError,
+			unhealthy: []string{componentKubeApiserver},
+		},
+		{
+			name:      "etcd unhealthy",
+			readyz:    http.StatusOK,
+			etcd:      http.StatusInternalServerError,
+			unhealthy: []string{componentEtcd},
+		},
+		{
+			name:   "stale node heartbeat",
+			readyz: http.StatusOK,
+			etcd:   http.StatusOK,
+			nodes: []corev1.Node{
+				newTestNode("node-0", time.Now()),
+				newTestNode("node-1", time.Now().Add(-time.Hour)),
+			},
+			unhealthy: []string{componentKwokController},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.readyz)
+				_, _ = w.Write([]byte("ok"))
+			})
+			mux.HandleFunc("/readyz/etcd", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.etcd)
+				_, _ = w.Write([]byte("ok"))
+			})
+			mux.HandleFunc("/api/v1/nodes", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(&corev1.NodeList{
+					TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "NodeList"},
+					Items:    tc.nodes,
+				})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, c := range probeComponents(context.Background(), client) {
+				g.Expect(c.err).To(HaveOccurred())
+				names = append(names, c.name)
+			}
+			g.Expect(names).To(Equal(tc.unhealthy))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// reconcileHibernation stops the components of the cluster. Stop keeps the containers, and
+// with them the state of etcd, so the cluster resumes where it left off when started with Up.
+func (s *Service) reconcileHibernation(rt services.BackendCluster) (ctrl.Result, error) {
+	logger := s.scope.Logger
+	controlPlane := s.scope.ControlPlane
+
+	controlPlane.Status.Ready = false
+
+	if controlPlane.Status.Hibernated {
+		logger.V(2).Info("Cluster is hibernated")
+		return ctrl.Result{}, nil
+	}
+
+	if op := controlPlane.Status.Operation; op != nil && op.Type == controlplanev1.OperationTypeStop && op.Phase == controlplanev1.OperationPhaseSucceeded {
+		logger.Info("Cluster is hibernated")
+		record.Eventf(controlPlane, "ClusterHibernated", "Hibernated cluster %q", s.scope.Name())
+		conditions.MarkFalse(controlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterHibernatedReason, clusterv1.ConditionSeverityInfo, "")
+		controlPlane.Status.Hibernated = true
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("Cluster is hibernating")
+	conditions.MarkFalse(controlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterHibernatingReason, clusterv1.ConditionSeverityInfo, "")
+
+	return s.startOperation(controlplanev1.OperationTypeStop, func(ctx context.Context) error {
+		start := time.Now()
+
+		if err := rt.Stop(ctx); err != nil {
+			return fmt.Errorf("failed to stop cluster %q: %w", s.scope.Name(), err)
+		}
+
+		logger.Info("Cluster is stopped",
+			"elapsed", time.Since(start),
+		)
+		return nil
+	}), nil
+}
@@ -0,0 +1,213 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/rest"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+	utilyaml "sigs.k8s.io/cluster-api/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+)
+
+// manifestsFieldOwner is the field manager of the manifests applied to the clusters.
+const manifestsFieldOwner = client.FieldOwner("capk")
+
+// reconcileManifests applies the manifests referenced by spec.manifests to the cluster.
+func (s *Service) reconcileManifests(ctx context.Context, config *rest.Config) error {
+	controlPlane := s.scope.ControlPlane
+	if len(controlPlane.Spec.Manifests) == 0 {
+		controlPlane.Status.AppliedManifests = nil
+		conditions.Delete(controlPlane, controlplanev1.ManifestsAppliedCondition)
+		return nil
+	}
+
+	var (
+		c       client.Client
+		applied []controlplanev1.AppliedManifests
+		errs    []error
+	)
+	for _, source := range controlPlane.Spec.Manifests {
+		last := findAppliedManifests(controlPlane.Status.AppliedManifests, source)
+
+		data, err := s.manifestsData(ctx, source)
+		if err != nil {
+			errs = append(errs, err)
+			if last != nil {
+				applied = append(applied, *last)
+			}
+			continue
+		}
+
+		hash := hashManifests(data)
+		if last != nil && controlPlane.Spec.ManifestsStrategy != controlplanev1.ManifestsStrategyReconcile {
+			// Applied once, even if the manifests changed since.
+			applied = append(applied, *last)
+			continue
+		}
+
+		if c == nil {
+			if c, err = client.New(config, client.Options{}); err != nil {
+				return fmt.Errorf("creating client for cluster: %w", err)
+			}
+		}
+
+		resources, err := applyManifests(ctx, c, data)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("applying manifests from %s %q: %w", source.Kind, source.Name, err))
+			if last != nil {
+				applied = append(applied, *last)
+			}
+			continue
+		}
+
+		// Reapplying unchanged manifests only reverts drift, it isn't reported to avoid
+		// updating the status on every reconcile.
+		if last != nil && last.Hash == hash {
+			applied = append(applied, *last)
+			continue
+		}
+
+		s.scope.Logger.Info("Applied manifests", "kind", source.Kind, "name", source.Name, "resources", len(resources))
+		record.Eventf(controlPlane, "ManifestsApplied", "Applied %d resources from %s %q to cluster %q", len(resources), source.Kind, source.Name, s.scope.Name())
+		applied = append(applied, controlplanev1.AppliedManifests{
+			ManifestSource:  source,
+			Hash:            hash,
+			LastAppliedTime: metav1.Now(),
+			Resources:       resources,
+		})
+	}
+	controlPlane.Status.AppliedManifests = applied
+
+	if err := kerrors.NewAggregate(errs); err != nil {
+		conditions.MarkFalse(controlPlane, controlplanev1.ManifestsAppliedCondition, controlplanev1.ManifestsApplyFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return err
+	}
+
+	conditions.MarkTrue(controlPlane, controlplanev1.ManifestsAppliedCondition)
+	return nil
+}
+
+// manifestsData returns the data of the ConfigMap or Secret holding manifests.
+func (s *Service) manifestsData(ctx context.Context, source controlplanev1.ManifestSource) (map[string][]byte, error) {
+	key := types.NamespacedName{Namespace: s.scope.ControlPlane.Namespace, Name: source.Name}
+
+	switch source.Kind {
+	case controlplanev1.ManifestSourceConfigMap:
+		configMap := &corev1.ConfigMap{}
+		if err := s.scope.Client.Get(ctx, key, configMap); err != nil {
+			return nil, fmt.Errorf("getting ConfigMap %q: %w", source.Name, err)
+		}
+
+		data := make(map[string][]byte, len(configMap.Data))
+		for k, v := range configMap.Data {
+			data[k] = []byte(v)
+		}
+		return data, nil
+	case controlplanev1.ManifestSourceSecret:
+		secret := &corev1.Secret{}
+		if err := s.scope.Client.Get(ctx, key, secret); err != nil {
+			return nil, fmt.Errorf("getting Secret %q: %w", source.Name, err)
+		}
+		return secret.Data, nil
+	default:
+		return nil, fmt.Errorf("unsupported manifests source kind %q", source.Kind)
+	}
+}
+
+// parseManifests returns the objects in data, the values of which are sorted by key. Namespaces
+// and CustomResourceDefinitions come first, so the objects using them can be applied.
+func parseManifests(data map[string][]byte) ([]unstructured.Unstructured, error) {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var objs []unstructured.Unstructured
+	for _, k := range keys {
+		parsed, err := utilyaml.ToUnstructured(data[k])
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q: %w", k, err)
+		}
+		objs = append(objs, parsed...)
+	}
+
+	sort.SliceStable(objs, func(i, j int) bool {
+		return applyOrder(objs[i]) < applyOrder(objs[j])
+	})
+
+	return objs, nil
+}
+
+func applyOrder(obj unstructured.Unstructured) int {
+	switch obj.GroupVersionKind().GroupKind().String() {
+	case "Namespace":
+		return 0
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// applyManifests applies the objects in data server-side.
+func applyManifests(ctx context.Context, c client.Client, data map[string][]byte) ([]controlplanev1.AppliedResource, error) {
+	objs, err := parseManifests(data)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]controlplanev1.AppliedResource, 0, len(objs))
+	for i := range objs {
+		obj := &objs[i]
+		if err := c.Patch(ctx, obj, client.Apply, manifestsFieldOwner, client.ForceOwnership); err != nil {
+			return nil, fmt.Errorf("applying %s %s: %w", obj.GetKind(), client.ObjectKeyFromObject(obj), err)
+		}
+
+		resources = append(resources, controlplanev1.AppliedResource{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+
+	return resources, nil
+}
+
+func hashManifests(data map[string][]byte) string {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		_, _ = h.Write([]byte(k))
+		_, _ = h.Write(data[k])
+	}
+
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+func findAppliedManifests(applied []controlplanev1.AppliedManifests, source controlplanev1.ManifestSource) *controlplanev1.AppliedManifests {
+	for i := range applied {
+		if applied[i].ManifestSource == source {
+			return &applied[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/cluster-api/util/conditions"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+func TestParseManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	data := map[string][]byte{
+		"b-workloads.yaml": []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: fake
+  namespace: test
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: test
+`),
+		"a-crds.yaml": []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`),
+		"c-namespaces.yaml": []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: test
+`),
+	}
+
+	objs, err := parseManifests(data)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var kinds []string
+	for _, obj := range objs {
+		kinds = append(kinds, obj.GetKind())
+	}
+	g.Expect(kinds).To(Equal([]string{"Namespace", "CustomResourceDefinition", "Deployment", "Widget"}))
+}
+
+func TestHashManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	hash := hashManifests(map[string][]byte{"a": []byte("1"), "b": []byte("2")})
+	g.Expect(hashManifests(map[string][]byte{"b": []byte("2"), "a": []byte("1")})).To(Equal(hash))
+	g.Expect(hashManifests(map[string][]byte{"a": []byte("1"), "b": []byte("3")})).NotTo(Equal(hash))
+}
+
+// newTestManifestsServer starts a fake API server serving namespaces and ConfigMaps, which
+// records the server-side apply requests it receives as "<path> <fieldManager>".
+func newTestManifestsServer(t *testing.T) (*rest.Config, func() []string) {
+	var (
+		mu      sync.Mutex
+		applied []string
+	)
+
+	mux := http.NewServeMux()
+	serveJSON := func(path, body string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(body))
+		})
+	}
+	serveJSON("/api", `{"kind":"APIVersions","versions":["v1"],"serverAddressByClientCIDRs":[{"clientCIDR":"0.0.0.0/0","serverAddress":"127.0.0.1"}]}`)
+	serveJSON("/apis", `{"kind":"APIGroupList","apiVersion":"v1","groups":[]}`)
+	serveJSON("/api/v1", `{"kind":"APIResourceList","groupVersion":"v1","resources":[
+		{"name":"namespaces","singularName":"namespace","namespaced":false,"kind":"Namespace","verbs":["get","patch"]},
+		{"name":"configmaps","singularName":"configmap","namespaced":true,"kind":"ConfigMap","verbs":["get","patch"]}]}`)
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.Header.Get("Content-Type") != string(types.ApplyPatchType) {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		applied = append(applied, r.URL.Path+" "+r.URL.Query().Get("fieldManager"))
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &rest.Config{Host: server.URL}, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), applied...)
+	}
+}
+
+func TestReconcileManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := fakebackend.NewBackend(testRuntime)
+	svc := newTestService(t, g, backend, testRuntime)
+	svc.scope.ControlPlane.Spec.Manifests = []controlplanev1.ManifestSource{{Kind: controlplanev1.ManifestSourceConfigMap, Name: "manifests"}}
+	svc.scope.ControlPlane.Spec.ManifestsStrategy = controlplanev1.ManifestsStrategyApplyOnce
+	g.Expect(svc.scope.Client.Create(context.Background(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "manifests", Namespace: "default"},
+		Data: map[string]string{"manifests.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: test
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: test
+`},
+	})).To(Succeed())
+
+	config, applied := newTestManifestsServer(t)
+	expected := []string{"/api/v1/namespaces/test capk", "/api/v1/namespaces/test/configmaps/settings capk"}
+
+	g.Expect(svc.reconcileManifests(context.Background(), config)).To(Succeed())
+	g.Expect(applied()).To(Equal(expected))
+	g.Expect(conditions.IsTrue(svc.scope.ControlPlane, controlplanev1.ManifestsAppliedCondition)).To(BeTrue())
+	g.Expect(svc.scope.ControlPlane.Status.AppliedManifests).To(HaveLen(1))
+	g.Expect(svc.scope.ControlPlane.Status.AppliedManifests[0].Resources).To(Equal([]controlplanev1.AppliedResource{
+		{APIVersion: "v1", Kind: "Namespace", Name: "test"},
+		{APIVersion: "v1", Kind: "ConfigMap", Namespace: "test", Name: "settings"},
+	}))
+
+	// Applied once, the manifests aren't applied again.
+	g.Expect(svc.reconcileManifests(context.Background(), config)).To(Succeed())
+	g.Expect(applied()).To(Equal(expected))
+
+	// Until the cluster is recreated.
+	svc.scope.ControlPlane.Status.Initialized = true
+	_, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(svc.scope.ControlPlane.Status.AppliedManifests).To(BeEmpty())
+	g.Expect(conditions.Has(svc.scope.ControlPlane, controlplanev1.ManifestsAppliedCondition)).To(BeFalse())
+	waitForOperation(g, svc)
+
+	g.Expect(svc.reconcileManifests(context.Background(), config)).To(Succeed())
+	g.Expect(applied()).To(Equal(append(expected, expected...)))
+}
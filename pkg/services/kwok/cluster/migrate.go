@@ -0,0 +1,156 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/gc"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// providerEntries are the entries of the KwokCluster working directory owned by the provider
+// rather than by a cluster created there by earlier releases. They are never migrated.
+var providerEntries = map[string]bool{
+	"clusters":  true,
+	"locks":     true,
+	"snapshots": true,
+}
+
+// loadLegacyCluster returns the cluster created in the KwokCluster working directory itself by
+// earlier releases, before every cluster got its own working directory, or nil if there is none.
+func (s *Service) loadLegacyCluster(ctx context.Context) (services.BackendCluster, error) {
+	if !s.scope.ControlPlane.Status.Initialized {
+		return nil, nil
+	}
+
+	legacy, err := s.scope.Backend.Load(ctx, s.scope.Name(), s.scope.LegacyWorkDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("loading cluster %q from %q: %w", s.scope.Name(), s.scope.LegacyWorkDir(), err)
+	}
+
+	owner, err := gc.ReadOwner(s.scope.LegacyWorkDir())
+	if err != nil {
+		return nil, err
+	}
+	if owner != nil && (owner.Namespace != s.scope.ControlPlane.Namespace || owner.Name != s.scope.ControlPlane.Name) {
+		return nil, nil
+	}
+
+	return legacy, nil
+}
+
+// reconcileMigration moves a cluster from its legacy working directory to its own one. The state
+// of etcd is carried over with a snapshot, as the kind runtime keeps it in its container which is
+// removed when the cluster is brought down. rt is the cluster in its new working directory, and
+// legacy is nil when an earlier attempt already moved the cluster.
+func (s *Service) reconcileMigration(rt, legacy services.BackendCluster) ctrl.Result {
+	logger := s.scope.Logger
+	controlPlane := s.scope.ControlPlane
+
+	logger.Info("Cluster is migrating to its own working directory", "from", s.scope.LegacyWorkDir(), "to", s.scope.WorkDir())
+	if legacy != nil {
+		record.Eventf(controlPlane, "ClusterMigrating", "Moving cluster %q from %q to %q", s.scope.Name(), s.scope.LegacyWorkDir(), s.scope.WorkDir())
+	}
+	conditions.MarkFalse(controlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterMigratingReason, clusterv1.ConditionSeverityInfo, "")
+	controlPlane.Status.Ready = false
+
+	hibernated := controlPlane.Status.Hibernated
+	snapshot := s.scope.MigrationSnapshotPath()
+
+	return s.startOperation(controlplanev1.OperationTypeMigrate, func(ctx context.Context) error {
+		start := time.Now()
+
+		// Creating the moved cluster installs it again, rewriting the files holding the paths of
+		// the legacy working directory while keeping the pki, so clients of the cluster keep working.
+		created := rt
+		if legacy != nil {
+			created = legacy
+		}
+		conf, err := created.Config(ctx)
+		if err != nil {
+			return fmt.Errorf("getting config of cluster %q: %w", s.scope.Name(), err)
+		}
+
+		if legacy != nil {
+			if _, err := os.Stat(snapshot); errors.Is(err, os.ErrNotExist) {
+				if hibernated {
+					if err := legacy.Up(ctx); err != nil {
+						return fmt.Errorf("failed to start cluster %q: %w", s.scope.Name(), err)
+					}
+				}
+				if err := os.MkdirAll(filepath.Dir(snapshot), 0o750); err != nil {
+					return err
+				}
+				if err := legacy.SnapshotSave(ctx, snapshot); err != nil {
+					return fmt.Errorf("failed to save snapshot of cluster %q: %w", s.scope.Name(), err)
+				}
+			}
+
+			if err := legacy.Down(ctx); err != nil {
+				return fmt.Errorf("failed to bring down cluster %q: %w", s.scope.Name(), err)
+			}
+			if err := moveLegacyWorkDir(s.scope.LegacyWorkDir(), s.scope.WorkDir()); err != nil {
+				return fmt.Errorf("failed to move cluster %q: %w", s.scope.Name(), err)
+			}
+		}
+
+		if err := rt.Create(ctx, conf); err != nil {
+			return err
+		}
+
+		if err := rt.Up(ctx); err != nil {
+			return fmt.Errorf("failed to start cluster %q: %w", s.scope.Name(), err)
+		}
+		if err := rt.SnapshotRestore(ctx, snapshot); err != nil {
+			return fmt.Errorf("failed to restore snapshot into cluster %q: %w", s.scope.Name(), err)
+		}
+		if hibernated {
+			if err := rt.Stop(ctx); err != nil {
+				return fmt.Errorf("failed to stop cluster %q: %w", s.scope.Name(), err)
+			}
+		}
+		if err := os.Remove(snapshot); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		logger.Info("Cluster is migrated",
+			"elapsed", time.Since(start),
+		)
+		return nil
+	})
+}
+
+// moveLegacyWorkDir moves the files of the cluster in the legacy working directory from to its
+// own working directory to, leaving the entries owned by the provider in place.
+func moveLegacyWorkDir(from, to string) error {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(to, 0o750); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if providerEntries[entry.Name()] {
+			continue
+		}
+		if err := os.Rename(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
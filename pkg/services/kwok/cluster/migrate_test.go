@@ -0,0 +1,89 @@
+package cluster
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/gc"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+func TestReconcileMigration(t *testing.T) {
+	testCases := []struct {
+		name       string
+		hibernated bool
+		expect     []string
+	}{
+		{
+			name:   "moves a running cluster",
+			expect: []string{"test.Config", "test.Config", "test.SnapshotSave", "test.Down", "test.Create", "test.Up", "test.SnapshotRestore"},
+		},
+		{
+			name:       "moves a hibernated cluster and keeps it hibernated",
+			hibernated: true,
+			expect:     []string{"test.Config", "test.Config", "test.Up", "test.SnapshotSave", "test.Down", "test.Create", "test.Up", "test.SnapshotRestore", "test.Stop"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			backend := fakebackend.NewBackend(testRuntime)
+			svc := newTestService(t, g, backend, testRuntime)
+			svc.scope.ControlPlane.Status.Initialized = true
+			svc.scope.ControlPlane.Status.Hibernated = tc.hibernated
+
+			legacyDir := svc.scope.LegacyWorkDir()
+			g.Expect(backend.AddCluster("test", legacyDir, &internalversion.KwokctlConfiguration{
+				Options: internalversion.KwokctlConfigurationOptions{KubeApiserverPort: 32766},
+			}, !tc.hibernated)).To(Succeed())
+			g.Expect(os.WriteFile(filepath.Join(legacyDir, "kubeconfig.yaml"), nil, 0o600)).To(Succeed())
+			g.Expect(os.MkdirAll(filepath.Join(legacyDir, "snapshots", "default"), 0o750)).To(Succeed())
+
+			res, err := svc.Reconcile(context.Background())
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(res.RequeueAfter).To(Equal(operationPollInterval))
+			g.Expect(conditions.GetReason(svc.scope.ControlPlane, controlplanev1.ClusterAvailableCondition)).To(Equal(controlplanev1.ClusterMigratingReason))
+			waitForOperation(g, svc)
+
+			status, _ := svc.scope.Operations.Get(svc.scope.OperationKey())
+			g.Expect(status.Err).NotTo(HaveOccurred())
+			g.Expect(status.Type).To(Equal(string(controlplanev1.OperationTypeMigrate)))
+			g.Expect(backend.Calls()).To(Equal(tc.expect))
+
+			g.Expect(backend.HasCluster(svc.scope.WorkDir())).To(BeTrue())
+			g.Expect(backend.IsRunning(svc.scope.WorkDir())).To(Equal(!tc.hibernated))
+			g.Expect(filepath.Join(svc.scope.WorkDir(), "kubeconfig.yaml")).To(BeAnExistingFile())
+			g.Expect(filepath.Join(legacyDir, "kubeconfig.yaml")).NotTo(BeAnExistingFile())
+			g.Expect(filepath.Join(legacyDir, "snapshots", "default")).To(BeADirectory())
+			g.Expect(svc.scope.MigrationSnapshotPath()).NotTo(BeAnExistingFile())
+		})
+	}
+}
+
+func TestReconcileMigrationSkipsOtherOwners(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := fakebackend.NewBackend(testRuntime)
+	svc := newTestService(t, g, backend, testRuntime)
+	svc.scope.ControlPlane.Status.Initialized = true
+
+	g.Expect(backend.AddCluster("test", svc.scope.LegacyWorkDir(), &internalversion.KwokctlConfiguration{}, true)).To(Succeed())
+	g.Expect(gc.WriteOwner(svc.scope.LegacyWorkDir(), gc.Owner{Namespace: "other", Name: "test"})).To(Succeed())
+
+	_, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	waitForOperation(g, svc)
+
+	g.Expect(backend.Calls()).NotTo(ContainElement("test.Down"))
+	g.Expect(svc.scope.ControlPlane.Status.Operation.Type).To(Equal(controlplanev1.OperationTypeCreate))
+}
@@ -0,0 +1,71 @@
+package cluster
+
+import (
+	"strings"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+)
+
+// applyClusterNetwork passes the network of the Cluster to the components of the kwok cluster:
+//   - kube-apiserver and kube-controller-manager get the service CIDRs.
+//   - kube-controller-manager allocates the podCIDR of the nodes from the pod CIDRs, which
+//     kwok-controller then assigns pod IPs from.
+//   - kwok-controller falls back to the first pod CIDR for nodes without a podCIDR.
+//   - kube-apiserver issues service account tokens for the service domain. Tokens issued for the
+//     default cluster.local domain are still accepted. kwok clusters run neither kubelets nor
+//     cluster DNS, so no other component uses the service domain, and the serving certificate
+//     kwokctl generates for kube-apiserver only covers kubernetes.default.svc.cluster.local.
+func applyClusterNetwork(conf *internalversion.KwokctlConfiguration, network *clusterv1.ClusterNetwork) {
+	if network == nil {
+		return
+	}
+
+	if network.Services != nil && len(network.Services.CIDRBlocks) > 0 {
+		serviceCIDRs := strings.Join(network.Services.CIDRBlocks, ",")
+		addExtraArgs(conf, "kube-apiserver", internalversion.ExtraArgs{Key: "service-cluster-ip-range", Value: serviceCIDRs})
+		addExtraArgs(conf, "kube-controller-manager", internalversion.ExtraArgs{Key: "service-cluster-ip-range", Value: serviceCIDRs})
+	}
+
+	if network.Pods != nil && len(network.Pods.CIDRBlocks) > 0 {
+		addExtraArgs(conf, "kube-controller-manager",
+			internalversion.ExtraArgs{Key: "allocate-node-cidrs", Value: "true"},
+			internalversion.ExtraArgs{Key: "cluster-cidr", Value: strings.Join(network.Pods.CIDRBlocks, ",")},
+		)
+		addExtraArgs(conf, "kwok-controller", internalversion.ExtraArgs{Key: "cidr", Value: network.Pods.CIDRBlocks[0]})
+	}
+
+	// Service account tokens are only issued when kube-apiserver serves HTTPS.
+	if network.ServiceDomain != "" && conf.Options.SecurePort {
+		// kwokctl adds its own issuer for cluster.local after the extra args, the first one wins.
+		addExtraArgs(conf, "kube-apiserver", internalversion.ExtraArgs{Key: "service-account-issuer", Value: "https://kubernetes.default.svc." + network.ServiceDomain})
+	}
+}
+
+// addExtraArgs adds args to the patches of the named component, replacing any arg with the same key.
+func addExtraArgs(conf *internalversion.KwokctlConfiguration, component string, args ...internalversion.ExtraArgs) {
+	var patches *internalversion.ComponentPatches
+	for i := range conf.ComponentsPatches {
+		if conf.ComponentsPatches[i].Name == component {
+			patches = &conf.ComponentsPatches[i]
+			break
+		}
+	}
+	if patches == nil {
+		conf.ComponentsPatches = append(conf.ComponentsPatches, internalversion.ComponentPatches{Name: component})
+		patches = &conf.ComponentsPatches[len(conf.ComponentsPatches)-1]
+	}
+
+	for _, arg := range args {
+		replaced := false
+		for i := range patches.ExtraArgs {
+			if patches.ExtraArgs[i].Key == arg.Key {
+				patches.ExtraArgs[i].Value = arg.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			patches.ExtraArgs = append(patches.ExtraArgs, arg)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cluster
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+)
+
+func TestApplyClusterNetwork(t *testing.T) {
+	testCases := []struct {
+		name     string
+		network  *clusterv1.ClusterNetwork
+		patches  []internalversion.ComponentPatches
+		insecure bool
+		expected []internalversion.ComponentPatches
+	}{
+		{
+			name: "no cluster network",
+		},
+		{
+			name: "pods and services",
+			network: &clusterv1.ClusterNetwork{
+				Pods:     &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16"}},
+				Services: &clusterv1.NetworkRanges{CIDRBlocks: []string{"10.128.0.0/12"}},
+			},
+			expected: []internalversion.ComponentPatches{
+				{
+					Name: "kube-apiserver",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "service-cluster-ip-range", Value: "10.128.0.0/12"},
+					},
+				},
+				{
+					Name: "kube-controller-manager",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "service-cluster-ip-range", Value: "10.128.0.0/12"},
+						{Key: "allocate-node-cidrs", Value: "true"},
+						{Key: "cluster-cidr", Value: "192.168.0.0/16"},
+					},
+				},
+				{
+					Name: "kwok-controller",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "cidr", Value: "192.168.0.0/16"},
+					},
+				},
+			},
+		},
+		{
+			name: "existing patches are kept and overridden",
+			network: &clusterv1.ClusterNetwork{
+				Pods: &clusterv1.NetworkRanges{CIDRBlocks: []string{"192.168.0.0/16", "fd00::/48"}},
+			},
+			patches: []internalversion.ComponentPatches{
+				{
+					Name: "kwok-controller",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "v", Value: "4"},
+						{Key: "cidr", Value: "10.0.0.0/24"},
+					},
+				},
+			},
+			expected: []internalversion.ComponentPatches{
+				{
+					Name: "kwok-controller",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "v", Value: "4"},
+						{Key: "cidr", Value: "192.168.0.0/16"},
+					},
+				},
+				{
+					Name: "kube-controller-manager",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "allocate-node-cidrs", Value: "true"},
+						{Key: "cluster-cidr", Value: "192.168.0.0/16,fd00::/48"},
+					},
+				},
+			},
+		},
+		{
+			name:    "service domain",
+			network: &clusterv1.ClusterNetwork{ServiceDomain: "kwok.local"},
+			expected: []internalversion.ComponentPatches{
+				{
+					Name: "kube-apiserver",
+					ExtraArgs: []internalversion.ExtraArgs{
+						{Key: "service-account-issuer", Value: "https://kubernetes.default.svc.kwok.local"},
+					},
+				},
+			},
+		},
+		{
+			name:     "service domain without secure port",
+			network:  &clusterv1.ClusterNetwork{ServiceDomain: "kwok.local"},
+			insecure: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			conf := &internalversion.KwokctlConfiguration{
+				Options:           internalversion.KwokctlConfigurationOptions{SecurePort: !tc.insecure},
+				ComponentsPatches: tc.patches,
+			}
+			applyClusterNetwork(conf, tc.network)
+			g.Expect(conf.ComponentsPatches).To(Equal(tc.expected))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/lock"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+)
+
+// operationPollInterval is how often a running operation is polled for its result.
+const operationPollInterval = 5 * time.Second
+
+// startOperation runs fn in the background and requeues to poll for its result. If the last
+// attempt of the same operation failed, it is only retried once its backoff has elapsed.
+func (s *Service) startOperation(opType controlplanev1.OperationType, fn operation.Func) ctrl.Result {
+	logger := s.scope.Logger
+
+	attempts := int32(0)
+	if last := s.scope.ControlPlane.Status.Operation; last != nil && last.Type == opType && last.Phase == controlplanev1.OperationPhaseFailed {
+		attempts = last.Attempts
+
+		if last.CompletionTime != nil {
+			backoff := s.scope.Operations.RetryPolicy().Backoff(attempts)
+			if wait := backoff - time.Since(last.CompletionTime.Time); wait > 0 {
+				logger.V(2).Info("Waiting before retrying operation", "operation", opType, "attempts", attempts, "wait", wait)
+				return ctrl.Result{RequeueAfter: wait}
+			}
+		}
+	}
+
+	status, started := s.scope.Operations.Start(s.scope.OperationKey(), string(opType), s.withClusterLock(fn))
+	s.setOperationStatus(status)
+	if started {
+		logger.Info("Started operation", "operation", opType, "attempt", attempts+1)
+		s.scope.ControlPlane.Status.Operation.Attempts = attempts + 1
+	}
+
+	return ctrl.Result{RequeueAfter: operationPollInterval}
+}
+
+// withClusterLock wraps fn so it only runs while holding the lock of the cluster's working
+// directory, so kwokctl operations on one cluster never run concurrently, whether from racing
+// reconciles or from another manager replica sharing the directory.
+func (s *Service) withClusterLock(fn operation.Func) operation.Func {
+	return func(ctx context.Context) error {
+		logger := s.scope.Logger
+		l := lock.New(s.scope.LockPath())
+
+		logger.V(2).Info("Acquiring cluster lock", "path", l.Path())
+		if err := l.Lock(ctx); err != nil {
+			return fmt.Errorf("acquiring cluster lock: %w", err)
+		}
+		defer func() {
+			if err := l.Unlock(); err != nil {
+				logger.Error(err, "Failed to release cluster lock", "path", l.Path())
+			}
+		}()
+
+		return fn(ctx)
+	}
+}
+
+// checkOperation updates the status with the progress of the operation tracked for the
+// cluster. It returns the operation if it has finished, and whether an operation is
+// still running.
+func (s *Service) checkOperation() (*operation.Status, bool) {
+	logger := s.scope.Logger
+	key := s.scope.OperationKey()
+
+	status, ok := s.scope.Operations.Get(key)
+	if !ok {
+		if op := s.scope.ControlPlane.Status.Operation; op != nil && op.Phase == controlplanev1.OperationPhaseRunning {
+			// The operation is no longer tracked, e.g. the controller restarted while it was running.
+			now := metav1.Now()
+			op.Phase = controlplanev1.OperationPhaseFailed
+			op.CompletionTime = &now
+			op.Message = "operation was interrupted"
+		}
+		return nil, false
+	}
+
+	s.setOperationStatus(status)
+	if !status.Done() {
+		logger.V(2).Info("Waiting for operation", "operation", status.Type, "elapsed", time.Since(status.StartTime))
+		return nil, true
+	}
+
+	s.scope.Operations.Forget(key)
+	logger.Info("Operation finished",
+		"operation", status.Type,
+		"elapsed", status.CompletionTime.Sub(status.StartTime),
+		"error", status.Err,
+	)
+
+	return &status, false
+}
+
+// handleOperationError decides what to do with a failed operation. Permanent errors, and
+// errors of operations that ran out of attempts, are reported as a terminal failure of the
+// control plane. Any other error is retried after a backoff.
+func (s *Service) handleOperationError(status *operation.Status) ctrl.Result {
+	op := s.scope.ControlPlane.Status.Operation
+	policy := s.scope.Operations.RetryPolicy()
+
+	if operation.IsPermanent(status.Err) || policy.Exhausted(op.Attempts) {
+		s.setFailure(failureReasonFor(op.Type), status.Err)
+		return ctrl.Result{}
+	}
+
+	backoff := policy.Backoff(op.Attempts)
+	record.Warnf(s.scope.ControlPlane, "OperationFailed", "%s operation failed for cluster %q, retrying in %s (attempt %d): %v", op.Type, s.scope.Name(), backoff, op.Attempts, status.Err)
+
+	return ctrl.Result{RequeueAfter: backoff}
+}
+
+// setFailure reports a terminal failure on the control plane.
+func (s *Service) setFailure(reason capierrors.ClusterStatusError, err error) {
+	s.scope.Logger.Error(err, "Terminal failure reconciling cluster", "reason", reason)
+
+	message := err.Error()
+	s.scope.ControlPlane.Status.FailureReason = &reason
+	s.scope.ControlPlane.Status.FailureMessage = &message
+	s.scope.ControlPlane.Status.Ready = false
+
+	record.Warnf(s.scope.ControlPlane, "ReconcileFailed", "Terminal failure reconciling cluster %q: %v", s.scope.Name(), err)
+}
+
+func (s *Service) setOperationStatus(status operation.Status) {
+	op := &controlplanev1.OperationStatus{
+		Type:      controlplanev1.OperationType(status.Type),
+		Phase:     controlplanev1.OperationPhaseRunning,
+		StartTime: metav1.NewTime(status.StartTime),
+	}
+
+	// Keep counting the attempts of the same type of operation.
+	if last := s.scope.ControlPlane.Status.Operation; last != nil && last.Type == op.Type {
+		op.Attempts = last.Attempts
+		op.Snapshot = last.Snapshot
+	}
+
+	if status.Done() {
+		completionTime := metav1.NewTime(status.CompletionTime)
+		op.CompletionTime = &completionTime
+		op.Phase = controlplanev1.OperationPhaseSucceeded
+		if status.Err != nil {
+			op.Phase = controlplanev1.OperationPhaseFailed
+			op.Message = status.Err.Error()
+		}
+	}
+
+	s.scope.ControlPlane.Status.Operation = op
+}
+
+func failureReasonFor(opType controlplanev1.OperationType) capierrors.ClusterStatusError {
+	switch opType {
+	case controlplanev1.OperationTypeDelete:
+		return capierrors.DeleteClusterError
+	case controlplanev1.OperationTypeStop, controlplanev1.OperationTypeRestart, controlplanev1.OperationTypeRestore, controlplanev1.OperationTypeMigrate, controlplanev1.OperationTypeUpgrade:
+		return capierrors.UpdateClusterError
+	default:
+		return capierrors.CreateClusterError
+	}
+}
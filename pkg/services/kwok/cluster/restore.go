@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// snapshotPollInterval is how often a snapshot to restore is checked for completion.
+const snapshotPollInterval = 10 * time.Second
+
+// reconcileRestore restores the snapshot referenced by spec.restoreFrom into the running
+// cluster, once. It returns true while the snapshot is not restored yet.
+func (s *Service) reconcileRestore(ctx context.Context, rt services.BackendCluster) (ctrl.Result, bool, error) {
+	logger := s.scope.Logger
+	controlPlane := s.scope.ControlPlane
+
+	name := controlPlane.Spec.RestoreFrom
+	if name == "" || controlPlane.Status.RestoredSnapshot == name {
+		return ctrl.Result{}, false, nil
+	}
+	controlPlane.Status.Ready = false
+
+	// Only the restore of the snapshot currently referenced counts, spec.restoreFrom may have
+	// changed since an earlier restore.
+	if op := controlPlane.Status.Operation; op != nil && op.Type == controlplanev1.OperationTypeRestore && op.Phase == controlplanev1.OperationPhaseSucceeded && op.Snapshot == name {
+		logger.Info("Snapshot is restored", "snapshot", name)
+		record.Eventf(controlPlane, "SnapshotRestored", "Restored snapshot %q into cluster %q", name, s.scope.Name())
+		conditions.MarkTrue(controlPlane, controlplanev1.SnapshotRestoredCondition)
+		controlPlane.Status.RestoredSnapshot = name
+		return ctrl.Result{}, false, nil
+	}
+
+	snapshot := &controlplanev1.KwokClusterSnapshot{}
+	if err := s.scope.Client.Get(ctx, types.NamespacedName{Namespace: controlPlane.Namespace, Name: name}, snapshot); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, true, fmt.Errorf("getting snapshot %q: %w", name, err)
+		}
+		snapshot = nil
+	}
+
+	switch {
+	case snapshot != nil && snapshot.Status.Phase == controlplanev1.SnapshotPhaseFailed:
+		s.setFailure(capierrors.InvalidConfigurationClusterError, fmt.Errorf("snapshot %q to restore failed", name))
+		return ctrl.Result{}, true, nil
+	case snapshot == nil || snapshot.Status.Phase != controlplanev1.SnapshotPhaseCompleted:
+		logger.Info("Waiting for snapshot to be completed", "snapshot", name)
+		conditions.MarkFalse(controlPlane, controlplanev1.SnapshotRestoredCondition, controlplanev1.WaitingForSnapshotReason, clusterv1.ConditionSeverityInfo, "Waiting for snapshot %q to be completed", name)
+		return ctrl.Result{RequeueAfter: snapshotPollInterval}, true, nil
+	}
+
+	logger.Info("Restoring snapshot", "snapshot", name, "path", snapshot.Status.Path)
+	conditions.MarkFalse(controlPlane, controlplanev1.SnapshotRestoredCondition, controlplanev1.SnapshotRestoringReason, clusterv1.ConditionSeverityInfo, "")
+
+	path := snapshot.Status.Path
+	res := s.startOperation(controlplanev1.OperationTypeRestore, func(ctx context.Context) error {
+		if err := rt.SnapshotRestore(ctx, path); err != nil {
+			return fmt.Errorf("failed to restore snapshot %q: %w", name, err)
+		}
+		return nil
+	})
+	if op := controlPlane.Status.Operation; op != nil && op.Type == controlplanev1.OperationTypeRestore && op.Phase == controlplanev1.OperationPhaseRunning {
+		op.Snapshot = name
+	}
+	return res, true, nil
+}
@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+func TestReconcileRestoreChangedSnapshot(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	backend := fakebackend.NewBackend(testRuntime)
+	svc := newTestService(t, g, backend, testRuntime)
+	addTestCluster(g, svc, backend, newTestAPIServer(t, g, http.StatusOK))
+	g.Expect(svc.scope.Client.Create(ctx, &controlplanev1.KwokClusterSnapshot{
+		ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"},
+		Status:     controlplanev1.KwokClusterSnapshotStatus{Phase: controlplanev1.SnapshotPhaseCompleted, Path: "new.db"},
+	})).To(Succeed())
+
+	// The last operation restored another snapshot, before spec.restoreFrom was changed.
+	controlPlane := svc.scope.ControlPlane
+	controlPlane.Status.Initialized = true
+	controlPlane.Status.RestoredSnapshot = "old"
+	controlPlane.Status.Operation = &controlplanev1.OperationStatus{
+		Type:     controlplanev1.OperationTypeRestore,
+		Phase:    controlplanev1.OperationPhaseSucceeded,
+		Snapshot: "old",
+	}
+	controlPlane.Spec.RestoreFrom = "new"
+
+	_, err := svc.Reconcile(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(controlPlane.Status.RestoredSnapshot).To(Equal("old"))
+	g.Expect(controlPlane.Status.Operation.Snapshot).To(Equal("new"))
+	waitForOperation(g, svc)
+	g.Expect(backend.Calls()).To(ContainElement("test.SnapshotRestore"))
+
+	_, err = svc.Reconcile(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(controlPlane.Status.RestoredSnapshot).To(Equal("new"))
+}
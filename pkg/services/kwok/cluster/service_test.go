@@ -0,0 +1,300 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/secret"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/gc"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/operation"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+const testRuntime = "docker"
+
+// newTestService returns a service reconciling the control plane of the "test" cluster with
+// the given backend, with its working directories in a temporary directory.
+func newTestService(t *testing.T, g *WithT, backend services.Backend, runtimeName string) *Service {
+	s := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	g.Expect(controlplanev1.AddToScheme(s)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneRef: &corev1.ObjectReference{
+				APIVersion: controlplanev1.GroupVersion.String(),
+				Kind:       "KwokControlPlane",
+				Name:       "test",
+			},
+		},
+	}
+	controlPlane := &controlplanev1.KwokControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+	}
+	kwokCluster := &infrav1.KwokCluster{
+		Spec: infrav1.KwokClusterSpec{Runtime: runtimeName, WorkingDir: t.TempDir()},
+	}
+
+	logger := log.FromContext(context.Background())
+	return NewService(&scope.ControlPlaneScope{
+		Client:       fake.NewClientBuilder().WithScheme(s).Build(),
+		Cluster:      cluster,
+		ControlPlane: controlPlane,
+		KwokCluster:  kwokCluster,
+		Operations:   operation.NewTracker(context.Background(), operation.Options{}),
+		Backend:      backend,
+		Logger:       &logger,
+	})
+}
+
+// newTestAPIServer starts a fake API server whose readiness endpoints answer with the given
+// status, and returns its port.
+func newTestAPIServer(t *testing.T, g *WithT, readyz int) uint32 {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(readyz)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz/etcd", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(readyz)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/api/v1/nodes", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"NodeList","items":[]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	g.Expect(err).NotTo(HaveOccurred())
+	port, err := strconv.ParseUint(u.Port(), 10, 32)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	return uint32(port)
+}
+
+// addTestCluster adds the running cluster of the control plane to the backend.
+func addTestCluster(g *WithT, svc *Service, backend *fakebackend.Backend, port uint32) {
+	g.Expect(backend.AddCluster(svc.scope.Name(), svc.scope.WorkDir(), &internalversion.KwokctlConfiguration{
+		Options: internalversion.KwokctlConfigurationOptions{KubeApiserverPort: port},
+	}, true)).To(Succeed())
+}
+
+// waitForOperation waits for the operation of the control plane to finish.
+func waitForOperation(g *WithT, svc *Service) {
+	g.Eventually(func() bool {
+		status, ok := svc.scope.Operations.Get(svc.scope.OperationKey())
+		return ok && status.Done()
+	}).Should(BeTrue())
+}
+
+func TestReconcile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		runtime string
+		// readyz is the status of the API server of an existing cluster, none exists when zero.
+		readyz  int
+		failOn  string
+		version string
+		expect  func(g *WithT, svc *Service, backend *fakebackend.Backend)
+	}{
+		{
+			name:    "creates a missing cluster",
+			runtime: testRuntime,
+			expect: func(g *WithT, svc *Service, backend *fakebackend.Backend) {
+				g.Expect(backend.Calls()).To(ContainElement("test.Create"))
+				g.Expect(backend.HasCluster(svc.scope.WorkDir())).To(BeTrue())
+
+				owner, err := gc.ReadOwner(svc.scope.WorkDir())
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(owner).To(Equal(&gc.Owner{Namespace: "default", Name: "test", UID: "uid"}))
+			},
+		},
+		{
+			name:    "creates a cluster with the requested version",
+			runtime: testRuntime,
+			version: "v1.26.0",
+			expect: func(g *WithT, svc *Service, backend *fakebackend.Backend) {
+				g.Expect(backend.Calls()).To(ContainElement("test.Create"))
+				g.Expect(svc.scope.ControlPlane.Status.Version).To(Equal("v1.26.0"))
+			},
+		},
+		{
+			name:    "retries a failed create",
+			runtime: testRuntime,
+			failOn:  "Create",
+			expect: func(g *WithT, svc *Service, backend *fakebackend.Backend) {
+				g.Expect(backend.HasCluster(svc.scope.WorkDir())).To(BeFalse())
+				g.Expect(svc.scope.ControlPlane.Status.Operation.Phase).To(Equal(controlplanev1.OperationPhaseFailed))
+				g.Expect(svc.scope.ControlPlane.Status.FailureReason).To(BeNil())
+			},
+		},
+		{
+			name:    "marks an existing healthy cluster ready",
+			runtime: testRuntime,
+			readyz:  http.StatusOK,
+			expect: func(g *WithT, svc *Service, backend *fakebackend.Backend) {
+				g.Expect(backend.Calls()).NotTo(ContainElement("test.Create"))
+				g.Expect(backend.Calls()).NotTo(ContainElement("test.Up"))
+				g.Expect(svc.scope.ControlPlane.Status.Ready).To(BeTrue())
+				g.Expect(svc.scope.ControlPlane.Status.Initialized).To(BeTrue())
+				g.Expect(conditions.IsTrue(svc.scope.ControlPlane, controlplanev1.ComponentsHealthyCondition)).To(BeTrue())
+			},
+		},
+		{
+			name:    "starts an existing cluster that is not serving",
+			runtime: testRuntime,
+			readyz:  http.StatusInternalServerError,
+			expect: func(g *WithT, svc *Service, backend *fakebackend.Backend) {
+				g.Expect(backend.Calls()).To(ContainElement("test.Up"))
+				g.Expect(svc.scope.ControlPlane.Status.Ready).To(BeFalse())
+				g.Expect(conditions.GetReason(svc.scope.ControlPlane, controlplanev1.ClusterAvailableCondition)).To(Equal(controlplanev1.ClusterStartingReason))
+			},
+		},
+		{
+			name:    "fails on an unknown runtime",
+			runtime: "unknown",
+			expect: func(g *WithT, svc *Service, backend *fakebackend.Backend) {
+				g.Expect(backend.Calls()).To(BeEmpty())
+				g.Expect(svc.scope.ControlPlane.Status.FailureReason).To(HaveValue(Equal(capierrors.InvalidConfigurationClusterError)))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			backend := fakebackend.NewBackend(testRuntime)
+			if tc.failOn != "" {
+				backend.FailOn(tc.failOn, errors.New("injected failure"))
+			}
+			svc := newTestService(t, g, backend, tc.runtime)
+			svc.scope.ControlPlane.Spec.Version = tc.version
+			if tc.readyz != 0 {
+				addTestCluster(g, svc, backend, newTestAPIServer(t, g, tc.readyz))
+			}
+
+			res, err := svc.Reconcile(context.Background())
+			g.Expect(err).NotTo(HaveOccurred())
+			if res.RequeueAfter == operationPollInterval {
+				waitForOperation(g, svc)
+
+				_, err = svc.Reconcile(context.Background())
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+
+			tc.expect(g, svc, backend)
+		})
+	}
+}
+
+func TestReconcileKubeconfig(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := fakebackend.NewBackend(testRuntime)
+	svc := newTestService(t, g, backend, testRuntime)
+	port := newTestAPIServer(t, g, http.StatusOK)
+	addTestCluster(g, svc, backend, port)
+
+	_, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(svc.scope.ControlPlane.Spec.ControlPlaneEndpoint).To(Equal(clusterv1.APIEndpoint{Host: "127.0.0.1", Port: int32(port)}))
+
+	configSecret, err := secret.GetFromNamespacedName(context.Background(), svc.scope.Client, types.NamespacedName{Namespace: "default", Name: "test"}, secret.Kubeconfig)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(configSecret.OwnerReferences).To(HaveLen(1))
+
+	config, err := clientcmd.Load(configSecret.Data[secret.KubeconfigDataName])
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(config.Clusters["test"].Server).To(Equal("http://127.0.0.1:" + strconv.Itoa(int(port))))
+}
+
+func TestDelete(t *testing.T) {
+	testCases := []struct {
+		name         string
+		exists       bool
+		failOn       string
+		expectCalls  []string
+		expectExists bool
+		expectPhase  controlplanev1.OperationPhase
+	}{
+		{
+			name:        "deletes an existing cluster",
+			exists:      true,
+			expectCalls: []string{"test.Down", "test.Delete"},
+			expectPhase: controlplanev1.OperationPhaseSucceeded,
+		},
+		{
+			name: "skips a missing cluster",
+		},
+		{
+			name:         "keeps the cluster when stopping it fails",
+			exists:       true,
+			failOn:       "Down",
+			expectCalls:  []string{"test.Down"},
+			expectExists: true,
+			expectPhase:  controlplanev1.OperationPhaseFailed,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			backend := fakebackend.NewBackend(testRuntime)
+			if tc.failOn != "" {
+				backend.FailOn(tc.failOn, errors.New("injected failure"))
+			}
+			svc := newTestService(t, g, backend, testRuntime)
+			if tc.exists {
+				addTestCluster(g, svc, backend, 0)
+			}
+
+			res, err := svc.Delete(context.Background())
+			g.Expect(err).NotTo(HaveOccurred())
+			if tc.exists {
+				g.Expect(res.RequeueAfter).To(Equal(operationPollInterval))
+				waitForOperation(g, svc)
+
+				_, err = svc.Delete(context.Background())
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(svc.scope.ControlPlane.Status.Operation.Phase).To(Equal(tc.expectPhase))
+			} else {
+				g.Expect(res.IsZero()).To(BeTrue())
+			}
+
+			g.Expect(backend.Calls()).To(Equal(tc.expectCalls))
+			g.Expect(backend.HasCluster(svc.scope.WorkDir())).To(Equal(tc.expectExists))
+			_, err = os.Stat(svc.scope.WorkDir())
+			g.Expect(os.IsNotExist(err)).To(Equal(!tc.expectExists))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	sharedv1 "github.com/capi-samples/cluster-api-provider-kwok/api/shared/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services/simulated"
+)
+
+// TestReconcileSimulated runs a cluster of the simulated runtime through the same reconcile as
+// the kwokctl runtimes, up to applying its manifests.
+func TestReconcileSimulated(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	svc := newTestService(t, g, simulated.New(), infrav1.RuntimeSimulated)
+	svc.scope.ControlPlane.Spec.Manifests = []controlplanev1.ManifestSource{{Kind: controlplanev1.ManifestSourceConfigMap, Name: "manifests"}}
+	g.Expect(svc.scope.Client.Create(ctx, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "manifests", Namespace: "default"},
+		Data: map[string]string{"manifests.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: default
+`},
+	})).To(Succeed())
+	t.Cleanup(func() {
+		_, _ = svc.Delete(ctx)
+		waitForOperation(g, svc)
+	})
+
+	// Created, then started.
+	for i := 0; i < 2; i++ {
+		_, err := svc.Reconcile(ctx)
+		g.Expect(err).NotTo(HaveOccurred())
+		waitForOperation(g, svc)
+	}
+
+	res, err := svc.Reconcile(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(healthProbeInterval))
+	g.Expect(svc.scope.ControlPlane.Status.Ready).To(BeTrue())
+	g.Expect(conditions.IsTrue(svc.scope.ControlPlane, controlplanev1.ComponentsHealthyCondition)).To(BeTrue())
+	g.Expect(conditions.IsTrue(svc.scope.ControlPlane, controlplanev1.ManifestsAppliedCondition)).To(BeTrue())
+
+	port := svc.scope.ControlPlane.Spec.ControlPlaneEndpoint.Port
+	g.Expect(port).NotTo(BeZero())
+	rt, err := svc.scope.Backend.Load(ctx, svc.scope.Name(), svc.scope.WorkDir())
+	g.Expect(err).NotTo(HaveOccurred())
+	conf, err := rt.Config(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(conf.ComponentsPatches).To(ContainElement(internalversion.ComponentPatches{
+		Name:      "kube-apiserver",
+		ExtraArgs: []internalversion.ExtraArgs{{Key: "bind-address", Value: "127.0.0.1"}},
+	}))
+	client, err := kubernetes.NewForConfig(svc.clusterRestConfig(uint32(port)))
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "settings", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+}
+
+func TestReconcileSimulatedProvisioningDelay(t *testing.T) {
+	g := NewWithT(t)
+
+	svc := newTestService(t, g, simulated.New(), infrav1.RuntimeSimulated)
+	svc.scope.ControlPlane.CreationTimestamp = metav1.Now()
+	svc.scope.ControlPlane.Spec.SimulationConfig = &sharedv1.SimulationConfig{
+		Reconcile: &sharedv1.ReconcileSimulation{Latency: metav1.Duration{Duration: time.Hour}},
+	}
+
+	res, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(BeNumerically(">", 59*time.Minute))
+	g.Expect(conditions.GetReason(svc.scope.ControlPlane, controlplanev1.ClusterAvailableCondition)).To(Equal(controlplanev1.ClusterCreatingReason))
+	_, running := svc.scope.Operations.Get(svc.scope.OperationKey())
+	g.Expect(running).To(BeFalse())
+}
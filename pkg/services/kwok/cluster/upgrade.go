@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// reconcileUpgrade upgrades the running cluster to spec.version. kwokctl can't change the version
+// of a cluster in place, so the cluster is installed again with the new version, carrying the state
+// of etcd over with a snapshot. It returns true while the cluster is upgrading.
+func (s *Service) reconcileUpgrade(ctx context.Context, rt services.BackendCluster, config *internalversion.KwokctlConfiguration) (ctrl.Result, bool, error) {
+	logger := s.scope.Logger
+	controlPlane := s.scope.ControlPlane
+
+	version := config.Options.KubeVersion
+	upgrade := controlPlane.Spec.Version != "" && controlPlane.Spec.Version != version
+	if upgrade {
+		version = controlPlane.Spec.Version
+	}
+
+	// The snapshot is left behind when an earlier attempt reinstalled the cluster but failed to
+	// restore it.
+	snapshot := s.scope.UpgradeSnapshotPath()
+	_, err := os.Stat(snapshot)
+	saved := err == nil
+
+	if !upgrade && !saved {
+		return ctrl.Result{}, false, nil
+	}
+	conf, err := withKubeVersion(ctx, config, version)
+	if err != nil {
+		return ctrl.Result{}, false, err
+	}
+	controlPlane.Status.Ready = false
+
+	if upgrade {
+		logger.Info("Cluster is upgrading", "from", config.Options.KubeVersion, "to", version)
+		record.Eventf(controlPlane, "ClusterUpgrading", "Upgrading cluster %q from %s to %s", s.scope.Name(), config.Options.KubeVersion, version)
+	}
+	conditions.MarkFalse(controlPlane, controlplanev1.ClusterAvailableCondition, controlplanev1.ClusterUpgradingReason, clusterv1.ConditionSeverityInfo, "Upgrading to %s", version)
+
+	return s.startOperation(controlplanev1.OperationTypeUpgrade, func(ctx context.Context) error {
+		start := time.Now()
+
+		if upgrade {
+			if !saved {
+				if err := os.MkdirAll(filepath.Dir(snapshot), 0o750); err != nil {
+					return err
+				}
+				if err := rt.SnapshotSave(ctx, snapshot); err != nil {
+					return fmt.Errorf("failed to save snapshot of cluster %q: %w", s.scope.Name(), err)
+				}
+			}
+
+			if err := rt.Down(ctx); err != nil {
+				return fmt.Errorf("failed to bring down cluster %q: %w", s.scope.Name(), err)
+			}
+			if err := rt.Create(ctx, conf); err != nil {
+				return err
+			}
+			if err := rt.Up(ctx); err != nil {
+				return fmt.Errorf("failed to start cluster %q: %w", s.scope.Name(), err)
+			}
+		}
+
+		if err := rt.SnapshotRestore(ctx, snapshot); err != nil {
+			return fmt.Errorf("failed to restore snapshot into cluster %q: %w", s.scope.Name(), err)
+		}
+		if err := os.Remove(snapshot); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		logger.Info("Cluster is upgraded",
+			"version", version,
+			"elapsed", time.Since(start),
+		)
+		return nil
+	}), true, nil
+}
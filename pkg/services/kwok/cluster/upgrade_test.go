@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/config"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+func TestWithKubeVersion(t *testing.T) {
+	g := NewWithT(t)
+
+	conf := config.GetKwokctlConfiguration(context.Background()).DeepCopy()
+	conf.Options.KubeApiserverPort = 32766
+
+	upgraded, err := withKubeVersion(context.Background(), conf, "v1.25.3")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(upgraded.Options.KubeVersion).To(Equal("v1.25.3"))
+	g.Expect(upgraded.Options.KubeApiserverImage).To(HaveSuffix(":v1.25.3"))
+	g.Expect(upgraded.Options.KindNodeImage).To(HaveSuffix(":v1.25.3"))
+	g.Expect(upgraded.Options.KubeApiserverPort).To(Equal(uint32(32766)))
+	g.Expect(conf.Options.KubeVersion).NotTo(Equal("v1.25.3"), "the configuration must be copied")
+}
+
+func TestReconcileUpgrade(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := fakebackend.NewBackend(testRuntime)
+	svc := newTestService(t, g, backend, testRuntime)
+	svc.scope.ControlPlane.Status.Initialized = true
+	svc.scope.ControlPlane.Spec.Version = "v1.25.3"
+
+	port := newTestAPIServer(t, g, http.StatusOK)
+	conf := config.GetKwokctlConfiguration(context.Background()).DeepCopy()
+	conf.Options.KubeVersion = "v1.24.7"
+	conf.Options.KubeApiserverPort = port
+	g.Expect(backend.AddCluster("test", svc.scope.WorkDir(), conf, true)).To(Succeed())
+
+	res, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(operationPollInterval))
+	g.Expect(svc.scope.ControlPlane.Status.Ready).To(BeFalse())
+	g.Expect(conditions.GetReason(svc.scope.ControlPlane, controlplanev1.ClusterAvailableCondition)).To(Equal(controlplanev1.ClusterUpgradingReason))
+	waitForOperation(g, svc)
+
+	var calls []string
+	for _, call := range backend.Calls() {
+		if !strings.HasSuffix(call, ".Config") && !strings.HasSuffix(call, ".Available") {
+			calls = append(calls, call)
+		}
+	}
+	g.Expect(calls).To(Equal([]string{"test.SnapshotSave", "test.Down", "test.Create", "test.Up", "test.SnapshotRestore"}))
+	g.Expect(svc.scope.UpgradeSnapshotPath()).NotTo(BeAnExistingFile())
+
+	rt, err := backend.Load(context.Background(), "test", svc.scope.WorkDir())
+	g.Expect(err).NotTo(HaveOccurred())
+	upgraded, err := rt.Config(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(upgraded.Options.KubeVersion).To(Equal("v1.25.3"))
+	g.Expect(upgraded.Options.KubeApiserverImage).To(HaveSuffix(":v1.25.3"))
+	g.Expect(upgraded.Options.KubeApiserverPort).To(Equal(port))
+
+	_, err = svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(svc.scope.ControlPlane.Status.Version).To(Equal("v1.25.3"))
+	g.Expect(svc.scope.ControlPlane.Status.Ready).To(BeTrue())
+	g.Expect(backend.Calls()).NotTo(ContainElement("test.Stop"))
+}
+
+func TestReconcileUpgradeResumesRestore(t *testing.T) {
+	g := NewWithT(t)
+
+	backend := fakebackend.NewBackend(testRuntime)
+	svc := newTestService(t, g, backend, testRuntime)
+	svc.scope.ControlPlane.Status.Initialized = true
+	svc.scope.ControlPlane.Spec.Version = "v1.25.3"
+	g.Expect(backend.AddCluster("test", svc.scope.WorkDir(), &internalversion.KwokctlConfiguration{
+		Options: internalversion.KwokctlConfigurationOptions{KubeVersion: "v1.25.3", KubeApiserverPort: newTestAPIServer(t, g, http.StatusOK)},
+	}, true)).To(Succeed())
+
+	// An earlier attempt upgraded the cluster but failed to restore the snapshot.
+	g.Expect(os.MkdirAll(filepath.Dir(svc.scope.UpgradeSnapshotPath()), 0o750)).To(Succeed())
+	g.Expect(os.WriteFile(svc.scope.UpgradeSnapshotPath(), nil, 0o600)).To(Succeed())
+
+	_, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	waitForOperation(g, svc)
+
+	g.Expect(backend.Calls()).To(ContainElement("test.SnapshotRestore"))
+	g.Expect(backend.Calls()).NotTo(ContainElement("test.Create"))
+	g.Expect(svc.scope.UpgradeSnapshotPath()).NotTo(BeAnExistingFile())
+}
@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/config"
+)
+
+// withKubeVersion returns a copy of conf for the given Kubernetes version. The images and binaries
+// of the components, their feature gates and the version of etcd are derived from the Kubernetes
+// version when kwokctl defaults its configuration, so they are defaulted again for the new version.
+func withKubeVersion(ctx context.Context, conf *internalversion.KwokctlConfiguration, version string) (*internalversion.KwokctlConfiguration, error) {
+	conf = conf.DeepCopy()
+	if conf.Options.KubeVersion == version {
+		return conf, nil
+	}
+
+	options := &conf.Options
+	options.KubeVersion = version
+	options.KubeFeatureGates = ""
+	options.KubeRuntimeConfig = ""
+	options.KubectlBinary = ""
+	options.KubeApiserverBinary = ""
+	options.KubeControllerManagerBinary = ""
+	options.KubeSchedulerBinary = ""
+	options.KubeApiserverImage = ""
+	options.KubeControllerManagerImage = ""
+	options.KubeSchedulerImage = ""
+	options.EtcdVersion = ""
+	options.EtcdBinaryTar = ""
+	options.EtcdImage = ""
+	options.KindNodeImage = ""
+
+	// kwokctl only defaults the configurations it loads.
+	dir, err := os.MkdirTemp("", "kwokctl-config")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "kwok.yaml")
+	if err := config.Save(ctx, path, []config.InternalObject{conf}); err != nil {
+		return nil, fmt.Errorf("saving kwokctl configuration: %w", err)
+	}
+	objs, err := config.Load(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("loading kwokctl configuration: %w", err)
+	}
+	confs := config.FilterWithType[*internalversion.KwokctlConfiguration](objs)
+	if len(confs) == 0 {
+		return nil, fmt.Errorf("kwokctl configuration for version %s not found", version)
+	}
+
+	return confs[0], nil
+}
@@ -0,0 +1,103 @@
+package machines
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+)
+
+// cloneInfrastructure creates the infrastructure of a control plane Machine from the infrastructure
+// template of the machine template, the same way Cluster API clones templates.
+func (s *Service) cloneInfrastructure(ctx context.Context, name string, labels map[string]string) (*corev1.ObjectReference, error) {
+	controlPlane := s.scope.ControlPlane
+	templateRef := controlPlane.Spec.MachineTemplate.InfrastructureRef
+
+	namespace := templateRef.Namespace
+	if namespace == "" {
+		namespace = controlPlane.Namespace
+	}
+	template := &unstructured.Unstructured{}
+	template.SetAPIVersion(templateRef.APIVersion)
+	template.SetKind(templateRef.Kind)
+	if err := s.scope.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: templateRef.Name}, template); err != nil {
+		return nil, err
+	}
+
+	spec, _, err := unstructured.NestedMap(template.Object, "spec", "template", "spec")
+	if err != nil {
+		return nil, fmt.Errorf("reading template spec: %w", err)
+	}
+	templateLabels, _, err := unstructured.NestedStringMap(template.Object, "spec", "template", "metadata", "labels")
+	if err != nil {
+		return nil, fmt.Errorf("reading template labels: %w", err)
+	}
+	templateAnnotations, _, err := unstructured.NestedStringMap(template.Object, "spec", "template", "metadata", "annotations")
+	if err != nil {
+		return nil, fmt.Errorf("reading template annotations: %w", err)
+	}
+
+	infra := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	if spec != nil {
+		infra.Object["spec"] = spec
+	}
+	infra.SetAPIVersion(template.GetAPIVersion())
+	infra.SetKind(strings.TrimSuffix(template.GetKind(), clusterv1.TemplateSuffix))
+	infra.SetNamespace(controlPlane.Namespace)
+	infra.SetName(name)
+	infra.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: controlplanev1.GroupVersion.String(),
+		Kind:       controlplanev1.KwokControlPlaneKind,
+		Name:       controlPlane.Name,
+		UID:        controlPlane.UID,
+	}})
+
+	if templateLabels == nil {
+		templateLabels = map[string]string{}
+	}
+	for k, v := range labels {
+		templateLabels[k] = v
+	}
+	infra.SetLabels(templateLabels)
+
+	if templateAnnotations == nil {
+		templateAnnotations = map[string]string{}
+	}
+	for k, v := range controlPlane.Spec.MachineTemplate.ObjectMeta.Annotations {
+		templateAnnotations[k] = v
+	}
+	templateAnnotations[clusterv1.TemplateClonedFromNameAnnotation] = template.GetName()
+	templateAnnotations[clusterv1.TemplateClonedFromGroupKindAnnotation] = template.GroupVersionKind().GroupKind().String()
+	infra.SetAnnotations(templateAnnotations)
+
+	if err := s.scope.Client.Create(ctx, infra); err != nil {
+		return nil, err
+	}
+
+	return &corev1.ObjectReference{
+		APIVersion: infra.GetAPIVersion(),
+		Kind:       infra.GetKind(),
+		Namespace:  infra.GetNamespace(),
+		Name:       infra.GetName(),
+	}, nil
+}
+
+func (s *Service) deleteInfrastructure(ctx context.Context, ref *corev1.ObjectReference) error {
+	infra := &unstructured.Unstructured{}
+	infra.SetAPIVersion(ref.APIVersion)
+	infra.SetKind(ref.Kind)
+	infra.SetNamespace(ref.Namespace)
+	infra.SetName(ref.Name)
+	if err := s.scope.Client.Delete(ctx, infra); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
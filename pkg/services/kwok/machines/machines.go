@@ -0,0 +1,319 @@
+package machines
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+)
+
+// deletePollInterval is how often the control plane Machines are checked while they are deleted.
+const deletePollInterval = 5 * time.Second
+
+// Reconcile scales the control plane Machines to the desired number of replicas, and replaces the
+// Machines not matching the desired version or machine template. Like the kubeadm control plane,
+// Machines are created once the cluster is initialized and scaled up one at a time, each after the
+// Nodes of the previous ones are registered. Machines marked unhealthy by a MachineHealthCheck
+// are deleted and replaced. Rollouts create up to maxSurge Machines above the
+// desired replicas, and delete an outdated Machine once the Nodes of the new ones are registered,
+// so each replacement waits for the simulated provisioning latency of its KwokMachine.
+func (s *Service) Reconcile(ctx context.Context) (ctrl.Result, error) {
+	controlPlane := s.scope.ControlPlane
+
+	machines, err := s.getMachines(ctx)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("getting control plane machines: %w", err)
+	}
+	outdated, err := s.outdatedMachines(ctx, machines)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("checking control plane machines: %w", err)
+	}
+	s.updateStatus(machines, outdated)
+
+	if controlPlane.Spec.Replicas == nil && len(machines) == 0 {
+		conditions.Delete(controlPlane, controlplanev1.MachinesReadyCondition)
+		conditions.Delete(controlPlane, controlplanev1.MachinesSpecUpToDateCondition)
+		return ctrl.Result{}, nil
+	}
+
+	if len(outdated) > 0 {
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesSpecUpToDateCondition, controlplanev1.RollingUpdateInProgressReason, clusterv1.ConditionSeverityWarning, "Rolling %d replicas with outdated spec (%d replicas up to date)", len(outdated), len(machines)-len(outdated))
+	} else {
+		conditions.MarkTrue(controlPlane, controlplanev1.MachinesSpecUpToDateCondition)
+	}
+
+	replicas := int(pointer.Int32Deref(controlPlane.Spec.Replicas, 0))
+	if replicas > 0 && controlPlane.Spec.MachineTemplate == nil {
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.MachineTemplateMissingReason, clusterv1.ConditionSeverityError, "spec.machineTemplate is required to create control plane Machines")
+		return ctrl.Result{}, nil
+	}
+
+	maxSurge, err := maxSurge(controlPlane.Spec.RolloutStrategy, replicas)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("resolving maxSurge: %w", err)
+	}
+
+	// Nodes can only be registered once the cluster runs.
+	if !controlPlane.Status.Initialized || controlPlane.Status.FailureReason != nil {
+		return ctrl.Result{}, nil
+	}
+
+	if deleting := filterMachines(machines, isDeleting); len(deleting) > 0 {
+		s.scope.Logger.Info("Waiting for control plane machines to be deleted", "machines", machineNames(deleting))
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.ScalingDownReason, clusterv1.ConditionSeverityInfo, "Waiting for %d Machines to be deleted", len(deleting))
+		return ctrl.Result{RequeueAfter: deletePollInterval}, nil
+	}
+
+	// Like the kubeadm control plane, the Machines a MachineHealthCheck marked unhealthy are
+	// deleted one at a time, the scale up then replaces them.
+	if unhealthy := filterMachines(machines, needsRemediation); len(unhealthy) > 0 {
+		machine := unhealthy[0]
+		s.scope.Logger.Info("Remediating unhealthy control plane machine", "machine", machine.Name)
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, clusterv1.RemediationInProgressReason, clusterv1.ConditionSeverityWarning, "Remediating unhealthy Machine %q", machine.Name)
+		return ctrl.Result{}, s.deleteMachine(ctx, machine)
+	}
+
+	withoutNode := filterMachines(machines, func(m *clusterv1.Machine) bool { return !hasNode(m) })
+	upToDate := len(machines) - len(outdated)
+	switch {
+	case len(outdated) > 0 && upToDate < replicas && len(machines) < replicas+maxSurge:
+		s.scope.Logger.Info("Rolling out control plane machines", "outdated", machineNames(outdated), "maxSurge", maxSurge)
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.ScalingUpReason, clusterv1.ConditionSeverityInfo, "Creating a Machine to replace %d outdated Machines", len(outdated))
+		return ctrl.Result{}, s.createMachine(ctx)
+	case len(outdated) == 0 && len(machines) > replicas:
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.ScalingDownReason, clusterv1.ConditionSeverityInfo, "Scaling down control plane to %d replicas (actual %d)", replicas, len(machines))
+		return ctrl.Result{}, s.deleteMachine(ctx, machines[0])
+	case len(machines) < replicas && len(withoutNode) == 0:
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.ScalingUpReason, clusterv1.ConditionSeverityInfo, "Scaling up control plane to %d replicas (actual %d)", replicas, len(machines))
+		return ctrl.Result{}, s.createMachine(ctx)
+	case len(withoutNode) > 0:
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.WaitingForNodesReason, clusterv1.ConditionSeverityInfo, "%d of %d Machines have no Node", len(withoutNode), len(machines))
+		return ctrl.Result{}, nil
+	case len(outdated) > 0:
+		conditions.MarkFalse(controlPlane, controlplanev1.MachinesReadyCondition, controlplanev1.ScalingDownReason, clusterv1.ConditionSeverityInfo, "Deleting outdated Machine %q", outdated[0].Name)
+		return ctrl.Result{}, s.deleteMachine(ctx, outdated[0])
+	}
+
+	conditions.MarkTrue(controlPlane, controlplanev1.MachinesReadyCondition)
+	return ctrl.Result{}, nil
+}
+
+// Delete deletes the control plane Machines, and waits for them to be gone so their Nodes are
+// removed before the cluster is.
+func (s *Service) Delete(ctx context.Context) (ctrl.Result, error) {
+	machines, err := s.getMachines(ctx)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("getting control plane machines: %w", err)
+	}
+	s.updateStatus(machines, nil)
+	if len(machines) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	var errs []error
+	for _, machine := range machines {
+		if isDeleting(machine) {
+			continue
+		}
+		if err := s.deleteMachine(ctx, machine); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return ctrl.Result{}, kerrors.NewAggregate(errs)
+	}
+
+	s.scope.Logger.Info("Waiting for control plane machines to be deleted", "machines", machineNames(machines))
+	conditions.MarkFalse(s.scope.ControlPlane, controlplanev1.MachinesReadyCondition, clusterv1.DeletingReason, clusterv1.ConditionSeverityInfo, "Waiting for %d Machines to be deleted", len(machines))
+	return ctrl.Result{RequeueAfter: deletePollInterval}, nil
+}
+
+// getMachines returns the Machines controlled by the control plane, oldest first.
+func (s *Service) getMachines(ctx context.Context) ([]*clusterv1.Machine, error) {
+	machineList := &clusterv1.MachineList{}
+	if err := s.scope.Client.List(ctx, machineList,
+		client.InNamespace(s.scope.ControlPlane.Namespace),
+		client.MatchingLabels(selectorLabels(s.scope.Cluster.Name)),
+	); err != nil {
+		return nil, err
+	}
+
+	machines := []*clusterv1.Machine{}
+	for i := range machineList.Items {
+		machine := &machineList.Items[i]
+		if metav1.IsControlledBy(machine, s.scope.ControlPlane) {
+			machines = append(machines, machine)
+		}
+	}
+	sort.SliceStable(machines, func(i, j int) bool {
+		return machines[i].CreationTimestamp.Before(&machines[j].CreationTimestamp)
+	})
+	return machines, nil
+}
+
+func (s *Service) updateStatus(machines, outdated []*clusterv1.Machine) {
+	status := &s.scope.ControlPlane.Status
+	status.Selector = metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: selectorLabels(s.scope.Cluster.Name)})
+	status.Replicas = int32(len(machines))
+	status.ReadyReplicas = int32(len(filterMachines(machines, hasNode)))
+	status.UnavailableReplicas = status.Replicas - status.ReadyReplicas
+	status.UpdatedReplicas = status.Replicas - int32(len(outdated))
+}
+
+// createMachine creates a control plane Machine, along with its KwokMachine cloned from the
+// machine template.
+func (s *Service) createMachine(ctx context.Context) error {
+	controlPlane := s.scope.ControlPlane
+	cluster := s.scope.Cluster
+	template := controlPlane.Spec.MachineTemplate
+
+	if err := s.reconcileBootstrapSecret(ctx); err != nil {
+		return fmt.Errorf("reconciling bootstrap secret: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s", controlPlane.Name, util.RandomString(5))
+	labels := machineLabels(controlPlane, cluster.Name)
+	infraRef, err := s.cloneInfrastructure(ctx, name, labels)
+	if err != nil {
+		return fmt.Errorf("cloning %s %q: %w", template.InfrastructureRef.Kind, template.InfrastructureRef.Name, err)
+	}
+
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       controlPlane.Namespace,
+			Labels:          labels,
+			Annotations:     template.ObjectMeta.Annotations,
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(controlPlane, controlplanev1.GroupVersion.WithKind(controlplanev1.KwokControlPlaneKind))},
+		},
+		Spec: clusterv1.MachineSpec{
+			ClusterName:       cluster.Name,
+			InfrastructureRef: *infraRef,
+			Bootstrap: clusterv1.Bootstrap{
+				DataSecretName: pointer.String(bootstrapSecretName(controlPlane.Name)),
+			},
+		},
+	}
+	if controlPlane.Spec.Version != "" {
+		machine.Spec.Version = pointer.String(controlPlane.Spec.Version)
+	}
+
+	if err := s.scope.Client.Create(ctx, machine); err != nil {
+		// Nothing else would delete the infrastructure of the Machine.
+		if deleteErr := s.deleteInfrastructure(ctx, infraRef); deleteErr != nil {
+			return kerrors.NewAggregate([]error{fmt.Errorf("creating machine: %w", err), fmt.Errorf("cleaning up infrastructure: %w", deleteErr)})
+		}
+		return fmt.Errorf("creating machine: %w", err)
+	}
+
+	s.scope.Logger.Info("Created control plane machine", "machine", machine.Name)
+	record.Eventf(controlPlane, "SuccessfulCreateMachine", "Created control plane Machine %q", machine.Name)
+	return nil
+}
+
+func (s *Service) deleteMachine(ctx context.Context, machine *clusterv1.Machine) error {
+	if err := s.scope.Client.Delete(ctx, machine); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("deleting machine %q: %w", machine.Name, err)
+	}
+
+	s.scope.Logger.Info("Deleted control plane machine", "machine", machine.Name)
+	record.Eventf(s.scope.ControlPlane, "SuccessfulDeleteMachine", "Deleted control plane Machine %q", machine.Name)
+	return nil
+}
+
+// reconcileBootstrapSecret creates the bootstrap data Secret shared by the control plane Machines.
+// The Nodes are registered by the KwokMachines so the data is empty, but Cluster API needs the
+// Secret to provision the Machines.
+func (s *Service) reconcileBootstrapSecret(ctx context.Context) error {
+	controlPlane := s.scope.ControlPlane
+	bootstrapSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      bootstrapSecretName(controlPlane.Name),
+			Namespace: controlPlane.Namespace,
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel: s.scope.Cluster.Name,
+			},
+			OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(controlPlane, controlplanev1.GroupVersion.WithKind(controlplanev1.KwokControlPlaneKind))},
+		},
+		Type: clusterv1.ClusterSecretType,
+		Data: map[string][]byte{
+			"value": {},
+		},
+	}
+
+	if err := s.scope.Client.Create(ctx, bootstrapSecret); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// bootstrapSecretName returns the name of the bootstrap data Secret of the control plane Machines.
+func bootstrapSecretName(controlPlaneName string) string {
+	return controlPlaneName + "-bootstrap"
+}
+
+// selectorLabels returns the labels selecting the control plane Machines of a cluster.
+func selectorLabels(clusterName string) map[string]string {
+	return map[string]string{
+		clusterv1.ClusterNameLabel:         clusterName,
+		clusterv1.MachineControlPlaneLabel: "",
+	}
+}
+
+// machineLabels returns the labels of the control plane Machines.
+func machineLabels(controlPlane *controlplanev1.KwokControlPlane, clusterName string) map[string]string {
+	labels := map[string]string{}
+	for k, v := range controlPlane.Spec.MachineTemplate.ObjectMeta.Labels {
+		labels[k] = v
+	}
+	for k, v := range selectorLabels(clusterName) {
+		labels[k] = v
+	}
+	labels[clusterv1.MachineControlPlaneNameLabel] = controlPlane.Name
+	return labels
+}
+
+func filterMachines(machines []*clusterv1.Machine, filter func(*clusterv1.Machine) bool) []*clusterv1.Machine {
+	filtered := []*clusterv1.Machine{}
+	for _, machine := range machines {
+		if filter(machine) {
+			filtered = append(filtered, machine)
+		}
+	}
+	return filtered
+}
+
+func machineNames(machines []*clusterv1.Machine) []string {
+	names := make([]string, 0, len(machines))
+	for _, machine := range machines {
+		names = append(names, machine.Name)
+	}
+	return names
+}
+
+// hasNode returns true if the Node of the Machine is registered.
+func hasNode(machine *clusterv1.Machine) bool {
+	return machine.Status.NodeRef != nil
+}
+
+func isDeleting(machine *clusterv1.Machine) bool {
+	return !machine.DeletionTimestamp.IsZero()
+}
+
+func needsRemediation(machine *clusterv1.Machine) bool {
+	return conditions.IsFalse(machine, clusterv1.MachineOwnerRemediatedCondition)
+}
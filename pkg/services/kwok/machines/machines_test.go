@@ -0,0 +1,353 @@
+package machines
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+)
+
+// newTestService returns a service reconciling the Machines of the "test" control plane, with the
+// given existing objects.
+func newTestService(g *WithT, controlPlane *controlplanev1.KwokControlPlane, objs ...client.Object) *Service {
+	s := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(s)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(s)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(s)).To(Succeed())
+	g.Expect(controlplanev1.AddToScheme(s)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"},
+	}
+	template := &infrav1.KwokMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-control-plane", Namespace: "default"},
+	}
+
+	logger := log.FromContext(context.Background())
+	return NewService(&scope.ControlPlaneScope{
+		Client:       fake.NewClientBuilder().WithScheme(s).WithObjects(append(objs, template)...).Build(),
+		Cluster:      cluster,
+		ControlPlane: controlPlane,
+		Logger:       &logger,
+	})
+}
+
+func newTestControlPlane(replicas *int32) *controlplanev1.KwokControlPlane {
+	return &controlplanev1.KwokControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "uid"},
+		Spec: controlplanev1.KwokControlPlaneSpec{
+			Version:  "v1.27.1",
+			Replicas: replicas,
+			MachineTemplate: &controlplanev1.KwokControlPlaneMachineTemplate{
+				ObjectMeta: clusterv1.ObjectMeta{Labels: map[string]string{"role": "control-plane"}},
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: infrav1.GroupVersion.String(),
+					Kind:       "KwokMachineTemplate",
+					Name:       "test-control-plane",
+				},
+			},
+		},
+		Status: controlplanev1.KwokControlPlaneStatus{
+			Initialized: true,
+		},
+	}
+}
+
+// newTestMachine returns a control plane Machine of the control plane, created age ago.
+func newTestMachine(controlPlane *controlplanev1.KwokControlPlane, name string, age time.Duration, withNode bool) *clusterv1.Machine {
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			Labels:            machineLabels(controlPlane, "test"),
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(controlPlane, controlplanev1.GroupVersion.WithKind(controlplanev1.KwokControlPlaneKind)),
+			},
+		},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: "test",
+			Version:     pointer.String("v1.27.1"),
+			InfrastructureRef: corev1.ObjectReference{
+				APIVersion: infrav1.GroupVersion.String(),
+				Kind:       "KwokMachine",
+				Name:       name,
+			},
+		},
+	}
+	if withNode {
+		machine.Status.NodeRef = &corev1.ObjectReference{Kind: "Node", Name: name}
+	}
+	return machine
+}
+
+type testMachine struct {
+	withNode  bool
+	outdated  bool
+	unhealthy bool
+}
+
+func intstrPtr(v intstr.IntOrString) *intstr.IntOrString {
+	return &v
+}
+
+func TestReconcile(t *testing.T) {
+	testCases := []struct {
+		name           string
+		replicas       *int32
+		maxSurge       *intstr.IntOrString
+		noTemplate     bool
+		notInitialized bool
+		// machines are the existing Machines, oldest first.
+		machines       []testMachine
+		expectDeleted  string
+		expectMachines int
+		expectReady    int32
+		expectUpdated  int32
+		expectReason   string
+	}{
+		{
+			name:           "scales up one machine at a time",
+			replicas:       pointer.Int32(3),
+			machines:       []testMachine{{withNode: true}},
+			expectMachines: 2,
+			expectReady:    1,
+			expectUpdated:  1,
+			expectReason:   controlplanev1.ScalingUpReason,
+		},
+		{
+			name:           "waits for nodes before scaling up",
+			replicas:       pointer.Int32(3),
+			machines:       []testMachine{{}},
+			expectUpdated:  1,
+			expectMachines: 1,
+			expectReason:   controlplanev1.WaitingForNodesReason,
+		},
+		{
+			name:           "scales down",
+			replicas:       pointer.Int32(1),
+			machines:       []testMachine{{withNode: true}, {withNode: true}},
+			expectDeleted:  "test-0",
+			expectMachines: 1,
+			expectReady:    2,
+			expectUpdated:  2,
+			expectReason:   controlplanev1.ScalingDownReason,
+		},
+		{
+			name:           "machines are ready",
+			replicas:       pointer.Int32(1),
+			machines:       []testMachine{{withNode: true}},
+			expectMachines: 1,
+			expectReady:    1,
+			expectUpdated:  1,
+		},
+		{
+			name:           "creates a machine above the replicas to roll out outdated machines",
+			replicas:       pointer.Int32(2),
+			machines:       []testMachine{{withNode: true, outdated: true}, {withNode: true, outdated: true}},
+			expectMachines: 3,
+			expectReady:    2,
+			expectReason:   controlplanev1.ScalingUpReason,
+		},
+		{
+			name:           "creates machines up to maxSurge",
+			replicas:       pointer.Int32(2),
+			maxSurge:       intstrPtr(intstr.FromString("100%")),
+			machines:       []testMachine{{withNode: true, outdated: true}, {withNode: true, outdated: true}, {}},
+			expectMachines: 4,
+			expectReady:    2,
+			expectUpdated:  1,
+			expectReason:   controlplanev1.ScalingUpReason,
+		},
+		{
+			name:           "waits for the nodes of new machines before deleting outdated machines",
+			replicas:       pointer.Int32(2),
+			machines:       []testMachine{{withNode: true, outdated: true}, {withNode: true, outdated: true}, {}},
+			expectMachines: 3,
+			expectReady:    2,
+			expectUpdated:  1,
+			expectReason:   controlplanev1.WaitingForNodesReason,
+		},
+		{
+			name:           "deletes the oldest outdated machine",
+			replicas:       pointer.Int32(2),
+			machines:       []testMachine{{withNode: true}, {withNode: true, outdated: true}, {withNode: true, outdated: true}},
+			expectDeleted:  "test-1",
+			expectMachines: 2,
+			expectReady:    3,
+			expectUpdated:  1,
+			expectReason:   controlplanev1.ScalingDownReason,
+		},
+		{
+			name:           "deletes outdated machines before creating new ones without surge",
+			replicas:       pointer.Int32(2),
+			maxSurge:       intstrPtr(intstr.FromInt(0)),
+			machines:       []testMachine{{withNode: true, outdated: true}, {withNode: true, outdated: true}},
+			expectDeleted:  "test-0",
+			expectMachines: 1,
+			expectReady:    2,
+			expectReason:   controlplanev1.ScalingDownReason,
+		},
+		{
+			name:           "remediates an unhealthy machine",
+			replicas:       pointer.Int32(3),
+			machines:       []testMachine{{withNode: true}, {withNode: true, unhealthy: true}, {withNode: true}},
+			expectDeleted:  "test-1",
+			expectMachines: 2,
+			expectReady:    3,
+			expectUpdated:  3,
+			expectReason:   clusterv1.RemediationInProgressReason,
+		},
+		{
+			name:           "remediates one machine at a time",
+			replicas:       pointer.Int32(2),
+			machines:       []testMachine{{withNode: true, unhealthy: true}, {unhealthy: true}},
+			expectDeleted:  "test-0",
+			expectMachines: 1,
+			expectReady:    1,
+			expectUpdated:  2,
+			expectReason:   clusterv1.RemediationInProgressReason,
+		},
+		{
+			name:         "requires a machine template",
+			replicas:     pointer.Int32(1),
+			noTemplate:   true,
+			expectReason: controlplanev1.MachineTemplateMissingReason,
+		},
+		{
+			name:           "waits for the cluster to be initialized",
+			replicas:       pointer.Int32(1),
+			notInitialized: true,
+		},
+		{
+			name: "without replicas",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controlPlane := newTestControlPlane(tc.replicas)
+			objs := []client.Object{}
+			if tc.maxSurge != nil {
+				controlPlane.Spec.RolloutStrategy = &controlplanev1.RolloutStrategy{
+					Type:          controlplanev1.RollingUpdateStrategyType,
+					RollingUpdate: &controlplanev1.RollingUpdate{MaxSurge: tc.maxSurge},
+				}
+			}
+			for i, m := range tc.machines {
+				age := time.Duration(len(tc.machines)-i) * time.Hour
+				machine := newTestMachine(controlPlane, fmt.Sprintf("test-%d", i), age, m.withNode)
+				if m.outdated {
+					machine.Spec.Version = pointer.String("v1.26.0")
+				}
+				if m.unhealthy {
+					conditions.MarkFalse(machine, clusterv1.MachineOwnerRemediatedCondition, clusterv1.WaitingForRemediationReason, clusterv1.ConditionSeverityWarning, "")
+				}
+				objs = append(objs, machine)
+			}
+			if tc.noTemplate {
+				controlPlane.Spec.MachineTemplate = nil
+			}
+			if tc.notInitialized {
+				controlPlane.Status.Initialized = false
+			}
+			svc := newTestService(g, controlPlane, objs...)
+
+			_, err := svc.Reconcile(context.Background())
+			g.Expect(err).NotTo(HaveOccurred())
+
+			machines, err := svc.getMachines(context.Background())
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(machines).To(HaveLen(tc.expectMachines))
+			if tc.expectDeleted != "" {
+				g.Expect(machineNames(machines)).NotTo(ContainElement(tc.expectDeleted))
+			}
+			g.Expect(controlPlane.Status.Replicas).To(BeEquivalentTo(len(tc.machines)))
+			g.Expect(controlPlane.Status.ReadyReplicas).To(Equal(tc.expectReady))
+			g.Expect(controlPlane.Status.UpdatedReplicas).To(Equal(tc.expectUpdated))
+			g.Expect(controlPlane.Status.Selector).To(Equal("cluster.x-k8s.io/cluster-name=test,cluster.x-k8s.io/control-plane="))
+
+			switch {
+			case tc.expectReason != "":
+				g.Expect(conditions.GetReason(controlPlane, controlplanev1.MachinesReadyCondition)).To(Equal(tc.expectReason))
+			case tc.expectMachines > 0:
+				g.Expect(conditions.IsTrue(controlPlane, controlplanev1.MachinesReadyCondition)).To(BeTrue())
+			default:
+				g.Expect(conditions.Has(controlPlane, controlplanev1.MachinesReadyCondition)).To(BeFalse())
+			}
+		})
+	}
+}
+
+func TestReconcileCreatesMachine(t *testing.T) {
+	g := NewWithT(t)
+
+	controlPlane := newTestControlPlane(pointer.Int32(1))
+	svc := newTestService(g, controlPlane)
+
+	_, err := svc.Reconcile(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+
+	machines, err := svc.getMachines(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(machines).To(HaveLen(1))
+	machine := machines[0]
+	g.Expect(machine.Labels).To(HaveKeyWithValue("role", "control-plane"))
+	g.Expect(machine.Labels).To(HaveKeyWithValue(clusterv1.MachineControlPlaneNameLabel, "test"))
+	g.Expect(machine.Spec.Version).To(Equal(pointer.String("v1.27.1")))
+	g.Expect(machine.Spec.Bootstrap.DataSecretName).To(Equal(pointer.String("test-bootstrap")))
+	g.Expect(machine.Spec.InfrastructureRef.Kind).To(Equal("KwokMachine"))
+	g.Expect(machine.Spec.InfrastructureRef.Name).To(Equal(machine.Name))
+
+	kwokMachine := &infrav1.KwokMachine{}
+	g.Expect(svc.scope.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: machine.Name}, kwokMachine)).To(Succeed())
+	g.Expect(kwokMachine.Annotations).To(HaveKeyWithValue(clusterv1.TemplateClonedFromNameAnnotation, "test-control-plane"))
+	g.Expect(kwokMachine.Labels).To(HaveKeyWithValue(clusterv1.ClusterNameLabel, "test"))
+
+	bootstrapSecret := &corev1.Secret{}
+	g.Expect(svc.scope.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "test-bootstrap"}, bootstrapSecret)).To(Succeed())
+	g.Expect(bootstrapSecret.Type).To(Equal(clusterv1.ClusterSecretType))
+}
+
+func TestDelete(t *testing.T) {
+	g := NewWithT(t)
+
+	controlPlane := newTestControlPlane(pointer.Int32(2))
+	svc := newTestService(g, controlPlane,
+		newTestMachine(controlPlane, "test-a", time.Hour, true),
+		newTestMachine(controlPlane, "test-b", time.Minute, true),
+	)
+
+	res, err := svc.Delete(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.RequeueAfter).To(Equal(deletePollInterval))
+	g.Expect(conditions.GetReason(controlPlane, controlplanev1.MachinesReadyCondition)).To(Equal(clusterv1.DeletingReason))
+
+	machines, err := svc.getMachines(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(machines).To(BeEmpty())
+
+	res, err = svc.Delete(context.Background())
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+}
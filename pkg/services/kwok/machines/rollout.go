@@ -0,0 +1,91 @@
+package machines
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+)
+
+// defaultMaxSurge is the maxSurge of the rollouts when the rollout strategy doesn't set it.
+var defaultMaxSurge = intstr.FromInt(1)
+
+// maxSurge returns the number of Machines that can be created above the desired replicas during
+// a rollout.
+func maxSurge(strategy *controlplanev1.RolloutStrategy, replicas int) (int, error) {
+	surge := &defaultMaxSurge
+	if strategy != nil && strategy.RollingUpdate != nil && strategy.RollingUpdate.MaxSurge != nil {
+		surge = strategy.RollingUpdate.MaxSurge
+	}
+
+	value, err := intstr.GetScaledValueFromIntOrPercent(surge, replicas, true)
+	if err != nil {
+		return 0, err
+	}
+	if value < 0 {
+		return 0, fmt.Errorf("maxSurge %s is negative", surge.String())
+	}
+	return value, nil
+}
+
+// outdatedMachines returns the Machines, oldest first, that don't run the desired version or
+// whose infrastructure wasn't cloned from the current infrastructure template.
+func (s *Service) outdatedMachines(ctx context.Context, machines []*clusterv1.Machine) ([]*clusterv1.Machine, error) {
+	outdated := []*clusterv1.Machine{}
+	for _, machine := range machines {
+		upToDate, err := s.isUpToDate(ctx, machine)
+		if err != nil {
+			return nil, err
+		}
+		if !upToDate {
+			outdated = append(outdated, machine)
+		}
+	}
+	return outdated, nil
+}
+
+func (s *Service) isUpToDate(ctx context.Context, machine *clusterv1.Machine) (bool, error) {
+	controlPlane := s.scope.ControlPlane
+
+	version := controlPlane.Spec.Version
+	if version != "" && pointer.StringDeref(machine.Spec.Version, "") != version {
+		return false, nil
+	}
+
+	if controlPlane.Spec.MachineTemplate == nil {
+		return true, nil
+	}
+
+	infraRef := machine.Spec.InfrastructureRef
+	infra := &unstructured.Unstructured{}
+	infra.SetAPIVersion(infraRef.APIVersion)
+	infra.SetKind(infraRef.Kind)
+	if err := s.scope.Client.Get(ctx, client.ObjectKey{Namespace: machine.Namespace, Name: infraRef.Name}, infra); err != nil {
+		// The infrastructure may be gone with the Machine, nothing tells it is outdated.
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("getting infrastructure of machine %q: %w", machine.Name, err)
+	}
+
+	// Infrastructure not cloned by the control plane can't be compared to the template.
+	annotations := infra.GetAnnotations()
+	clonedFromName, ok := annotations[clusterv1.TemplateClonedFromNameAnnotation]
+	if !ok {
+		return true, nil
+	}
+	clonedFromGroupKind, ok := annotations[clusterv1.TemplateClonedFromGroupKindAnnotation]
+	if !ok {
+		return true, nil
+	}
+
+	templateRef := controlPlane.Spec.MachineTemplate.InfrastructureRef
+	return clonedFromName == templateRef.Name && clonedFromGroupKind == templateRef.GroupVersionKind().GroupKind().String(), nil
+}
@@ -0,0 +1,143 @@
+package machines
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1 "github.com/capi-samples/cluster-api-provider-kwok/api/controlplane/v1beta1"
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+func TestMaxSurge(t *testing.T) {
+	testCases := []struct {
+		name      string
+		strategy  *controlplanev1.RolloutStrategy
+		replicas  int
+		expected  int
+		expectErr bool
+	}{
+		{
+			name:     "defaults to one",
+			replicas: 3,
+			expected: 1,
+		},
+		{
+			name:     "number",
+			strategy: &controlplanev1.RolloutStrategy{RollingUpdate: &controlplanev1.RollingUpdate{MaxSurge: intstrPtr(intstr.FromInt(2))}},
+			replicas: 3,
+			expected: 2,
+		},
+		{
+			name:     "percentage rounded up",
+			strategy: &controlplanev1.RolloutStrategy{RollingUpdate: &controlplanev1.RollingUpdate{MaxSurge: intstrPtr(intstr.FromString("50%"))}},
+			replicas: 3,
+			expected: 2,
+		},
+		{
+			name:      "negative",
+			strategy:  &controlplanev1.RolloutStrategy{RollingUpdate: &controlplanev1.RollingUpdate{MaxSurge: intstrPtr(intstr.FromInt(-1))}},
+			replicas:  3,
+			expectErr: true,
+		},
+		{
+			name:      "invalid percentage",
+			strategy:  &controlplanev1.RolloutStrategy{RollingUpdate: &controlplanev1.RollingUpdate{MaxSurge: intstrPtr(intstr.FromString("half"))}},
+			replicas:  3,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			surge, err := maxSurge(tc.strategy, tc.replicas)
+			if tc.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(surge).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestOutdatedMachines(t *testing.T) {
+	testCases := []struct {
+		name           string
+		version        string
+		noInfra        bool
+		annotations    map[string]string
+		expectOutdated bool
+	}{
+		{
+			name:    "up to date",
+			version: "v1.27.1",
+			annotations: map[string]string{
+				clusterv1.TemplateClonedFromNameAnnotation:      "test-control-plane",
+				clusterv1.TemplateClonedFromGroupKindAnnotation: "KwokMachineTemplate.infrastructure.cluster.x-k8s.io",
+			},
+		},
+		{
+			name:    "other version",
+			version: "v1.26.0",
+			annotations: map[string]string{
+				clusterv1.TemplateClonedFromNameAnnotation:      "test-control-plane",
+				clusterv1.TemplateClonedFromGroupKindAnnotation: "KwokMachineTemplate.infrastructure.cluster.x-k8s.io",
+			},
+			expectOutdated: true,
+		},
+		{
+			name:    "cloned from another template",
+			version: "v1.27.1",
+			annotations: map[string]string{
+				clusterv1.TemplateClonedFromNameAnnotation:      "test-control-plane-old",
+				clusterv1.TemplateClonedFromGroupKindAnnotation: "KwokMachineTemplate.infrastructure.cluster.x-k8s.io",
+			},
+			expectOutdated: true,
+		},
+		{
+			name:    "not cloned from a template",
+			version: "v1.27.1",
+		},
+		{
+			name:    "without infrastructure",
+			version: "v1.27.1",
+			noInfra: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			controlPlane := newTestControlPlane(pointer.Int32(1))
+			machine := newTestMachine(controlPlane, "test-0", time.Hour, true)
+			machine.Spec.Version = pointer.String(tc.version)
+			objs := []client.Object{machine}
+			if !tc.noInfra {
+				objs = append(objs, &infrav1.KwokMachine{
+					ObjectMeta: metav1.ObjectMeta{Name: "test-0", Namespace: "default", Annotations: tc.annotations},
+				})
+			}
+			svc := newTestService(g, controlPlane, objs...)
+
+			outdated, err := svc.outdatedMachines(context.Background(), []*clusterv1.Machine{machine})
+			g.Expect(err).NotTo(HaveOccurred())
+			if tc.expectOutdated {
+				g.Expect(outdated).To(ConsistOf(machine))
+			} else {
+				g.Expect(outdated).To(BeEmpty())
+			}
+		})
+	}
+}
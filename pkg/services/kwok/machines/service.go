@@ -0,0 +1,16 @@
+package machines
+
+import (
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/scope"
+)
+
+// Service reconciles the control plane Machines of a KwokControlPlane.
+type Service struct {
+	scope *scope.ControlPlaneScope
+}
+
+func NewService(scope *scope.ControlPlaneScope) *Service {
+	return &Service{
+		scope: scope,
+	}
+}
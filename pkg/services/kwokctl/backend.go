@@ -0,0 +1,113 @@
+package kwokctl
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/kwokctl/runtime"
+
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+// Backend runs clusters with the kwokctl runtimes, the same way `kwokctl create cluster` does.
+type Backend struct {
+	registry *runtime.Registry
+}
+
+var _ services.Backend = &Backend{}
+
+// New returns a backend using the runtimes registered with kwokctl.
+func New() *Backend {
+	return &Backend{
+		registry: runtime.DefaultRegistry,
+	}
+}
+
+func (b *Backend) Supports(runtimeName string) bool {
+	_, ok := b.registry.Get(runtimeName)
+	return ok
+}
+
+func (b *Backend) Cluster(runtimeName, name, workDir string) (services.BackendCluster, error) {
+	buildRuntime, ok := b.registry.Get(runtimeName)
+	if !ok {
+		return nil, fmt.Errorf("runtime %q not found", runtimeName)
+	}
+
+	rt, err := buildRuntime(name, workDir)
+	if err != nil {
+		return nil, err
+	}
+	return &cluster{rt: rt}, nil
+}
+
+func (b *Backend) Load(ctx context.Context, name, workDir string) (services.BackendCluster, error) {
+	rt, err := b.registry.Load(ctx, name, workDir)
+	if err != nil {
+		return nil, err
+	}
+	return &cluster{rt: rt}, nil
+}
+
+func (b *Backend) List(dir string) ([]string, error) {
+	return runtime.ListClusters(dir)
+}
+
+// cluster adapts a kwokctl runtime to a BackendCluster.
+type cluster struct {
+	rt runtime.Runtime
+}
+
+func (c *cluster) Available(ctx context.Context) error {
+	return c.rt.Available(ctx)
+}
+
+func (c *cluster) Config(ctx context.Context) (*internalversion.KwokctlConfiguration, error) {
+	return c.rt.Config(ctx)
+}
+
+func (c *cluster) Create(ctx context.Context, conf *internalversion.KwokctlConfiguration) error {
+	if err := c.rt.SetConfig(ctx, conf); err != nil {
+		return fmt.Errorf("failed to set config: %w", err)
+	}
+	if err := c.rt.Save(ctx); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	if err := c.rt.Install(ctx); err != nil {
+		return fmt.Errorf("failed to setup config: %w", err)
+	}
+	return nil
+}
+
+func (c *cluster) Delete(ctx context.Context) error {
+	return c.rt.Uninstall(ctx)
+}
+
+func (c *cluster) Up(ctx context.Context) error {
+	return c.rt.Up(ctx)
+}
+
+func (c *cluster) Down(ctx context.Context) error {
+	return c.rt.Down(ctx)
+}
+
+func (c *cluster) Stop(ctx context.Context) error {
+	return c.rt.Stop(ctx)
+}
+
+func (c *cluster) StartComponent(ctx context.Context, name string) error {
+	return c.rt.StartComponent(ctx, name)
+}
+
+func (c *cluster) StopComponent(ctx context.Context, name string) error {
+	return c.rt.StopComponent(ctx, name)
+}
+
+func (c *cluster) SnapshotSave(ctx context.Context, path string) error {
+	return c.rt.SnapshotSave(ctx, path)
+}
+
+func (c *cluster) SnapshotRestore(ctx context.Context, path string) error {
+	return c.rt.SnapshotRestore(ctx, path)
+}
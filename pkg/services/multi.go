@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// MultiBackend runs the clusters of each runtime with the first of its backends supporting it.
+type MultiBackend []Backend
+
+var _ Backend = MultiBackend{}
+
+func (b MultiBackend) Supports(runtime string) bool {
+	for _, backend := range b {
+		if backend.Supports(runtime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b MultiBackend) Cluster(runtime, name, workDir string) (BackendCluster, error) {
+	for _, backend := range b {
+		if backend.Supports(runtime) {
+			return backend.Cluster(runtime, name, workDir)
+		}
+	}
+	return nil, fmt.Errorf("runtime %q not found", runtime)
+}
+
+// Load returns the cluster from the first backend that finds it.
+func (b MultiBackend) Load(ctx context.Context, name, workDir string) (BackendCluster, error) {
+	err := fmt.Errorf("cluster %q not found in %q: %w", name, workDir, os.ErrNotExist)
+	for _, backend := range b {
+		var rt BackendCluster
+		if rt, err = backend.Load(ctx, name, workDir); err == nil || !errors.Is(err, os.ErrNotExist) {
+			return rt, err
+		}
+	}
+	return nil, err
+}
+
+// List returns the names of the clusters listed by any of the backends.
+func (b MultiBackend) List(dir string) ([]string, error) {
+	seen := map[string]bool{}
+	var names []string
+	for _, backend := range b {
+		list, err := backend.List(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
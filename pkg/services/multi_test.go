@@ -0,0 +1,45 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+	fakebackend "github.com/capi-samples/cluster-api-provider-kwok/pkg/services/fake"
+)
+
+func TestMultiBackend(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	root := t.TempDir()
+	docker := fakebackend.NewBackend("docker")
+	binary := fakebackend.NewBackend("binary", "docker")
+	g.Expect(binary.AddCluster("b", filepath.Join(root, "b"), &internalversion.KwokctlConfiguration{}, false)).To(Succeed())
+	backend := services.MultiBackend{docker, binary}
+
+	g.Expect(backend.Supports("binary")).To(BeTrue())
+	g.Expect(backend.Supports("kind")).To(BeFalse())
+	_, err := backend.Cluster("kind", "a", filepath.Join(root, "a"))
+	g.Expect(err).To(HaveOccurred())
+
+	// Clusters are run by the first backend supporting their runtime.
+	rt, err := backend.Cluster("docker", "a", filepath.Join(root, "a"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rt.Create(ctx, &internalversion.KwokctlConfiguration{})).To(Succeed())
+	g.Expect(docker.HasCluster(filepath.Join(root, "a"))).To(BeTrue())
+	g.Expect(binary.HasCluster(filepath.Join(root, "a"))).To(BeFalse())
+
+	_, err = backend.Load(ctx, "b", filepath.Join(root, "b"))
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = backend.Load(ctx, "c", filepath.Join(root, "c"))
+	g.Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+
+	g.Expect(backend.List(root)).To(Equal([]string{"a", "b"}))
+}
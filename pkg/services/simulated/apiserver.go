@@ -0,0 +1,787 @@
+package simulated
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/apimachinery/pkg/watch"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// codecs decode the protobuf bodies sent by clients for the built-in resources. Responses are
+// always JSON, which clients accept along with protobuf.
+var codecs = serializer.NewCodecFactory(clientgoscheme.Scheme)
+
+// apiServer serves the Kubernetes API of a simulated cluster from its store. It implements what
+// clients of a cluster commonly use: discovery, health checks, and reading, writing and watching
+// objects. Nothing is validated or defaulted, and no controllers act on the objects.
+type apiServer struct {
+	store   *store
+	version string
+
+	// done is closed when the server stops, ending the watches.
+	done <-chan struct{}
+}
+
+// request is a request for objects of a resource.
+type request struct {
+	resource    resource
+	namespace   string
+	name        string
+	subresource string
+}
+
+func (r *request) key(name string) objectKey {
+	namespace := r.namespace
+	if !r.resource.namespaced {
+		namespace = ""
+	}
+	return objectKey{group: r.resource.group, resource: r.resource.name, namespace: namespace, name: name}
+}
+
+func (r *request) groupResource() schema.GroupResource {
+	return schema.GroupResource{Group: r.resource.group, Resource: r.resource.name}
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch path {
+	case "":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"paths": []string{"/api", "/apis", "/healthz", "/livez", "/readyz", "/version"}})
+		return
+	case "healthz", "livez", "readyz", "healthz/etcd", "livez/etcd", "readyz/etcd":
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte("ok"))
+		return
+	case "version":
+		writeJSON(w, http.StatusOK, version.Info{GitVersion: s.version, Platform: "simulated"})
+		return
+	case "api":
+		writeJSON(w, http.StatusOK, &metav1.APIVersions{
+			TypeMeta: metav1.TypeMeta{Kind: "APIVersions"},
+			Versions: []string{"v1"},
+			ServerAddressByClientCIDRs: []metav1.ServerAddressByClientCIDR{
+				{ClientCIDR: "0.0.0.0/0", ServerAddress: r.Host},
+			},
+		})
+		return
+	case "apis":
+		writeJSON(w, http.StatusOK, s.apiGroups())
+		return
+	}
+
+	segments := strings.Split(path, "/")
+	var group, version string
+	switch {
+	case segments[0] == "api" && len(segments) >= 2:
+		version, segments = segments[1], segments[2:]
+	case segments[0] == "apis" && len(segments) == 2:
+		for _, group := range s.apiGroups().Groups {
+			if group.Name == segments[1] {
+				group := group
+				group.TypeMeta = metav1.TypeMeta{Kind: "APIGroup", APIVersion: "v1"}
+				writeJSON(w, http.StatusOK, &group)
+				return
+			}
+		}
+		writeError(w, errNotFound)
+		return
+	case segments[0] == "apis" && len(segments) >= 3:
+		group, version, segments = segments[1], segments[2], segments[3:]
+	default:
+		writeError(w, errNotFound)
+		return
+	}
+
+	if len(segments) == 0 {
+		list, ok := s.apiResources(group, version)
+		if !ok {
+			writeError(w, errNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+		return
+	}
+
+	req, ok := s.parse(group, version, segments)
+	if !ok {
+		writeError(w, errNotFound)
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		err = s.get(w, r, req)
+	case http.MethodPost:
+		err = s.create(w, r, req)
+	case http.MethodPut:
+		err = s.update(w, r, req)
+	case http.MethodPatch:
+		err = s.patch(w, r, req)
+	case http.MethodDelete:
+		err = s.delete(w, r, req)
+	default:
+		err = apierrors.NewMethodNotSupported(req.groupResource(), r.Method)
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+var errNotFound = &apierrors.StatusError{ErrStatus: metav1.Status{
+	Status:  metav1.StatusFailure,
+	Code:    http.StatusNotFound,
+	Reason:  metav1.StatusReasonNotFound,
+	Message: "the server could not find the requested resource",
+}}
+
+// resources returns the built-in resources along with the ones of the CustomResourceDefinitions.
+func (s *apiServer) resources() []resource {
+	crds, _ := s.store.list("apiextensions.k8s.io", "customresourcedefinitions", "")
+
+	resources := append([]resource{}, builtinResources...)
+	for _, crd := range crds {
+		resources = append(resources, customResources(crd)...)
+	}
+	return resources
+}
+
+func (s *apiServer) apiGroups() *metav1.APIGroupList {
+	list := &metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	index := map[string]int{}
+	for _, r := range s.resources() {
+		if r.group == "" {
+			continue
+		}
+		gv := metav1.GroupVersionForDiscovery{GroupVersion: r.groupVersion(), Version: r.version}
+		i, ok := index[r.group]
+		if !ok {
+			i = len(list.Groups)
+			index[r.group] = i
+			list.Groups = append(list.Groups, metav1.APIGroup{Name: r.group, PreferredVersion: gv})
+		}
+
+		group := &list.Groups[i]
+		known := false
+		for _, v := range group.Versions {
+			known = known || v == gv
+		}
+		if !known {
+			group.Versions = append(group.Versions, gv)
+		}
+	}
+	return list
+}
+
+func (s *apiServer) apiResources(group, version string) (*metav1.APIResourceList, bool) {
+	gv := schema.GroupVersion{Group: group, Version: version}
+	list := &metav1.APIResourceList{
+		TypeMeta:     metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"},
+		GroupVersion: gv.String(),
+	}
+	verbs := metav1.Verbs{"create", "delete", "deletecollection", "get", "list", "patch", "update", "watch"}
+	for _, r := range s.resources() {
+		if r.group != group || r.version != version {
+			continue
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:         r.name,
+			SingularName: r.singular,
+			Namespaced:   r.namespaced,
+			Kind:         r.kind,
+			Verbs:        verbs,
+		})
+		if r.status {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       r.name + "/status",
+				Namespaced: r.namespaced,
+				Kind:       r.kind,
+				Verbs:      metav1.Verbs{"get", "patch", "update"},
+			})
+		}
+	}
+	return list, len(list.APIResources) > 0
+}
+
+// parse parses the segments of the path of a request following its group and version, i.e.
+// [namespaces/{namespace}/]{resource}[/{name}[/{subresource}]].
+func (s *apiServer) parse(group, version string, segments []string) (*request, bool) {
+	lookup := func(name string, namespaced bool) (resource, bool) {
+		for _, r := range s.resources() {
+			if r.group == group && r.version == version && r.name == name && r.namespaced == namespaced {
+				return r, true
+			}
+		}
+		return resource{}, false
+	}
+
+	req := &request{}
+	if len(segments) >= 3 && segments[0] == "namespaces" {
+		if r, ok := lookup(segments[2], true); ok {
+			req.resource = r
+			req.namespace = segments[1]
+			segments = segments[2:]
+		}
+	}
+	if req.resource.name == "" {
+		r, ok := lookup(segments[0], false)
+		if !ok {
+			// Namespaced resources are listed across namespaces without one.
+			if r, ok = lookup(segments[0], true); !ok || len(segments) > 1 {
+				return nil, false
+			}
+		}
+		req.resource = r
+	}
+
+	switch len(segments) {
+	case 3:
+		req.subresource = segments[2]
+		if req.subresource != "status" || !req.resource.status {
+			return nil, false
+		}
+		fallthrough
+	case 2:
+		req.name = segments[1]
+	case 1:
+	default:
+		return nil, false
+	}
+	return req, true
+}
+
+func (s *apiServer) get(w http.ResponseWriter, r *http.Request, req *request) error {
+	if req.name != "" {
+		obj, ok := s.store.get(req.key(req.name))
+		if !ok {
+			return apierrors.NewNotFound(req.groupResource(), req.name)
+		}
+		writeJSON(w, http.StatusOK, s.versioned(req, obj))
+		return nil
+	}
+
+	matches, err := selector(r)
+	if err != nil {
+		return err
+	}
+	if watch := r.URL.Query().Get("watch"); watch == "true" || watch == "1" {
+		return s.watch(w, r, req, matches)
+	}
+
+	objs, resourceVersion := s.store.list(req.resource.group, req.resource.name, req.namespace)
+	items := make([]interface{}, 0, len(objs))
+	for _, obj := range objs {
+		if matches(obj) {
+			items = append(items, s.versioned(req, obj))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"apiVersion": req.resource.groupVersion(),
+		"kind":       req.resource.kind + "List",
+		"metadata":   map[string]interface{}{"resourceVersion": strconv.FormatUint(resourceVersion, 10)},
+		"items":      items,
+	})
+	return nil
+}
+
+// watch streams the changes of the objects of a resource, starting with the current objects
+// unless a resource version to start from is given.
+func (s *apiServer) watch(w http.ResponseWriter, r *http.Request, req *request, matches func(map[string]interface{}) bool) error {
+	query := r.URL.Query()
+
+	var resourceVersion uint64
+	if rv := query.Get("resourceVersion"); rv != "" {
+		var err error
+		if resourceVersion, err = strconv.ParseUint(rv, 10, 64); err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid resource version %q", rv))
+		}
+	}
+
+	ctx := r.Context()
+	if timeout := query.Get("timeoutSeconds"); timeout != "" {
+		seconds, err := strconv.Atoi(timeout)
+		if err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid timeout %q", timeout))
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(seconds)*time.Second)
+		defer cancel()
+	}
+
+	w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	encoder := json.NewEncoder(w)
+	send := func(typ watch.EventType, obj interface{}) bool {
+		if err := encoder.Encode(map[string]interface{}{"type": typ, "object": obj}); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+
+	if resourceVersion == 0 {
+		objs, current := s.store.list(req.resource.group, req.resource.name, req.namespace)
+		for _, obj := range objs {
+			if matches(obj) && !send(watch.Added, s.versioned(req, obj)) {
+				return nil
+			}
+		}
+		resourceVersion = current
+	}
+
+	for {
+		events, changed, ok := s.store.eventsSince(resourceVersion)
+		if !ok {
+			status := apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d", resourceVersion)).Status()
+			status.Kind, status.APIVersion = "Status", "v1"
+			send(watch.Error, &status)
+			return nil
+		}
+
+		for _, e := range events {
+			resourceVersion = e.resourceVersion
+			if e.key.group != req.resource.group || e.key.resource != req.resource.name {
+				continue
+			}
+			if req.namespace != "" && e.key.namespace != req.namespace {
+				continue
+			}
+			if matches(e.object) && !send(e.typ, s.versioned(req, runtime.DeepCopyJSON(e.object))) {
+				return nil
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil
+		case <-s.done:
+			return nil
+		}
+	}
+}
+
+func (s *apiServer) create(w http.ResponseWriter, r *http.Request, req *request) error {
+	if req.name != "" {
+		return apierrors.NewMethodNotSupported(req.groupResource(), "create")
+	}
+	if req.resource.namespaced && req.namespace == "" {
+		return apierrors.NewBadRequest("the namespace of the object is required")
+	}
+
+	obj, err := decodeObject(r)
+	if err != nil {
+		return err
+	}
+	metadata := metadataOf(obj)
+	if req.resource.namespaced {
+		metadata["namespace"] = req.namespace
+	} else {
+		delete(metadata, "namespace")
+	}
+
+	name := nameOf(obj)
+	if name == "" {
+		generateName, _ := metadata["generateName"].(string)
+		if generateName == "" {
+			return apierrors.NewBadRequest("name or generateName is required")
+		}
+		name = generateName + utilrand.String(5)
+		metadata["name"] = name
+	}
+
+	if req.resource.namespaced {
+		if _, ok := s.store.get(objectKey{resource: "namespaces", name: req.namespace}); !ok {
+			return apierrors.NewNotFound(schema.GroupResource{Resource: "namespaces"}, req.namespace)
+		}
+	}
+
+	created, err := s.store.update(req.key(name), func(current map[string]interface{}) (map[string]interface{}, error) {
+		if current != nil {
+			return nil, apierrors.NewAlreadyExists(req.groupResource(), name)
+		}
+		initialize(obj)
+		return s.stored(req, obj), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusCreated, s.versioned(req, created))
+	return nil
+}
+
+func (s *apiServer) update(w http.ResponseWriter, r *http.Request, req *request) error {
+	if req.name == "" {
+		return apierrors.NewMethodNotSupported(req.groupResource(), "update")
+	}
+
+	obj, err := decodeObject(r)
+	if err != nil {
+		return err
+	}
+	if name := nameOf(obj); name != req.name {
+		return apierrors.NewBadRequest(fmt.Sprintf("the name of the object (%s) does not match the name on the URL (%s)", name, req.name))
+	}
+
+	updated, err := s.store.update(req.key(req.name), func(current map[string]interface{}) (map[string]interface{}, error) {
+		if current == nil {
+			return nil, apierrors.NewNotFound(req.groupResource(), req.name)
+		}
+		return s.replace(req, current, obj)
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, s.versioned(req, updated))
+	return nil
+}
+
+func (s *apiServer) patch(w http.ResponseWriter, r *http.Request, req *request) error {
+	if req.name == "" {
+		return apierrors.NewMethodNotSupported(req.groupResource(), "patch")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return apierrors.NewBadRequest(err.Error())
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	patchType := types.PatchType(mediaType)
+
+	patched, err := s.store.update(req.key(req.name), func(current map[string]interface{}) (map[string]interface{}, error) {
+		if current == nil {
+			if patchType != types.ApplyPatchType || req.subresource != "" {
+				return nil, apierrors.NewNotFound(req.groupResource(), req.name)
+			}
+			obj, err := decodeJSON(body)
+			if err != nil {
+				return nil, err
+			}
+			metadata := metadataOf(obj)
+			metadata["name"] = req.name
+			if req.resource.namespaced {
+				metadata["namespace"] = req.namespace
+			}
+			initialize(obj)
+			return s.stored(req, obj), nil
+		}
+
+		obj, err := applyPatch(req, patchType, current, body)
+		if err != nil {
+			return nil, err
+		}
+		return s.replace(req, current, obj)
+	})
+	if err != nil {
+		return err
+	}
+
+	writeJSON(w, http.StatusOK, s.versioned(req, patched))
+	return nil
+}
+
+func (s *apiServer) delete(w http.ResponseWriter, r *http.Request, req *request) error {
+	if req.subresource != "" {
+		return apierrors.NewMethodNotSupported(req.groupResource(), "delete")
+	}
+
+	keys := []objectKey{req.key(req.name)}
+	if req.name == "" {
+		matches, err := selector(r)
+		if err != nil {
+			return err
+		}
+		objs, _ := s.store.list(req.resource.group, req.resource.name, req.namespace)
+		keys = keys[:0]
+		for _, obj := range objs {
+			if matches(obj) {
+				key := req.key(nameOf(obj))
+				key.namespace = namespaceOf(obj)
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	var deleted map[string]interface{}
+	for _, key := range keys {
+		obj, err := s.store.update(key, func(current map[string]interface{}) (map[string]interface{}, error) {
+			if current == nil {
+				return nil, apierrors.NewNotFound(req.groupResource(), key.name)
+			}
+			metadata := metadataOf(current)
+			finalizers, _, _ := unstructured.NestedStringSlice(metadata, "finalizers")
+			if len(finalizers) == 0 {
+				return nil, nil
+			}
+			// Objects with finalizers are deleted once their finalizers are removed.
+			if _, ok := metadata["deletionTimestamp"]; !ok {
+				metadata["deletionTimestamp"] = metav1.Now().UTC().Format(time.RFC3339)
+				metadata["deletionGracePeriodSeconds"] = int64(0)
+			}
+			return current, nil
+		})
+		if err != nil {
+			if req.name == "" && apierrors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		deleted = obj
+
+		if req.resource.group == "" && req.resource.name == "namespaces" {
+			if _, ok := s.store.get(key); !ok {
+				s.store.deleteNamespace(key.name)
+			}
+		}
+	}
+
+	if req.name == "" {
+		writeJSON(w, http.StatusOK, &metav1.Status{TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"}, Status: metav1.StatusSuccess})
+		return nil
+	}
+	writeJSON(w, http.StatusOK, s.versioned(req, deleted))
+	return nil
+}
+
+// replace returns the object to store in place of current when a client updates it to obj.
+// Only the status of the objects can be updated through their status subresource, and only
+// their other fields through the objects themselves.
+func (s *apiServer) replace(req *request, current, obj map[string]interface{}) (map[string]interface{}, error) {
+	currentMetadata := metadataOf(current)
+	metadata := metadataOf(obj)
+	if rv, _ := metadata["resourceVersion"].(string); rv != "" && rv != currentMetadata["resourceVersion"] {
+		return nil, apierrors.NewConflict(req.groupResource(), req.name, errors.New("the object has been modified; please apply your changes to the latest version and try again"))
+	}
+
+	if req.subresource == "status" {
+		if status, ok := obj["status"]; ok {
+			current["status"] = status
+		} else {
+			delete(current, "status")
+		}
+		return s.stored(req, current), nil
+	}
+
+	for _, field := range []string{"uid", "name", "namespace", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "generation"} {
+		if value, ok := currentMetadata[field]; ok {
+			metadata[field] = value
+		} else {
+			delete(metadata, field)
+		}
+	}
+	if req.resource.status {
+		if status, ok := current["status"]; ok {
+			obj["status"] = status
+		} else {
+			delete(obj, "status")
+		}
+	}
+	if specChanged(current, obj) {
+		generation, _, _ := unstructured.NestedInt64(currentMetadata, "generation")
+		metadata["generation"] = generation + 1
+	}
+
+	finalizers, _, _ := unstructured.NestedStringSlice(metadata, "finalizers")
+	if _, deleting := metadata["deletionTimestamp"]; deleting && len(finalizers) == 0 {
+		return nil, nil
+	}
+	return s.stored(req, obj), nil
+}
+
+// stored returns obj as it is stored for the resource of the request.
+func (s *apiServer) stored(req *request, obj map[string]interface{}) map[string]interface{} {
+	obj = s.versioned(req, obj)
+	if req.resource.group == "apiextensions.k8s.io" && req.resource.name == "customresourcedefinitions" {
+		establish(obj)
+	}
+	return obj
+}
+
+// versioned returns obj in the version of the resource of the request. Objects are stored as
+// they are written, versions are not converted.
+func (s *apiServer) versioned(req *request, obj map[string]interface{}) map[string]interface{} {
+	obj["apiVersion"] = req.resource.groupVersion()
+	obj["kind"] = req.resource.kind
+	return obj
+}
+
+// specChanged returns true if anything but the metadata and the status of an object changed,
+// which increases its generation.
+func specChanged(current, obj map[string]interface{}) bool {
+	spec := func(obj map[string]interface{}) map[string]interface{} {
+		spec := map[string]interface{}{}
+		for k, v := range obj {
+			if k != "metadata" && k != "status" && k != "apiVersion" && k != "kind" {
+				spec[k] = v
+			}
+		}
+		return spec
+	}
+	return !reflect.DeepEqual(spec(current), spec(obj))
+}
+
+// applyPatch returns current patched with a patch of the given type.
+func applyPatch(req *request, patchType types.PatchType, current map[string]interface{}, patch []byte) (map[string]interface{}, error) {
+	original, err := json.Marshal(current)
+	if err != nil {
+		return nil, apierrors.NewInternalError(err)
+	}
+
+	var patched []byte
+	switch patchType {
+	case types.JSONPatchType:
+		var p jsonpatch.Patch
+		if p, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = p.Apply(original)
+		}
+	case types.MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case types.StrategicMergePatchType:
+		gvk := schema.GroupVersionKind{Group: req.resource.group, Version: req.resource.version, Kind: req.resource.kind}
+		typed, newErr := clientgoscheme.Scheme.New(gvk)
+		if newErr != nil {
+			return nil, unsupportedMediaType(fmt.Sprintf("strategic merge patches are not supported for %s", req.groupResource()))
+		}
+		patched, err = strategicpatch.StrategicMergePatch(original, patch, typed)
+	case types.ApplyPatchType:
+		// Server-side apply is approximated by merging the applied configuration into the
+		// object, fields are never removed and field managers are not tracked.
+		var applied []byte
+		if applied, err = yaml.YAMLToJSON(patch); err == nil {
+			patched, err = jsonpatch.MergePatch(original, applied)
+		}
+	default:
+		return nil, unsupportedMediaType(fmt.Sprintf("the body of the request was in an unknown format - accepted media types include: %s, %s, %s, %s", types.JSONPatchType, types.MergePatchType, types.StrategicMergePatchType, types.ApplyPatchType))
+	}
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	return decodeJSON(patched)
+}
+
+// decodeObject decodes the object in the body of a request.
+func decodeObject(r *http.Request) (map[string]interface{}, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != runtime.ContentTypeProtobuf {
+		return decodeJSON(body)
+	}
+
+	typed, _, err := codecs.UniversalDeserializer().Decode(body, nil, nil)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return obj, nil
+}
+
+// decodeJSON decodes an object encoded in JSON or YAML.
+func decodeJSON(data []byte) (map[string]interface{}, error) {
+	data, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	obj := map[string]interface{}{}
+	if err := utiljson.Unmarshal(data, &obj); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return obj, nil
+}
+
+// selector returns a function matching the objects selected by the label and field selectors of
+// a request. Fields are selected by their path in the objects, e.g. spec.nodeName.
+func selector(r *http.Request) (func(map[string]interface{}) bool, error) {
+	query := r.URL.Query()
+	labelSelector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	return func(obj map[string]interface{}) bool {
+		objLabels, _, _ := unstructured.NestedStringMap(obj, "metadata", "labels")
+		if !labelSelector.Matches(labels.Set(objLabels)) {
+			return false
+		}
+
+		objFields := fields.Set{}
+		for _, requirement := range fieldSelector.Requirements() {
+			value, _, _ := unstructured.NestedFieldNoCopy(obj, strings.Split(requirement.Field, ".")...)
+			if value != nil {
+				objFields[requirement.Field] = fmt.Sprint(value)
+			}
+		}
+		return fieldSelector.Matches(objFields)
+	}, nil
+}
+
+func unsupportedMediaType(message string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusUnsupportedMediaType,
+		Reason:  metav1.StatusReasonUnsupportedMediaType,
+		Message: message,
+	}}
+}
+
+func writeJSON(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var status metav1.Status
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		status = apiStatus.Status()
+	} else {
+		status = apierrors.NewInternalError(err).Status()
+	}
+	status.Kind, status.APIVersion = "Status", "v1"
+	writeJSON(w, int(status.Code), &status)
+}
@@ -0,0 +1,186 @@
+package simulated
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestAPIServer(t *testing.T, g *WithT) *rest.Config {
+	done := make(chan struct{})
+	server := httptest.NewServer(&apiServer{store: newStore(), version: "v1.26.0", done: done})
+	t.Cleanup(func() {
+		close(done)
+		server.Close()
+	})
+
+	return &rest.Config{Host: server.URL}
+}
+
+func TestAPIServerObjects(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	cfg := newTestAPIServer(t, g)
+	clientset, err := kubernetes.NewForConfig(cfg)
+	g.Expect(err).NotTo(HaveOccurred())
+	// The controller-runtime clients send the built-in objects in protobuf.
+	c, err := client.New(cfg, client.Options{Scheme: clientgoscheme.Scheme})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", Labels: map[string]string{"pool": "a"}},
+		Spec:       corev1.NodeSpec{ProviderID: "kwok://node-1"},
+	}
+	g.Expect(c.Create(ctx, node)).To(Succeed())
+	g.Expect(node.UID).NotTo(BeEmpty())
+	g.Expect(node.Generation).To(Equal(int64(1)))
+	g.Expect(c.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}})).To(Succeed())
+	g.Expect(apierrors.IsAlreadyExists(c.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-2"}}))).To(BeTrue())
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: "pool=a"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(nodes.Items).To(HaveLen(1))
+	g.Expect(nodes.Items[0].Spec.ProviderID).To(Equal("kwok://node-1"))
+	nodes, err = clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{FieldSelector: "metadata.name=node-2"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(nodes.Items).To(HaveLen(1))
+
+	// The status is only updated through its subresource.
+	stale := node.DeepCopy()
+	node.Spec.Unschedulable = true
+	node.Status.Phase = corev1.NodeRunning
+	g.Expect(c.Update(ctx, node)).To(Succeed())
+	g.Expect(node.Generation).To(Equal(int64(2)))
+	g.Expect(node.Status.Phase).To(BeEmpty())
+	node.Status.Phase = corev1.NodeRunning
+	g.Expect(c.Status().Update(ctx, node)).To(Succeed())
+	g.Expect(node.Status.Phase).To(Equal(corev1.NodeRunning))
+	g.Expect(node.Generation).To(Equal(int64(2)))
+	g.Expect(apierrors.IsConflict(c.Update(ctx, stale))).To(BeTrue())
+
+	// Patches of all types are applied.
+	_, err = clientset.CoreV1().Nodes().Patch(ctx, "node-1", types.MergePatchType, []byte(`{"metadata":{"labels":{"merge":"true"}}}`), metav1.PatchOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = clientset.CoreV1().Nodes().Patch(ctx, "node-1", types.StrategicMergePatchType, []byte(`{"spec":{"taints":[{"key":"a","effect":"NoSchedule"}]}}`), metav1.PatchOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = clientset.CoreV1().Nodes().Patch(ctx, "node-1", types.JSONPatchType, []byte(`[{"op":"remove","path":"/metadata/labels/pool"}]`), metav1.PatchOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	patched, err := clientset.CoreV1().Nodes().Get(ctx, "node-1", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(patched.Labels).To(Equal(map[string]string{"merge": "true"}))
+	g.Expect(patched.Spec.Taints).To(HaveLen(1))
+
+	// Objects with finalizers wait for them to be removed.
+	patched.Finalizers = []string{"test"}
+	g.Expect(c.Update(ctx, patched)).To(Succeed())
+	g.Expect(c.Delete(ctx, patched)).To(Succeed())
+	g.Expect(c.Get(ctx, client.ObjectKeyFromObject(patched), patched)).To(Succeed())
+	g.Expect(patched.DeletionTimestamp).NotTo(BeNil())
+	patched.Finalizers = nil
+	g.Expect(c.Update(ctx, patched)).To(Succeed())
+	g.Expect(apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(patched), patched))).To(BeTrue())
+
+	// Namespaced objects need their namespace, and go away with it.
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-", Namespace: "missing"}}
+	g.Expect(apierrors.IsNotFound(c.Create(ctx, configMap))).To(BeTrue())
+	g.Expect(c.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "missing"}})).To(Succeed())
+	g.Expect(c.Create(ctx, configMap)).To(Succeed())
+	g.Expect(configMap.Name).To(HavePrefix("test-"))
+	g.Expect(c.Delete(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "missing"}})).To(Succeed())
+	g.Expect(apierrors.IsNotFound(c.Get(ctx, client.ObjectKeyFromObject(configMap), configMap))).To(BeTrue())
+}
+
+func TestAPIServerWatch(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	clientset, err := kubernetes.NewForConfig(newTestAPIServer(t, g))
+	g.Expect(err).NotTo(HaveOccurred())
+
+	_, err = clientset.CoreV1().ConfigMaps("default").Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "existing"}}, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	list, err := clientset.CoreV1().ConfigMaps("default").List(ctx, metav1.ListOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	w, err := clientset.CoreV1().ConfigMaps("default").Watch(ctx, metav1.ListOptions{ResourceVersion: list.ResourceVersion})
+	g.Expect(err).NotTo(HaveOccurred())
+	defer w.Stop()
+
+	_, err = clientset.CoreV1().ConfigMaps("default").Create(ctx, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test"}}, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clientset.CoreV1().ConfigMaps("default").Delete(ctx, "test", metav1.DeleteOptions{})).To(Succeed())
+
+	for _, typ := range []watch.EventType{watch.Added, watch.Deleted} {
+		var e watch.Event
+		g.Eventually(w.ResultChan(), 5*time.Second).Should(Receive(&e))
+		g.Expect(e.Type).To(Equal(typ))
+		g.Expect(e.Object.(*corev1.ConfigMap).Name).To(Equal("test"))
+	}
+}
+
+func TestAPIServerCustomResources(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	cfg := newTestAPIServer(t, g)
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	crd := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "widgets.example.com"},
+		"spec": map[string]interface{}{
+			"group": "example.com",
+			"scope": "Namespaced",
+			"names": map[string]interface{}{"plural": "widgets", "singular": "widget", "kind": "Widget"},
+			"versions": []interface{}{
+				map[string]interface{}{"name": "v1", "served": true, "storage": true, "subresources": map[string]interface{}{"status": map[string]interface{}{}}},
+			},
+		},
+	}}
+	crdResource := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	created, err := dynamicClient.Resource(crdResource).Create(ctx, crd, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+	conditions, _, _ := unstructured.NestedSlice(created.Object, "status", "conditions")
+	g.Expect(conditions).To(ContainElement(HaveKeyWithValue("type", "Established")))
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	g.Expect(err).NotTo(HaveOccurred())
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion("example.com/v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resources.APIResources).To(HaveLen(2))
+
+	widgets := dynamicClient.Resource(schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}).Namespace("default")
+	widget := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Widget",
+		"metadata":   map[string]interface{}{"name": "test"},
+		"spec":       map[string]interface{}{"size": int64(1)},
+	}}
+	_, err = widgets.Create(ctx, widget, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	applied, err := widgets.Patch(ctx, "test", types.ApplyPatchType, []byte("apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: test\nspec:\n  color: blue\n"), metav1.PatchOptions{FieldManager: "test"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(applied.Object["spec"]).To(Equal(map[string]interface{}{"size": int64(1), "color": "blue"}))
+
+	_, err = widgets.Patch(ctx, "test", types.StrategicMergePatchType, []byte(`{"spec":{"size":2}}`), metav1.PatchOptions{})
+	g.Expect(apierrors.ReasonForError(err)).To(Equal(metav1.StatusReasonUnsupportedMediaType))
+}
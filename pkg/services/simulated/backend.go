@@ -0,0 +1,362 @@
+// Package simulated implements a backend running clusters without any of the kwokctl components.
+// The API server of each cluster is served by the manager process from objects kept in memory,
+// which keeps the cost of a cluster low enough to scale test the Cluster API controllers with
+// thousands of clusters on a single host.
+package simulated
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+	"github.com/capi-samples/cluster-api-provider-kwok/pkg/services"
+)
+
+const (
+	// markerFile marks the working directories of simulated clusters.
+	markerFile = "simulated"
+
+	// defaultBindAddress is the address the API server of a cluster listens on when its
+	// configuration doesn't set one. Nothing authenticates the clients of the API server, so it
+	// is only reachable from the host by default.
+	defaultBindAddress = "127.0.0.1"
+
+	// heartbeatInterval is how often the heartbeats of the nodes are renewed, like kwok-controller
+	// does for the nodes of the kwokctl clusters.
+	heartbeatInterval = 20 * time.Second
+)
+
+// Backend runs clusters of the simulated runtime. Their objects only live in memory, so after a
+// restart of the manager its clusters are found not created, and are created again.
+type Backend struct {
+	mu       sync.Mutex
+	clusters map[string]*cluster
+}
+
+var _ services.Backend = &Backend{}
+
+// New returns a backend without clusters.
+func New() *Backend {
+	return &Backend{
+		clusters: map[string]*cluster{},
+	}
+}
+
+func (b *Backend) Supports(runtime string) bool {
+	return runtime == infrav1.RuntimeSimulated
+}
+
+func (b *Backend) Cluster(runtime, name, workDir string) (services.BackendCluster, error) {
+	if !b.Supports(runtime) {
+		return nil, fmt.Errorf("runtime %q not found", runtime)
+	}
+	return b.cluster(name, workDir), nil
+}
+
+func (b *Backend) Load(ctx context.Context, name, workDir string) (services.BackendCluster, error) {
+	if _, err := os.Stat(filepath.Join(workDir, markerFile)); err != nil {
+		return nil, fmt.Errorf("loading simulated cluster %q: %w", name, err)
+	}
+	return b.cluster(name, workDir), nil
+}
+
+func (b *Backend) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), markerFile)); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (b *Backend) cluster(name, workDir string) *cluster {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.clusters[workDir]
+	if !ok {
+		c = &cluster{backend: b, name: name, workDir: workDir}
+		b.clusters[workDir] = c
+	}
+	return c
+}
+
+// cluster is a simulated cluster, shared by all the BackendClusters returned for its working
+// directory.
+type cluster struct {
+	backend *Backend
+	name    string
+	workDir string
+
+	mu     sync.Mutex
+	conf   *internalversion.KwokctlConfiguration
+	store  *store
+	server *http.Server
+	done   chan struct{}
+}
+
+func (c *cluster) Available(ctx context.Context) error {
+	return nil
+}
+
+func (c *cluster) Config(ctx context.Context) (*internalversion.KwokctlConfiguration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conf == nil {
+		return nil, c.notCreated()
+	}
+	return c.conf.DeepCopy(), nil
+}
+
+// Create saves the configuration of the cluster. The API server listens on any free port when
+// the configuration doesn't set one.
+func (c *cluster) Create(ctx context.Context, conf *internalversion.KwokctlConfiguration) error {
+	conf = conf.DeepCopy()
+	if conf.Options.KubeApiserverPort == 0 {
+		port, err := freePort(bindAddress(conf))
+		if err != nil {
+			return fmt.Errorf("failed to get a port for the API server: %w", err)
+		}
+		conf.Options.KubeApiserverPort = port
+	}
+
+	if err := os.MkdirAll(c.workDir, 0o750); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(c.workDir, markerFile), nil, 0o600); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.conf = conf
+	if c.store == nil {
+		c.store = newStore()
+	}
+	return nil
+}
+
+func (c *cluster) Delete(ctx context.Context) error {
+	c.stop()
+	if err := os.RemoveAll(c.workDir); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.conf = nil
+	c.store = nil
+	c.mu.Unlock()
+
+	c.backend.mu.Lock()
+	delete(c.backend.clusters, c.workDir)
+	c.backend.mu.Unlock()
+	return nil
+}
+
+// Up starts the API server of the cluster.
+func (c *cluster) Up(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conf == nil {
+		return c.notCreated()
+	}
+	if c.server != nil {
+		return nil
+	}
+
+	address := net.JoinHostPort(bindAddress(c.conf), strconv.FormatUint(uint64(c.conf.Options.KubeApiserverPort), 10))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	c.done = make(chan struct{})
+	c.server = &http.Server{
+		Handler: &apiServer{
+			store:   c.store,
+			version: c.conf.Options.KubeVersion,
+			done:    c.done,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func(server *http.Server) {
+		_ = server.Serve(listener)
+	}(c.server)
+	go renewHeartbeats(c.store, c.done)
+
+	return nil
+}
+
+// Down stops the API server of the cluster and removes its objects.
+func (c *cluster) Down(ctx context.Context) error {
+	c.stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.store != nil {
+		c.store.reset()
+	}
+	return nil
+}
+
+// Stop stops the API server of the cluster, keeping its objects.
+func (c *cluster) Stop(ctx context.Context) error {
+	c.stop()
+	return nil
+}
+
+// StartComponent starts the API server of the cluster, which serves all of its components.
+func (c *cluster) StartComponent(ctx context.Context, name string) error {
+	return c.Up(ctx)
+}
+
+// StopComponent stops the API server of the cluster, which serves all of its components.
+func (c *cluster) StopComponent(ctx context.Context, name string) error {
+	return c.Stop(ctx)
+}
+
+func (c *cluster) SnapshotSave(ctx context.Context, path string) error {
+	c.mu.Lock()
+	s := c.store
+	c.mu.Unlock()
+
+	if s == nil {
+		return c.notCreated()
+	}
+	return s.save(path)
+}
+
+func (c *cluster) SnapshotRestore(ctx context.Context, path string) error {
+	c.mu.Lock()
+	s := c.store
+	c.mu.Unlock()
+
+	if s == nil {
+		return c.notCreated()
+	}
+	return s.restore(path)
+}
+
+func (c *cluster) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.server == nil {
+		return
+	}
+	close(c.done)
+	_ = c.server.Close()
+	c.server = nil
+}
+
+func (c *cluster) notCreated() error {
+	return fmt.Errorf("simulated cluster %q is not created: %w", c.name, os.ErrNotExist)
+}
+
+// renewHeartbeats keeps the nodes of the cluster ready until done is closed, in place of
+// kwok-controller.
+func renewHeartbeats(s *store, done <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		nodes, _ := s.list("", "nodes", "")
+		for _, node := range nodes {
+			_, _ = s.update(objectKey{resource: "nodes", name: nameOf(node)}, func(current map[string]interface{}) (map[string]interface{}, error) {
+				if current != nil {
+					setNodeReady(current, time.Now())
+				}
+				return current, nil
+			})
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setNodeReady sets the Ready condition of node, renewing its heartbeat.
+func setNodeReady(node map[string]interface{}, now time.Time) {
+	timestamp := now.UTC().Format(time.RFC3339)
+	ready := map[string]interface{}{
+		"type":               "Ready",
+		"status":             "True",
+		"reason":             "KubeletReady",
+		"message":            "kubelet is posting ready status",
+		"lastHeartbeatTime":  timestamp,
+		"lastTransitionTime": timestamp,
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(node, "status", "conditions")
+	found := false
+	for i, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == "True" && condition["lastTransitionTime"] != nil {
+			ready["lastTransitionTime"] = condition["lastTransitionTime"]
+		}
+		conditions[i] = ready
+		found = true
+	}
+	if !found {
+		conditions = append(conditions, ready)
+	}
+	_ = unstructured.SetNestedSlice(node, conditions, "status", "conditions")
+}
+
+// bindAddress returns the address the API server of a cluster listens on, set by the bind-address
+// arg of kube-apiserver in the configuration of the cluster.
+func bindAddress(conf *internalversion.KwokctlConfiguration) string {
+	for _, patches := range conf.ComponentsPatches {
+		if patches.Name != "kube-apiserver" {
+			continue
+		}
+		for _, arg := range patches.ExtraArgs {
+			if arg.Key == "bind-address" && arg.Value != "" {
+				return arg.Value
+			}
+		}
+	}
+	return defaultBindAddress
+}
+
+func freePort(address string) (uint32, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(address, "0"))
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return uint32(listener.Addr().(*net.TCPAddr).Port), nil
+}
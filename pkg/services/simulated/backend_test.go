@@ -0,0 +1,164 @@
+package simulated
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/kwok/pkg/apis/internalversion"
+	"sigs.k8s.io/kwok/pkg/utils/format"
+
+	infrav1 "github.com/capi-samples/cluster-api-provider-kwok/api/infrastructure/v1beta1"
+)
+
+func TestCluster(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	root := t.TempDir()
+	workDir := filepath.Join(root, "test")
+	backend := New()
+	g.Expect(backend.Supports(infrav1.RuntimeSimulated)).To(BeTrue())
+	g.Expect(backend.Supports("docker")).To(BeFalse())
+
+	rt, err := backend.Cluster(infrav1.RuntimeSimulated, "test", workDir)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = rt.Config(ctx)
+	g.Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	_, err = backend.Load(ctx, "test", workDir)
+	g.Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+
+	g.Expect(rt.Create(ctx, &internalversion.KwokctlConfiguration{
+		Options: internalversion.KwokctlConfigurationOptions{KubeVersion: "v1.26.0"},
+	})).To(Succeed())
+	conf, err := rt.Config(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(conf.Options.KubeApiserverPort).NotTo(BeZero())
+	g.Expect(backend.List(root)).To(Equal([]string{"test"}))
+	_, err = backend.Load(ctx, "test", workDir)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(rt.Up(ctx)).To(Succeed())
+	t.Cleanup(func() {
+		_ = rt.Stop(ctx)
+	})
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: "http://127.0.0.1:" + format.String(conf.Options.KubeApiserverPort)})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	version, err := client.Discovery().ServerVersion()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(version.GitVersion).To(Equal("v1.26.0"))
+	readyz, err := client.Discovery().RESTClient().Get().AbsPath("/readyz").DoRaw(ctx)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(readyz)).To(Equal("ok"))
+
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default"}}
+	_, err = client.CoreV1().ConfigMaps("default").Create(ctx, configMap, metav1.CreateOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// The objects are kept while stopped and restored from snapshots.
+	snapshot := filepath.Join(root, "test.db")
+	g.Expect(rt.SnapshotSave(ctx, snapshot)).To(Succeed())
+	g.Expect(client.CoreV1().ConfigMaps("default").Delete(ctx, "test", metav1.DeleteOptions{})).To(Succeed())
+	g.Expect(rt.SnapshotRestore(ctx, snapshot)).To(Succeed())
+
+	g.Expect(rt.Stop(ctx)).To(Succeed())
+	_, err = client.Discovery().ServerVersion()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(rt.Up(ctx)).To(Succeed())
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "test", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// The objects are removed when the cluster is brought down.
+	g.Expect(rt.Down(ctx)).To(Succeed())
+	g.Expect(rt.Up(ctx)).To(Succeed())
+	_, err = client.CoreV1().ConfigMaps("default").Get(ctx, "test", metav1.GetOptions{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	_, err = client.CoreV1().Namespaces().Get(ctx, "kube-system", metav1.GetOptions{})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	g.Expect(rt.Delete(ctx)).To(Succeed())
+	g.Expect(workDir).NotTo(BeADirectory())
+	_, err = backend.Load(ctx, "test", workDir)
+	g.Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	g.Expect(backend.List(root)).To(BeEmpty())
+}
+
+func TestClusterLostState(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+
+	workDir := filepath.Join(t.TempDir(), "test")
+	rt, err := New().Cluster(infrav1.RuntimeSimulated, "test", workDir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rt.Create(ctx, &internalversion.KwokctlConfiguration{})).To(Succeed())
+
+	// A new backend, as after a restart of the manager, loads the cluster to delete it but
+	// doesn't know its configuration.
+	loaded, err := New().Load(ctx, "test", workDir)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = loaded.Config(ctx)
+	g.Expect(errors.Is(err, os.ErrNotExist)).To(BeTrue())
+	g.Expect(loaded.Down(ctx)).To(Succeed())
+	g.Expect(loaded.Delete(ctx)).To(Succeed())
+	g.Expect(workDir).NotTo(BeADirectory())
+}
+
+func TestBindAddress(t *testing.T) {
+	testCases := []struct {
+		name    string
+		patches []internalversion.ComponentPatches
+		expect  string
+	}{
+		{
+			name:   "listens on the loopback address by default",
+			expect: "127.0.0.1",
+		},
+		{
+			name: "listens on the bind address of kube-apiserver",
+			patches: []internalversion.ComponentPatches{
+				{Name: "kube-controller-manager", ExtraArgs: []internalversion.ExtraArgs{{Key: "bind-address", Value: "10.0.0.2"}}},
+				{Name: "kube-apiserver", ExtraArgs: []internalversion.ExtraArgs{{Key: "bind-address", Value: "10.0.0.1"}}},
+			},
+			expect: "10.0.0.1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(bindAddress(&internalversion.KwokctlConfiguration{ComponentsPatches: tc.patches})).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestSetNodeReady(t *testing.T) {
+	g := NewWithT(t)
+
+	node := map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "MemoryPressure", "status": "False"},
+				map[string]interface{}{"type": "Ready", "status": "True", "lastTransitionTime": "2023-01-01T00:00:00Z"},
+			},
+		},
+	}
+
+	now := metav1.Now().Rfc3339Copy()
+	setNodeReady(node, now.Time)
+
+	conditions := node["status"].(map[string]interface{})["conditions"].([]interface{})
+	g.Expect(conditions).To(HaveLen(2))
+	ready := conditions[1].(map[string]interface{})
+	g.Expect(ready).To(HaveKeyWithValue("lastHeartbeatTime", now.UTC().Format("2006-01-02T15:04:05Z07:00")))
+	g.Expect(ready).To(HaveKeyWithValue("lastTransitionTime", "2023-01-01T00:00:00Z"))
+}
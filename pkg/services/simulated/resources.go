@@ -0,0 +1,133 @@
+package simulated
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// resource is a kind of object served by the API server.
+type resource struct {
+	group      string
+	version    string
+	name       string
+	singular   string
+	kind       string
+	namespaced bool
+
+	// status is true when the status of the objects is only changed through their status
+	// subresource.
+	status bool
+}
+
+func (r resource) groupVersion() string {
+	if r.group == "" {
+		return r.version
+	}
+	return r.group + "/" + r.version
+}
+
+// builtinResources are the built-in resources served by every cluster. They cover what the
+// Cluster API controllers, kwok and the usual addons read and write.
+var builtinResources = []resource{
+	{version: "v1", name: "namespaces", singular: "namespace", kind: "Namespace", status: true},
+	{version: "v1", name: "nodes", singular: "node", kind: "Node", status: true},
+	{version: "v1", name: "pods", singular: "pod", kind: "Pod", namespaced: true, status: true},
+	{version: "v1", name: "services", singular: "service", kind: "Service", namespaced: true, status: true},
+	{version: "v1", name: "endpoints", singular: "endpoints", kind: "Endpoints", namespaced: true},
+	{version: "v1", name: "configmaps", singular: "configmap", kind: "ConfigMap", namespaced: true},
+	{version: "v1", name: "secrets", singular: "secret", kind: "Secret", namespaced: true},
+	{version: "v1", name: "serviceaccounts", singular: "serviceaccount", kind: "ServiceAccount", namespaced: true},
+	{version: "v1", name: "events", singular: "event", kind: "Event", namespaced: true},
+	{version: "v1", name: "persistentvolumes", singular: "persistentvolume", kind: "PersistentVolume", status: true},
+	{version: "v1", name: "persistentvolumeclaims", singular: "persistentvolumeclaim", kind: "PersistentVolumeClaim", namespaced: true, status: true},
+	{group: "apps", version: "v1", name: "deployments", singular: "deployment", kind: "Deployment", namespaced: true, status: true},
+	{group: "apps", version: "v1", name: "daemonsets", singular: "daemonset", kind: "DaemonSet", namespaced: true, status: true},
+	{group: "apps", version: "v1", name: "statefulsets", singular: "statefulset", kind: "StatefulSet", namespaced: true, status: true},
+	{group: "apps", version: "v1", name: "replicasets", singular: "replicaset", kind: "ReplicaSet", namespaced: true, status: true},
+	{group: "coordination.k8s.io", version: "v1", name: "leases", singular: "lease", kind: "Lease", namespaced: true},
+	{group: "rbac.authorization.k8s.io", version: "v1", name: "roles", singular: "role", kind: "Role", namespaced: true},
+	{group: "rbac.authorization.k8s.io", version: "v1", name: "rolebindings", singular: "rolebinding", kind: "RoleBinding", namespaced: true},
+	{group: "rbac.authorization.k8s.io", version: "v1", name: "clusterroles", singular: "clusterrole", kind: "ClusterRole"},
+	{group: "rbac.authorization.k8s.io", version: "v1", name: "clusterrolebindings", singular: "clusterrolebinding", kind: "ClusterRoleBinding"},
+	{group: "apiextensions.k8s.io", version: "v1", name: "customresourcedefinitions", singular: "customresourcedefinition", kind: "CustomResourceDefinition", status: true},
+}
+
+// customResources returns the resources defined by a CustomResourceDefinition.
+func customResources(crd map[string]interface{}) []resource {
+	group, _, _ := unstructured.NestedString(crd, "spec", "group")
+	name, _, _ := unstructured.NestedString(crd, "spec", "names", "plural")
+	singular, _, _ := unstructured.NestedString(crd, "spec", "names", "singular")
+	kind, _, _ := unstructured.NestedString(crd, "spec", "names", "kind")
+	scope, _, _ := unstructured.NestedString(crd, "spec", "scope")
+	versions, _, _ := unstructured.NestedSlice(crd, "spec", "versions")
+
+	var resources []resource
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if served, _, _ := unstructured.NestedBool(version, "served"); !served {
+			continue
+		}
+		versionName, _, _ := unstructured.NestedString(version, "name")
+		_, status, _ := unstructured.NestedMap(version, "subresources", "status")
+		resources = append(resources, resource{
+			group:      group,
+			version:    versionName,
+			name:       name,
+			singular:   singular,
+			kind:       kind,
+			namespaced: scope == "Namespaced",
+			status:     status,
+		})
+	}
+	return resources
+}
+
+// establish marks a CustomResourceDefinition as established, its resources are served as soon
+// as it is created.
+func establish(crd map[string]interface{}) {
+	names, _, _ := unstructured.NestedMap(crd, "spec", "names")
+	now := time.Now().UTC().Format(time.RFC3339)
+	_ = unstructured.SetNestedField(crd, map[string]interface{}{
+		"acceptedNames": names,
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "NamesAccepted", "status": "True", "reason": "NoConflicts", "lastTransitionTime": now},
+			map[string]interface{}{"type": "Established", "status": "True", "reason": "InitialNamesAccepted", "lastTransitionTime": now},
+		},
+	}, "status")
+}
+
+// initialize sets the fields the API server sets on the objects it creates.
+func initialize(obj map[string]interface{}) {
+	metadata := metadataOf(obj)
+	metadata["uid"] = string(uuid.NewUUID())
+	metadata["creationTimestamp"] = metav1.Now().UTC().Format(time.RFC3339)
+	metadata["generation"] = int64(1)
+	delete(metadata, "deletionTimestamp")
+	delete(metadata, "deletionGracePeriodSeconds")
+	delete(metadata, "resourceVersion")
+}
+
+func metadataOf(obj map[string]interface{}) map[string]interface{} {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{}
+		obj["metadata"] = metadata
+	}
+	return metadata
+}
+
+func nameOf(obj map[string]interface{}) string {
+	name, _ := metadataOf(obj)["name"].(string)
+	return name
+}
+
+func namespaceOf(obj map[string]interface{}) string {
+	namespace, _ := metadataOf(obj)["namespace"].(string)
+	return namespace
+}
@@ -0,0 +1,277 @@
+package simulated
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// maxEvents is the number of changes kept for watches to resume from. Older resource versions
+// are expired, like etcd compacts its history.
+const maxEvents = 10000
+
+// objectKey identifies an object in the store.
+type objectKey struct {
+	group     string
+	resource  string
+	namespace string
+	name      string
+}
+
+// event is a change of an object. The object is its state after the change, or its last state
+// when it was deleted.
+type event struct {
+	typ             watch.EventType
+	key             objectKey
+	object          map[string]interface{}
+	resourceVersion uint64
+}
+
+// store keeps the objects of a cluster in memory, in place of etcd.
+type store struct {
+	mu sync.Mutex
+
+	resourceVersion uint64
+	objects         map[objectKey]map[string]interface{}
+
+	// events are the latest changes, compacted is the resource version of the latest change
+	// that was dropped from them.
+	events    []event
+	compacted uint64
+
+	// changed is closed and replaced on every change to wake up the watches.
+	changed chan struct{}
+}
+
+func newStore() *store {
+	s := &store{changed: make(chan struct{})}
+	s.reset()
+	return s
+}
+
+// reset removes all the objects but the default namespaces, like a newly created cluster has.
+func (s *store) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects = map[objectKey]map[string]interface{}{}
+	for _, name := range []string{"default", "kube-system", "kube-public", "kube-node-lease"} {
+		obj := map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": name},
+			"status":     map[string]interface{}{"phase": "Active"},
+		}
+		initialize(obj)
+		s.resourceVersion++
+		setResourceVersion(obj, s.resourceVersion)
+		s.objects[objectKey{resource: "namespaces", name: name}] = obj
+	}
+	s.expire()
+}
+
+// expire drops all the changes, so the watches start over from the current state.
+func (s *store) expire() {
+	s.events = nil
+	s.compacted = s.resourceVersion
+	s.notify()
+}
+
+func (s *store) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// get returns a copy of the object at key.
+func (s *store) get(key objectKey) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, false
+	}
+	return runtime.DeepCopyJSON(obj), true
+}
+
+// list returns copies of the objects of a resource in namespace, or in all namespaces when
+// namespace is empty, along with the current resource version.
+func (s *store) list(group, resource, namespace string) ([]map[string]interface{}, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]objectKey, 0)
+	for key := range s.objects {
+		if key.group == group && key.resource == resource && (namespace == "" || key.namespace == namespace) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].namespace != keys[j].namespace {
+			return keys[i].namespace < keys[j].namespace
+		}
+		return keys[i].name < keys[j].name
+	})
+
+	objs := make([]map[string]interface{}, 0, len(keys))
+	for _, key := range keys {
+		objs = append(objs, runtime.DeepCopyJSON(s.objects[key]))
+	}
+	return objs, s.resourceVersion
+}
+
+// update replaces the object at key with the one returned by fn, which gets a copy of the
+// current object or nil when there is none. The object is deleted when fn returns nil. It
+// returns the new object, or the deleted one.
+func (s *store) update(key objectKey, fn func(current map[string]interface{}) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.objects[key]
+	if exists {
+		current = runtime.DeepCopyJSON(current)
+	}
+	obj, err := fn(current)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil && !exists {
+		return nil, nil
+	}
+
+	s.resourceVersion++
+	typ := watch.Modified
+	switch {
+	case obj == nil:
+		typ = watch.Deleted
+		obj = current
+		delete(s.objects, key)
+	case !exists:
+		typ = watch.Added
+	}
+	setResourceVersion(obj, s.resourceVersion)
+	if typ != watch.Deleted {
+		s.objects[key] = obj
+	}
+
+	s.events = append(s.events, event{typ: typ, key: key, object: obj, resourceVersion: s.resourceVersion})
+	if len(s.events) > maxEvents {
+		s.compacted = s.events[0].resourceVersion
+		s.events = s.events[1:]
+	}
+	s.notify()
+
+	return runtime.DeepCopyJSON(obj), nil
+}
+
+// deleteNamespace deletes all the objects in namespace.
+func (s *store) deleteNamespace(namespace string) {
+	s.mu.Lock()
+	keys := make([]objectKey, 0)
+	for key := range s.objects {
+		if key.namespace == namespace {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		_, _ = s.update(key, func(map[string]interface{}) (map[string]interface{}, error) {
+			return nil, nil
+		})
+	}
+}
+
+// eventsSince returns the changes made after resourceVersion, along with a channel closed on
+// the next change. It returns false when the changes were compacted.
+func (s *store) eventsSince(resourceVersion uint64) ([]event, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if resourceVersion < s.compacted {
+		return nil, nil, false
+	}
+
+	i := sort.Search(len(s.events), func(i int) bool {
+		return s.events[i].resourceVersion > resourceVersion
+	})
+	events := make([]event, len(s.events)-i)
+	copy(events, s.events[i:])
+
+	return events, s.changed, true
+}
+
+// snapshot is the content of a store saved to a file.
+type snapshot struct {
+	ResourceVersion uint64           `json:"resourceVersion"`
+	Objects         []snapshotObject `json:"objects"`
+}
+
+type snapshotObject struct {
+	Group    string                 `json:"group,omitempty"`
+	Resource string                 `json:"resource"`
+	Object   map[string]interface{} `json:"object"`
+}
+
+// save writes all the objects to the file at path.
+func (s *store) save(path string) error {
+	s.mu.Lock()
+	snap := snapshot{ResourceVersion: s.resourceVersion}
+	for key, obj := range s.objects {
+		snap.Objects = append(snap.Objects, snapshotObject{Group: key.group, Resource: key.resource, Object: obj})
+	}
+	data, err := json.Marshal(snap)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
+
+// restore replaces all the objects with the ones saved to the file at path. The watches are
+// expired, as their resource versions don't match the restored objects anymore.
+func (s *store) restore(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&snap); err != nil {
+		return err
+	}
+	for _, o := range snap.Objects {
+		if err := utiljson.ConvertMapNumbers(o.Object, 0); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects = map[objectKey]map[string]interface{}{}
+	for _, o := range snap.Objects {
+		key := objectKey{group: o.Group, resource: o.Resource, namespace: namespaceOf(o.Object), name: nameOf(o.Object)}
+		s.objects[key] = o.Object
+	}
+	if snap.ResourceVersion > s.resourceVersion {
+		s.resourceVersion = snap.ResourceVersion
+	}
+	s.resourceVersion++
+	s.expire()
+
+	return nil
+}
+
+func setResourceVersion(obj map[string]interface{}, resourceVersion uint64) {
+	metadataOf(obj)["resourceVersion"] = strconv.FormatUint(resourceVersion, 10)
+}